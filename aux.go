@@ -0,0 +1,115 @@
+package indexes
+
+// keyAdded records that key has just gained its first value, updating the key count and the auxiliary indexes.
+// The caller must hold the write lock.
+func (t *GenericTrie[V]) keyAdded(key string) {
+	t.keys++
+	if t.infix != nil {
+		runes := []rune(key)
+		for i := range runes {
+			t.infix.add(runes[i:], key)
+		}
+	}
+	if t.suffix != nil {
+		t.suffix.add(reverseRunes(key), key)
+	}
+}
+
+// keyRemoved records that key has just lost its last value, updating the key count and the auxiliary indexes.
+// The caller must hold the write lock.
+func (t *GenericTrie[V]) keyRemoved(key string) {
+	t.keys--
+	if t.infix != nil {
+		runes := []rune(key)
+		for i := range runes {
+			t.infix.remove(runes[i:], key)
+		}
+	}
+	if t.suffix != nil {
+		t.suffix.remove(reverseRunes(key), key)
+	}
+}
+
+// reverseRunes returns the runes of s in reverse order
+func reverseRunes(s string) []rune {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return runes
+}
+
+// rebuildAux recomputes the key count, value count and auxiliary indexes from the nodes. The caller must hold the write lock
+// or otherwise own t exclusively.
+func (t *GenericTrie[V]) rebuildAux() {
+	fresh := newTrie[V](t.cfg)
+	t.keys, t.vals, t.reverse, t.infix, t.suffix = 0, 0, fresh.reverse, fresh.infix, fresh.suffix
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		if size := node.IDSet.Size(); size != 0 {
+			k := string(key)
+			t.keyAdded(k)
+			t.vals += size
+			for _, id := range node.IDSet.GetVals() {
+				t.indexReverse(id, k)
+			}
+		}
+		return true
+	})
+}
+
+// indexReverse records that id is now stored under key, if the reverse index is enabled
+func (t *GenericTrie[V]) indexReverse(id V, key string) {
+	if t.reverse != nil {
+		t.reverse[id] = append(t.reverse[id], key)
+	}
+}
+
+// unindexReverse records that id is no longer stored under key, if the reverse index is enabled
+func (t *GenericTrie[V]) unindexReverse(id V, key string) {
+	if t.reverse == nil {
+		return
+	}
+	keys := t.reverse[id]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(t.reverse, id)
+	} else {
+		t.reverse[id] = keys
+	}
+}
+
+// keysOf returns every key id is stored under, using the reverse index when it is enabled and walking the Trie otherwise
+func (t *GenericTrie[V]) keysOf(id V) []string {
+	if t.reverse != nil {
+		return append([]string(nil), t.reverse[id]...)
+	}
+	var keys []string
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		if node.ContainsVal(id) {
+			keys = append(keys, string(key))
+		}
+		return true
+	})
+	return keys
+}
+
+/*
+RemoveID removes the id from every key it is stored under, pruning emptied branches, and returns the number of keys affected.
+With WithReverseIndex the keys are looked up directly; otherwise RemoveID has to walk the whole Trie to find them.
+*/
+func (t *GenericTrie[V]) RemoveID(id V) int {
+	t.mx.Lock()
+	defer t.unlock()
+	affected := 0
+	for _, key := range t.keysOf(id) {
+		if t.removePair(key, id) {
+			affected++
+		}
+	}
+	return affected
+}
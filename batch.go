@@ -0,0 +1,130 @@
+package indexes
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// inChunks calls fn for consecutive [lo, hi) ranges covering n entries, holding the write lock for each call.
+// With WithBatchChunkSize the lock is released between chunks so readers are not starved by large batches.
+func (t *GenericTrie[V]) inChunks(n int, fn func(lo, hi int)) {
+	size := t.cfg.chunkSize
+	if size <= 0 {
+		size = n
+	}
+	for lo := 0; lo < n; lo += size {
+		hi := lo + size
+		if hi > n {
+			hi = n
+		}
+		t.mx.Lock()
+		fn(lo, hi)
+		t.unlock()
+	}
+}
+
+// AddMany inserts every (key, id) pair in entries, taking the write lock once per chunk rather than once per entry.
+// Duplicates are skipped the same way Add skips them, as are empty keys, and the number of newly inserted pairs is returned.
+func (t *GenericTrie[V]) AddMany(entries []GenericKeyID[V]) int {
+	inserted := 0
+	t.inChunks(len(entries), func(lo, hi int) {
+		for _, e := range entries[lo:hi] {
+			key, err := t.storedKey(e.Key)
+			if err != nil {
+				continue
+			}
+			if _, ok := t.insert(key, e.Key, e.ID); ok {
+				inserted++
+			}
+		}
+	})
+	return inserted
+}
+
+// RemoveMany removes every (key, id) pair in entries, taking the write lock once per chunk rather than once per entry,
+// and returns the number of pairs actually removed.
+func (t *GenericTrie[V]) RemoveMany(entries []GenericKeyID[V]) int {
+	removed := 0
+	t.inChunks(len(entries), func(lo, hi int) {
+		for _, e := range entries[lo:hi] {
+			if t.removePair(t.normalize(e.Key), e.ID) {
+				removed++
+			}
+		}
+	})
+	return removed
+}
+
+// GenericBatchOp is a single add or remove of a (key, id) pair within a Batch
+type GenericBatchOp[V comparable] struct {
+	Remove bool
+	Key    string
+	ID     V
+}
+
+// BatchOp is the GenericBatchOp of a Trie
+type BatchOp = GenericBatchOp[bson.ObjectId]
+
+// GenericBatch is an ordered list of adds and removes applied atomically by Apply
+type GenericBatch[V comparable] struct {
+	Ops []GenericBatchOp[V]
+	// StrictRemoves makes Apply fail the whole batch if a remove references a pair that is not present
+	// at that point in the batch; otherwise such removes are no-ops
+	StrictRemoves bool
+}
+
+// Batch is the GenericBatch of a Trie
+type Batch = GenericBatch[bson.ObjectId]
+
+// Add appends an add of the (key, id) pair to the batch
+func (b *GenericBatch[V]) Add(key string, id V) {
+	b.Ops = append(b.Ops, GenericBatchOp[V]{Key: key, ID: id})
+}
+
+// Remove appends a remove of the (key, id) pair to the batch
+func (b *GenericBatch[V]) Remove(key string, id V) {
+	b.Ops = append(b.Ops, GenericBatchOp[V]{Remove: true, Key: key, ID: id})
+}
+
+/*
+Apply executes the batch's operations in order under a single write lock, so readers observe either none or all of them.
+Every operation is validated before anything is modified: an add with an empty key fails with ErrEmptyKey, and with
+StrictRemoves a remove of a pair that would not be present at that point fails with ErrIDNotFound. On failure the Trie
+is left untouched and the returned error names the offending operation.
+*/
+func (t *GenericTrie[V]) Apply(batch GenericBatch[V]) error {
+	t.mx.Lock()
+	defer t.unlock()
+	ops := make([]GenericKeyID[V], len(batch.Ops))
+	// present tracks the pairs touched so far, as the batch would leave them
+	present := make(map[GenericKeyID[V]]bool)
+	for i, op := range batch.Ops {
+		key := t.normalize(op.Key)
+		if !op.Remove && (strings.TrimSpace(op.Key) == "" || strings.TrimSpace(key) == "") {
+			return fmt.Errorf("indexes: batch op %d: %w", i, ErrEmptyKey)
+		}
+		pair := GenericKeyID[V]{Key: key, ID: op.ID}
+		ops[i] = pair
+		if op.Remove && batch.StrictRemoves {
+			exists, seen := present[pair]
+			if !seen {
+				tip := findTip(pair.Key, t.root)
+				exists = tip != nil && tip.ContainsVal(pair.ID)
+			}
+			if !exists {
+				return fmt.Errorf("indexes: batch op %d: remove of (%q, %s): %w", i, op.Key, codecOf[V]().format(op.ID), ErrIDNotFound)
+			}
+		}
+		present[pair] = !op.Remove
+	}
+	for i, op := range batch.Ops {
+		if op.Remove {
+			t.removePair(ops[i].Key, ops[i].ID)
+		} else {
+			t.insert(ops[i].Key, op.Key, op.ID)
+		}
+	}
+	return nil
+}
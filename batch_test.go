@@ -0,0 +1,115 @@
+package indexes
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// batchEntries returns n distinct (key, id) pairs
+func batchEntries(n int) []KeyID {
+	entries := make([]KeyID, n)
+	for i := range entries {
+		entries[i] = KeyID{Key: fmt.Sprintf("user%07d", i), ID: objectID(i)}
+	}
+	return entries
+}
+
+// BenchmarkRemoveMany compares removing 50k pairs one Remove at a time with a single RemoveMany
+func BenchmarkRemoveMany(b *testing.B) {
+	entries := batchEntries(50000)
+	b.Run("Remove", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			tr := NewTrie()
+			tr.AddMany(entries)
+			b.StartTimer()
+			for _, e := range entries {
+				tr.Remove(e.Key, e.ID)
+			}
+		}
+	})
+	b.Run("RemoveMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			tr := NewTrie()
+			tr.AddMany(entries)
+			b.StartTimer()
+			tr.RemoveMany(entries)
+		}
+	})
+}
+
+// BenchmarkAddMany compares adding 1M pairs one Add at a time with a single AddMany
+func BenchmarkAddMany(b *testing.B) {
+	entries := batchEntries(1000000)
+	b.Run("Add", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tr := NewTrie()
+			for _, e := range entries {
+				tr.Add(e.Key, e.ID)
+			}
+		}
+	})
+	b.Run("AddMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewTrie().AddMany(entries)
+		}
+	})
+}
+
+func TestAddMany(t *testing.T) {
+	entries := batchEntries(1000)
+	entries = append(entries, entries[:10]...)
+	entries = append(entries, KeyID{Key: " ", ID: objectID(1)})
+	for _, chunk := range []int{0, 1, 7, 5000} {
+		tr := NewTrie(WithBatchChunkSize(chunk))
+		expect(t, fmt.Sprintf("AddMany with chunks of %d", chunk), tr.AddMany(entries), 1000)
+		expect(t, fmt.Sprintf("ValueCount with chunks of %d", chunk), tr.ValueCount(), 1000)
+	}
+}
+
+// TestApplyAtomic moves every id between two keys in batches while readers check that each id is always stored under
+// exactly one of them; run it with -race
+func TestApplyAtomic(t *testing.T) {
+	const n = 50
+	tr := NewTrie()
+	for i := 0; i < n; i++ {
+		tr.Add("from", objectID(i))
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				matches := tr.GetManyWithKeys("", 2*n)
+				if len(matches) != 1 || len(matches[0].IDs) != n {
+					t.Errorf("a reader saw a partially applied batch: %v", matches)
+					return
+				}
+			}
+		}()
+	}
+	from, to := "from", "to"
+	for round := 0; round < 200; round++ {
+		var batch Batch
+		for i := 0; i < n; i++ {
+			batch.Remove(from, objectID(i))
+			batch.Add(to, objectID(i))
+		}
+		if err := tr.Apply(batch); err != nil {
+			t.Fatal(err)
+		}
+		from, to = to, from
+	}
+	close(done)
+	wg.Wait()
+	expect(t, "ids at the original key", len(tr.Get("from")), n)
+}
@@ -0,0 +1,496 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+)
+
+// ErrNotSnapshot is returned when decoding binary data that does not start with the snapshot magic number
+var ErrNotSnapshot = errors.New("indexes: not a binary trie snapshot")
+
+// ErrTruncatedSnapshot is reported, wrapped in a CorruptSnapshotError, when binary snapshot data ends partway through
+var ErrTruncatedSnapshot = errors.New("indexes: binary trie snapshot is truncated")
+
+// ErrCorruptSnapshot matches every CorruptSnapshotError with errors.Is
+var ErrCorruptSnapshot = errors.New("indexes: binary trie snapshot is corrupt")
+
+// errSnapshotChecksum is the cause of a CorruptSnapshotError for a record whose bytes fail their checksum
+var errSnapshotChecksum = errors.New("indexes: binary trie snapshot record fails its checksum")
+
+// CorruptSnapshotError is returned when a binary snapshot fails to decode after its magic number and version.
+// Offset is where the header or key record that failed begins, counted from the start of the snapshot.
+type CorruptSnapshotError struct {
+	Offset int64
+	Err    error // why the record failed, such as ErrTruncatedSnapshot or a checksum mismatch
+}
+
+func (e *CorruptSnapshotError) Error() string {
+	return fmt.Sprintf("%v at byte %d", e.Err, e.Offset)
+}
+
+func (e *CorruptSnapshotError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrCorruptSnapshot
+func (e *CorruptSnapshotError) Is(target error) bool {
+	return target == ErrCorruptSnapshot
+}
+
+/*
+The binary snapshot format, written by MarshalBinary, is binaryMagic, a version byte, a byte naming the encoding of the
+values (see codecObjectID) and the number of keys as a uvarint, then the CRC-32 (IEEE) of those bytes, followed by one
+record per key in lexicographic order, each followed in turn by the CRC-32 of its bytes:
+
+	uvarint shared   bytes the key shares with the previous key
+	uvarint n, n bytes   the rest of the key
+	uvarint n, n bytes   the display form, empty if it is the stored form
+	uvarint count    ids stored at the key, each followed by its metadata:
+		value            12 bytes for ObjectIds, otherwise a uvarint n and n bytes
+		1 byte flags     which of the fields below are present
+		8 bytes          weight, as IEEE 754 bits, if pairWeight
+		8 bytes, time    hit count and when it was updated, if pairHits
+		uvarint n, n strings   fields, if pairFields
+		time             added-at time, if pairAdded
+		time             expiry, if pairExpires
+
+Floats are written little-endian, strings as a uvarint length followed by their bytes and times as a varint of their Unix
+seconds followed by a uvarint of their nanoseconds, and checksums as 4 bytes little-endian. Payloads stored by AddEntry
+are not encoded.
+*/
+const (
+	binaryMagic   = "GTRI"
+	binaryVersion = 1
+)
+
+// Flags marking the metadata present after an id in a binary snapshot
+const (
+	pairWeight = 1 << iota
+	pairHits
+	pairFields
+	pairAdded
+	pairExpires
+)
+
+// maxSnapshotString bounds the length a binary snapshot may claim for a key or field, so corrupt lengths fail
+// cleanly instead of exhausting memory
+const maxSnapshotString = 1 << 24
+
+// binaryEncoder writes the binary snapshot format to w, keeping the first write error
+type binaryEncoder[V comparable] struct {
+	w       io.Writer
+	codec   *valueCodec[V]
+	err     error
+	prev    string
+	sum     uint32 // CRC-32 of the bytes written since the last checksum
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *binaryEncoder[V]) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+		e.sum = crc32.Update(e.sum, crc32.IEEETable, b)
+	}
+}
+
+// checksum writes the CRC-32 of the bytes written since the previous checksum
+func (e *binaryEncoder[V]) checksum() {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], e.sum)
+	e.write(b[:])
+	e.sum = 0
+}
+
+func (e *binaryEncoder[V]) uvarint(v uint64) {
+	e.write(e.scratch[:binary.PutUvarint(e.scratch[:], v)])
+}
+
+func (e *binaryEncoder[V]) varint(v int64) {
+	e.write(e.scratch[:binary.PutVarint(e.scratch[:], v)])
+}
+
+func (e *binaryEncoder[V]) float(f float64) {
+	binary.LittleEndian.PutUint64(e.scratch[:8], math.Float64bits(f))
+	e.write(e.scratch[:8])
+}
+
+func (e *binaryEncoder[V]) str(s string) {
+	e.uvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *binaryEncoder[V]) stamp(t time.Time) {
+	e.varint(t.Unix())
+	e.uvarint(uint64(t.Nanosecond()))
+}
+
+// header writes the magic number, the version, the encoding of the values and the number of keys to follow
+func (e *binaryEncoder[V]) header(keys int) {
+	e.write([]byte(binaryMagic))
+	e.write([]byte{binaryVersion, e.codec.tag})
+	e.uvarint(uint64(keys))
+	e.checksum()
+}
+
+// key writes the record of one key, which must sort after the previous one
+func (e *binaryEncoder[V]) key(k snapshotKey[V]) error {
+	shared := 0
+	for shared < len(k.Key) && shared < len(e.prev) && k.Key[shared] == e.prev[shared] {
+		shared++
+	}
+	e.uvarint(uint64(shared))
+	e.str(k.Key[shared:])
+	e.str(k.Display)
+	e.uvarint(uint64(len(k.Pairs)))
+	for _, p := range k.Pairs {
+		if err := e.pair(p); err != nil {
+			return fmt.Errorf("indexes: key %q: %w", k.Key, err)
+		}
+	}
+	e.checksum()
+	e.prev = k.Key
+	return e.err
+}
+
+// value writes one value
+func (e *binaryEncoder[V]) value(v V) error {
+	b, err := e.codec.encode(v)
+	if err != nil {
+		return err
+	}
+	if e.codec.size == 0 {
+		e.uvarint(uint64(len(b)))
+	}
+	e.write(b)
+	return nil
+}
+
+// pair writes one id and its metadata
+func (e *binaryEncoder[V]) pair(p snapshotPair[V]) error {
+	if err := e.value(p.ID); err != nil {
+		return err
+	}
+	var flags byte
+	if p.Weight != 0 {
+		flags |= pairWeight
+	}
+	if p.Hits != 0 || !p.HitAt.IsZero() {
+		flags |= pairHits
+	}
+	if len(p.Fields) != 0 {
+		flags |= pairFields
+	}
+	if !p.AddedAt.IsZero() {
+		flags |= pairAdded
+	}
+	if !p.Expires.IsZero() {
+		flags |= pairExpires
+	}
+	e.write([]byte{flags})
+	if flags&pairWeight != 0 {
+		e.float(p.Weight)
+	}
+	if flags&pairHits != 0 {
+		e.float(p.Hits)
+		e.stamp(p.HitAt)
+	}
+	if flags&pairFields != 0 {
+		e.uvarint(uint64(len(p.Fields)))
+		for _, f := range p.Fields {
+			e.str(f)
+		}
+	}
+	if flags&pairAdded != 0 {
+		e.stamp(p.AddedAt)
+	}
+	if flags&pairExpires != 0 {
+		e.stamp(p.Expires)
+	}
+	return e.err
+}
+
+// snapshotReader is what binaryDecoder reads from, such as a *bytes.Reader or a *bufio.Reader
+type snapshotReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// sumReader passes reads through to r, counting the bytes read and keeping their running CRC-32
+type sumReader struct {
+	r   snapshotReader
+	off int64
+	sum uint32
+}
+
+func (s *sumReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.off += int64(n)
+	s.sum = crc32.Update(s.sum, crc32.IEEETable, p[:n])
+	return n, err
+}
+
+func (s *sumReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.off++
+		s.sum = crc32.Update(s.sum, crc32.IEEETable, []byte{b})
+	}
+	return b, err
+}
+
+// binaryDecoder reads the binary snapshot format from r, turning a premature end into ErrTruncatedSnapshot
+type binaryDecoder[V comparable] struct {
+	r     *sumReader
+	codec *valueCodec[V]
+	err   error
+	prev  []byte
+}
+
+// fail records err, turning an end of input into ErrTruncatedSnapshot, unless an error was already recorded
+func (d *binaryDecoder[V]) fail(err error) {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncatedSnapshot
+	}
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *binaryDecoder[V]) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.fail(err)
+		return nil
+	}
+	return b
+}
+
+func (d *binaryDecoder[V]) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+func (d *binaryDecoder[V]) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+func (d *binaryDecoder[V]) u8() byte {
+	if b := d.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *binaryDecoder[V]) float() float64 {
+	if b := d.read(8); b != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// checksum reads the CRC-32 ending a record, which must match the bytes read since the previous one
+func (d *binaryDecoder[V]) checksum() {
+	want := d.r.sum
+	if b := d.read(4); b != nil && binary.LittleEndian.Uint32(b) != want {
+		d.fail(errSnapshotChecksum)
+	}
+	d.r.sum = 0
+}
+
+// value reads one value
+func (d *binaryDecoder[V]) value() V {
+	size := d.codec.size
+	if size == 0 {
+		size = d.length(maxSnapshotString)
+	}
+	var v V
+	if b := d.read(size); d.err == nil {
+		var err error
+		if v, err = d.codec.decode(b); err != nil {
+			d.fail(err)
+		}
+	}
+	return v
+}
+
+// length reads a length that must not exceed max
+func (d *binaryDecoder[V]) length(max uint64) int {
+	n := d.uvarint()
+	if n > max {
+		d.fail(fmt.Errorf("indexes: binary trie snapshot claims a length of %d", n))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder[V]) str() string {
+	return string(d.read(d.length(maxSnapshotString)))
+}
+
+func (d *binaryDecoder[V]) stamp() time.Time {
+	sec := d.varint()
+	nsec := d.uvarint()
+	if nsec >= uint64(time.Second) {
+		d.fail(fmt.Errorf("indexes: binary trie snapshot holds an invalid time"))
+		return time.Time{}
+	}
+	return time.Unix(sec, int64(nsec))
+}
+
+// header reads the magic number, version and encoding of the values, returning the number of keys to follow. Errors
+// after the version are returned as a CorruptSnapshotError.
+func (d *binaryDecoder[V]) header() (int, error) {
+	// Data too short to hold the magic number is not a snapshot either
+	if magic := d.read(len(binaryMagic)); d.err == ErrTruncatedSnapshot || (d.err == nil && string(magic) != binaryMagic) {
+		return 0, ErrNotSnapshot
+	}
+	if version := d.u8(); d.err == nil && version != binaryVersion {
+		return 0, fmt.Errorf("indexes: unsupported binary trie snapshot version %d", version)
+	}
+	if tag := d.u8(); d.err == nil && tag != d.codec.tag {
+		return 0, fmt.Errorf("indexes: binary trie snapshot holds values of encoding %d, not %d", tag, d.codec.tag)
+	}
+	keys := d.length(math.MaxInt32)
+	d.checksum()
+	if d.err != nil {
+		return 0, &CorruptSnapshotError{Offset: 0, Err: d.err}
+	}
+	return keys, nil
+}
+
+// pair reads one id and its metadata
+func (d *binaryDecoder[V]) pair() snapshotPair[V] {
+	p := snapshotPair[V]{ID: d.value()}
+	flags := d.u8()
+	if flags&pairWeight != 0 {
+		p.Weight = d.float()
+	}
+	if flags&pairHits != 0 {
+		p.Hits = d.float()
+		p.HitAt = d.stamp()
+	}
+	if flags&pairFields != 0 {
+		n := d.length(maxSnapshotString)
+		for j := 0; j < n && d.err == nil; j++ {
+			p.Fields = append(p.Fields, d.str())
+		}
+	}
+	if flags&pairAdded != 0 {
+		p.AddedAt = d.stamp()
+	}
+	if flags&pairExpires != 0 {
+		p.Expires = d.stamp()
+	}
+	return p
+}
+
+// key reads the record of one key
+func (d *binaryDecoder[V]) key() (snapshotKey[V], error) {
+	var k snapshotKey[V]
+	shared := d.length(uint64(len(d.prev)))
+	rest := d.read(d.length(maxSnapshotString))
+	key := append(d.prev[:shared:shared], rest...)
+	k.Key = string(key)
+	k.Display = d.str()
+	count := d.length(math.MaxInt32)
+	for i := 0; i < count && d.err == nil; i++ {
+		k.Pairs = append(k.Pairs, d.pair())
+	}
+	d.checksum()
+	if d.err == nil && len(d.prev) != 0 && bytes.Compare(key, d.prev) <= 0 {
+		d.fail(fmt.Errorf("indexes: binary trie snapshot keys are out of order at %q", k.Key))
+	}
+	d.prev = key
+	return k, d.err
+}
+
+/*
+MarshalBinary encodes the Trie in a compact binary snapshot format: a magic number and format version, then every key
+in sorted order, sharing the bytes it has in common with the previous key, with its ids as raw 12-byte ObjectIds and
+their metadata, and a checksum after the header and after every key. Payloads stored by AddEntry are not included; use EncodeGob to keep them. The Trie is read under the
+read lock. Ids that are not 12 bytes long cannot be encoded and fail with ErrInvalidObjectID. Values other than
+ObjectIds are written as their bytes if they are strings and as JSON otherwise. The ObjectIds of a Trie and of a
+PrimitiveTrie are written identically, so either can load the other's snapshots.
+*/
+func (t *GenericTrie[V]) MarshalBinary() ([]byte, error) {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	var buf bytes.Buffer
+	e := &binaryEncoder[V]{w: &buf, codec: codecOf[V]()}
+	e.header(t.keys)
+	if err := t.snapshot(e.key); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+UnmarshalBinary replaces the contents of the Trie with a snapshot written by MarshalBinary. Keys are restored in their
+stored form, so the Trie should have the options of the one that was encoded; a zero Trie may be unmarshaled into.
+Data that is not a snapshot fails with ErrNotSnapshot and an unknown version with a descriptive error. A snapshot cut
+short, failing a checksum or otherwise malformed fails with a CorruptSnapshotError, matching ErrCorruptSnapshot, and
+leaves the Trie unchanged, unless it has WithPartialLoad, in which case the keys before the failed record are installed.
+*/
+func (t *GenericTrie[V]) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	fresh, err := decodeBinary[V](r, t.cfg)
+	if err == nil && r.Len() != 0 {
+		return fmt.Errorf("indexes: %d bytes of trailing data after binary trie snapshot", r.Len())
+	}
+	if fresh == nil {
+		return err
+	}
+	t.replace(fresh)
+	return err
+}
+
+/*
+decodeBinary builds a Trie with configuration cfg from the binary snapshot read from r, as the records arrive. A
+record that fails to decode or restore fails with a CorruptSnapshotError; with cfg.partialLoad the Trie built from the
+records before it is returned along with the error.
+*/
+func decodeBinary[V comparable](r snapshotReader, cfg config) (*GenericTrie[V], error) {
+	d := &binaryDecoder[V]{r: &sumReader{r: r}, codec: codecOf[V]()}
+	keys, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	t := newTrie[V](cfg)
+	for i := 0; i < keys; i++ {
+		start := d.r.off
+		k, err := d.key()
+		if err == nil {
+			err = t.restore(k)
+		}
+		if err != nil {
+			err = &CorruptSnapshotError{Offset: start, Err: err}
+			if cfg.partialLoad {
+				return t, err
+			}
+			return nil, err
+		}
+	}
+	return t, nil
+}
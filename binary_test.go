@@ -0,0 +1,208 @@
+package indexes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+)
+
+// snapshotFixture returns a Trie of n keys with metadata, and its binary snapshot
+func snapshotFixture(t testing.TB, n int) (*Trie, []byte) {
+	t.Helper()
+	tr := NewTrie()
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("Key %05d", i)
+		tr.AddWeighted(key, objectID(i), float64(i))
+		tr.AddTagged(key, objectID(i+1), "field")
+	}
+	data, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr, data
+}
+
+func TestSnapshotNotSnapshot(t *testing.T) {
+	_, data := snapshotFixture(t, 1)
+	for _, input := range [][]byte{nil, {}, data[:1], data[:len(binaryMagic)-1], []byte("JSON{}"), []byte("gtri")} {
+		if err := NewTrie().UnmarshalBinary(input); err != ErrNotSnapshot {
+			t.Errorf("UnmarshalBinary(%q) = %v, want ErrNotSnapshot", input, err)
+		}
+		if _, err := Load(bytes.NewReader(input), WithPartialLoad()); err != ErrNotSnapshot {
+			t.Errorf("Load(%q) = %v, want ErrNotSnapshot", input, err)
+		}
+	}
+}
+
+// TestSnapshotCorrupt flips a byte at every offset past the magic number and checks that the damage is detected at or
+// before it, and that WithPartialLoad keeps only intact keys
+func TestSnapshotCorrupt(t *testing.T) {
+	tr, data := snapshotFixture(t, 40)
+	want := tr.ToMap()
+	for off := len(binaryMagic); off < len(data); off++ {
+		bad := append([]byte(nil), data...)
+		bad[off] ^= 0x10
+		_, err := Load(bytes.NewReader(bad))
+		var ce *CorruptSnapshotError
+		if off < len(binaryMagic)+2 {
+			// The version and encoding bytes, where damage reads as an unsupported version or encoding
+			if err == nil {
+				t.Fatalf("flipping offset %d went undetected", off)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrCorruptSnapshot) || !errors.As(err, &ce) {
+			t.Fatalf("flipping offset %d: Load = %v, want a CorruptSnapshotError", off, err)
+		}
+		if ce.Offset > int64(off) {
+			t.Fatalf("flipping offset %d was reported at offset %d, after it", off, ce.Offset)
+		}
+		if err := NewTrie().UnmarshalBinary(bad); !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("flipping offset %d: UnmarshalBinary = %v, want ErrCorruptSnapshot", off, err)
+		}
+		partial, err := Load(bytes.NewReader(bad), WithPartialLoad())
+		if !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("flipping offset %d: partial Load = %v, want ErrCorruptSnapshot", off, err)
+		}
+		if partial == nil {
+			continue
+		}
+		for key, ids := range partial.ToMap() {
+			expect(t, fmt.Sprintf("key %q partially loaded after flipping offset %d", key, off), ids, want[key])
+		}
+	}
+}
+
+func TestSnapshotTruncated(t *testing.T) {
+	tr, data := snapshotFixture(t, 20)
+	for n := len(binaryMagic); n < len(data); n++ {
+		_, err := Load(bytes.NewReader(data[:n]))
+		if !errors.Is(err, ErrTruncatedSnapshot) || !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("cut at %d bytes: Load = %v, want ErrTruncatedSnapshot", n, err)
+		}
+	}
+	partial := NewTrie(WithPartialLoad())
+	if err := partial.UnmarshalBinary(data[:len(data)/2]); !errors.Is(err, ErrTruncatedSnapshot) {
+		t.Fatalf("UnmarshalBinary of half a snapshot = %v, want ErrTruncatedSnapshot", err)
+	}
+	if got := partial.KeyCount(); got == 0 || got >= tr.KeyCount() {
+		t.Fatalf("partial load kept %d of %d keys", got, tr.KeyCount())
+	}
+}
+
+// BenchmarkUnmarshalBinary measures decoding a snapshot, checksums included
+func BenchmarkUnmarshalBinary(b *testing.B) {
+	_, data := snapshotFixture(b, 10000)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := NewTrie().UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSnapshotChecksum measures the CRC-32 of a snapshot's bytes alone, the cost the checksums add to
+// BenchmarkUnmarshalBinary
+func BenchmarkSnapshotChecksum(b *testing.B) {
+	_, data := snapshotFixture(b, 10000)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		crc32.ChecksumIEEE(data)
+	}
+}
+
+func TestSnapshotUnknownVersion(t *testing.T) {
+	_, data := snapshotFixture(t, 3)
+	bad := append([]byte(nil), data...)
+	bad[len(binaryMagic)] = 0xff
+	err := NewTrie().UnmarshalBinary(bad)
+	if err == nil || errors.Is(err, ErrCorruptSnapshot) || errors.Is(err, ErrNotSnapshot) {
+		t.Fatalf("UnmarshalBinary of an unknown version = %v, want an unsupported version error", err)
+	}
+}
+
+// TestSnapshotRandomCorruption damages snapshots at random, several bytes at a time, and by inserting and deleting
+// bytes, expecting errors but never a panic or a Trie holding pairs that were not in the snapshot
+func TestSnapshotRandomCorruption(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr, data := snapshotFixture(t, 30)
+	want := tr.ToMap()
+	for i := 0; i < 3000; i++ {
+		bad := append([]byte(nil), data...)
+		switch rng.Intn(3) {
+		case 0:
+			for j := 0; j < 1+rng.Intn(4); j++ {
+				bad[rng.Intn(len(bad))] = byte(rng.Intn(256))
+			}
+		case 1:
+			off := rng.Intn(len(bad))
+			bad = append(bad[:off], append([]byte{byte(rng.Intn(256))}, bad[off:]...)...)
+		default:
+			off := rng.Intn(len(bad))
+			bad = append(bad[:off], bad[off+1+rng.Intn(len(bad)-off):]...)
+		}
+		partial := NewTrie(WithPartialLoad())
+		if err := partial.UnmarshalBinary(bad); err == nil && !bytes.Equal(bad, data) {
+			t.Fatalf("damaged snapshot %d decoded without error", i)
+		}
+		for key, ids := range partial.ToMap() {
+			expect(t, fmt.Sprintf("key %q kept from damaged snapshot %d", key, i), ids, want[key])
+		}
+	}
+}
+
+// FuzzUnmarshalBinary checks that no input makes UnmarshalBinary panic and that whatever decodes encodes back to a
+// snapshot that decodes to the same Trie
+func FuzzUnmarshalBinary(f *testing.F) {
+	_, data := snapshotFixture(f, 3)
+	f.Add(data)
+	f.Add(data[:len(data)/2])
+	f.Add([]byte(binaryMagic))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tr := NewTrie()
+		if err := tr.UnmarshalBinary(data); err != nil {
+			return
+		}
+		again := marshalBinary(t, tr)
+		if !bytes.Equal(marshalBinary(t, decodeState(t, again)), again) {
+			t.Fatal("decoded snapshot does not round trip")
+		}
+	})
+}
+
+// TestSnapshotSmallerThanGob checks that the binary format is the more compact of the two
+func TestSnapshotSmallerThanGob(t *testing.T) {
+	tr, data := snapshotFixture(t, 1000)
+	if gobSize := len(encodeGob(t, tr)); len(data) >= gobSize {
+		t.Fatalf("binary snapshot of %d bytes, gob encoding of %d", len(data), gobSize)
+	}
+}
+
+// BenchmarkMarshalBinary measures encoding and decoding the 1M-key Trie of BenchmarkGob as a binary snapshot, for
+// comparing their times and sizes
+func BenchmarkMarshalBinary(b *testing.B) {
+	tr := largeTrie(b, 1000000)
+	data, err := tr.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("encode", func(b *testing.B) {
+		b.ReportMetric(float64(len(data)), "bytes")
+		for i := 0; i < b.N; i++ {
+			tr.MarshalBinary()
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		b.ReportMetric(float64(len(data)), "bytes")
+		for i := 0; i < b.N; i++ {
+			if err := NewTrie().UnmarshalBinary(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
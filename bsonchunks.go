@@ -0,0 +1,243 @@
+package indexes
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// bsonChunkVersion is stored in every document written by ToBSONChunks, under "v"
+const bsonChunkVersion = 1
+
+// MaxBSONDocBytes is the largest document MongoDB stores, the natural maxDocBytes for ToBSONChunks
+const MaxBSONDocBytes = 16 << 20
+
+/*
+ToBSONChunks splits the Trie into documents of at most maxDocBytes encoded bytes each, for storing a snapshot in a
+MongoDB collection, one document per chunk, and rebuilding it with FromBSONChunks. Every chunk has the form
+
+	{v: 1, n: <chunk number>, keys: [{k: <stored key>, d: <display form, if any>, ids: [ObjectId, ...]}, ...]}
+
+with the keys in sorted order. ObjectIds of either driver are stored as BSON ObjectIds, strings as strings and values of
+other types as their JSON text. A key's ids go in one entry unless they alone would overflow a chunk, in which case they
+are split over entries for the same key at the end of one chunk and the start of the next, which FromBSONChunks merges
+again; nothing else is ever split. Like MarshalJSON only keys, display forms and ids are kept, not per-pair metadata.
+A maxDocBytes too small for a chunk holding a single id is raised to fit one. The chunks are built under the read lock.
+*/
+func (t *GenericTrie[V]) ToBSONChunks(maxDocBytes int) []bson.D {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	var chunks []bson.D
+	var keys []bson.D
+	size := 0
+	flush := func() {
+		chunks = append(chunks, bson.D{
+			{Name: "v", Value: bsonChunkVersion},
+			{Name: "n", Value: len(chunks)},
+			{Name: "keys", Value: keys},
+		})
+		keys, size = nil, 0
+	}
+	codec := codecOf[V]()
+	t.snapshot(func(k snapshotKey[V]) error {
+		ids := make([]interface{}, len(k.Pairs))
+		for i, p := range k.Pairs {
+			ids[i] = bsonValue(codec, p.ID)
+		}
+		for len(ids) > 0 {
+			if size == 0 {
+				size = bsonSize(bson.D{{Name: "v", Value: 0}, {Name: "n", Value: len(chunks)}, {Name: "keys", Value: []bson.D{}}})
+			}
+			entry := bson.D{{Name: "k", Value: k.Key}}
+			if k.Display != "" {
+				entry = append(entry, bson.DocElem{Name: "d", Value: k.Display})
+			}
+			// An array element costs its type byte, its index as a name and its value
+			name := len(strconv.Itoa(len(keys))) + 2
+			fit := fitIDs(maxDocBytes-size-name, entry, ids)
+			if fit == 0 {
+				if len(keys) != 0 {
+					flush()
+					continue
+				}
+				// Not even one id fits in an empty chunk, so the chunk grows to hold one
+				fit = 1
+			}
+			entry = append(entry, bson.DocElem{Name: "ids", Value: ids[:fit]})
+			keys = append(keys, entry)
+			size += name + bsonSize(entry)
+			ids = ids[fit:]
+			if len(ids) > 0 {
+				flush()
+			}
+		}
+		return nil
+	})
+	if len(keys) != 0 || len(chunks) == 0 {
+		flush()
+	}
+	return chunks
+}
+
+// bsonValue returns v in the form ToBSONChunks stores it in
+func bsonValue[V comparable](codec *valueCodec[V], v V) interface{} {
+	switch codec.tag {
+	case codecObjectID:
+		b, _ := codec.encode(v)
+		return bson.ObjectId(b)
+	case codecString:
+		return codec.format(v)
+	}
+	b, _ := codec.encode(v)
+	return string(b)
+}
+
+// fromBSONValue converts a value stored by ToBSONChunks back
+func fromBSONValue[V comparable](codec *valueCodec[V], x interface{}) (V, error) {
+	if codec.tag == codecObjectID {
+		if id, ok := x.(bson.ObjectId); ok {
+			return codec.decode([]byte(id))
+		}
+		var zero V
+		return zero, ErrInvalidObjectID
+	}
+	if s, ok := x.(string); ok {
+		return codec.parse(s)
+	}
+	var zero V
+	return zero, fmt.Errorf("value %v is not a string", x)
+}
+
+// fitIDs returns how many of ids can go in entry without its encoding exceeding room bytes
+func fitIDs(room int, entry bson.D, ids []interface{}) int {
+	// The entry with an empty ids array, then each id adds its type byte, index name and value
+	used := bsonSize(append(entry[:len(entry):len(entry)], bson.DocElem{Name: "ids", Value: []interface{}{}}))
+	fit := 0
+	for fit < len(ids) {
+		used += len(strconv.Itoa(fit)) + 2 + bsonSize(ids[fit])
+		if used > room {
+			break
+		}
+		fit++
+	}
+	return fit
+}
+
+// bsonSize returns the number of bytes v takes when encoded as a BSON value, for the value types ToBSONChunks writes
+func bsonSize(v interface{}) int {
+	switch v := v.(type) {
+	case bson.ObjectId:
+		return 12
+	case string:
+		return 4 + len(v) + 1
+	case int:
+		return 4
+	case bson.D:
+		size := 4 + 1
+		for _, e := range v {
+			size += 1 + len(e.Name) + 1 + bsonSize(e.Value)
+		}
+		return size
+	case []bson.D:
+		size := 4 + 1
+		for i, d := range v {
+			size += 1 + len(strconv.Itoa(i)) + 1 + bsonSize(d)
+		}
+		return size
+	case []interface{}:
+		size := 4 + 1
+		for i, e := range v {
+			size += 1 + len(strconv.Itoa(i)) + 1 + bsonSize(e)
+		}
+		return size
+	}
+	panic(fmt.Sprintf("indexes: bsonSize of %T", v))
+}
+
+/*
+FromBSONChunks rebuilds a Trie from the documents written by ToBSONChunks, in any order, merging the ids of a key
+split over several entries. It accepts the documents as ToBSONChunks returns them and as mgo decodes them, with
+embedded documents as bson.M or bson.D and arrays as []interface{}. It must be given the options of the Trie that was
+chunked, since keys are restored in their stored form. Malformed documents fail with an error naming the chunk.
+*/
+func FromBSONChunks(chunks []bson.D, opts ...Option) (*Trie, error) {
+	return FromBSONChunksGeneric[bson.ObjectId](chunks, opts...)
+}
+
+// FromBSONChunksGeneric is FromBSONChunks for a GenericTrie, such as a StringTrie
+func FromBSONChunksGeneric[V comparable](chunks []bson.D, opts ...Option) (*GenericTrie[V], error) {
+	t := newTrie[V](newConfig(opts))
+	for i, chunk := range chunks {
+		if err := t.restoreBSONChunk(chunk); err != nil {
+			return nil, fmt.Errorf("indexes: bson chunk %d: %w", i, err)
+		}
+	}
+	t.startWAL()
+	return t, nil
+}
+
+// restoreBSONChunk adds the keys of one chunk written by ToBSONChunks. The caller must own t exclusively.
+func (t *GenericTrie[V]) restoreBSONChunk(chunk bson.D) error {
+	codec := codecOf[V]()
+	m := chunk.Map()
+	if v, ok := m["v"].(int); !ok || v != bsonChunkVersion {
+		return fmt.Errorf("unsupported chunk version %v", m["v"])
+	}
+	keys, ok := bsonArray(m["keys"])
+	if !ok {
+		return fmt.Errorf("keys is not an array")
+	}
+	for _, entry := range keys {
+		e, ok := bsonMap(entry)
+		if !ok {
+			return fmt.Errorf("key entry is not a document")
+		}
+		key, _ := e["k"].(string)
+		display, _ := e["d"].(string)
+		ids, ok := bsonArray(e["ids"])
+		if !ok {
+			return fmt.Errorf("key %q: ids is not an array", key)
+		}
+		k := snapshotKey[V]{Key: key, Display: display, Pairs: make([]snapshotPair[V], len(ids))}
+		for j, id := range ids {
+			v, err := fromBSONValue(codec, id)
+			if err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+			k.Pairs[j] = snapshotPair[V]{ID: v, AddedAt: t.now()}
+		}
+		if err := t.restore(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bsonMap returns the document v, as ToBSONChunks writes it or as mgo decodes it, as a map
+func bsonMap(v interface{}) (bson.M, bool) {
+	switch v := v.(type) {
+	case bson.D:
+		return v.Map(), true
+	case bson.M:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	}
+	return nil, false
+}
+
+// bsonArray returns the array v, as ToBSONChunks writes it or as mgo decodes it, as a slice
+func bsonArray(v interface{}) ([]interface{}, bool) {
+	switch v := v.(type) {
+	case []interface{}:
+		return v, true
+	case []bson.D:
+		res := make([]interface{}, len(v))
+		for i, d := range v {
+			res[i] = d
+		}
+		return res, true
+	}
+	return nil, false
+}
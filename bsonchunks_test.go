@@ -0,0 +1,130 @@
+package indexes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// chunkFixture returns a Trie with display forms, the empty key and a key holding too many ids for a small chunk
+func chunkFixture() *Trie {
+	tr := NewTrie()
+	for i := 0; i < 300; i++ {
+		tr.Add(fmt.Sprintf("User %03d", i), objectID(i))
+	}
+	for i := 0; i < 200; i++ {
+		tr.Add("common", objectID(i))
+	}
+	tr.Add("", objectID(1))
+	tr.Add("Ada Lovelace", objectID(7))
+	return tr
+}
+
+// chunkKeys returns the entries of a chunk as ToBSONChunks writes them
+func chunkKeys(t *testing.T, chunk bson.D) []bson.D {
+	t.Helper()
+	keys, ok := chunk.Map()["keys"].([]bson.D)
+	if !ok {
+		t.Fatalf("chunk %v has no keys", chunk.Map()["n"])
+	}
+	return keys
+}
+
+// TestBSONChunksSize checks at small sizes that every chunk encodes within maxDocBytes unless it holds a single id,
+// that chunks are numbered in order and that only a key's last entry in one chunk continues into the next
+func TestBSONChunksSize(t *testing.T) {
+	tr := chunkFixture()
+	for _, maxDocBytes := range []int{0, 40, 64, 100, 150, 512, 4 << 10, 64 << 10, MaxBSONDocBytes} {
+		chunks := tr.ToBSONChunks(maxDocBytes)
+		prev, started := "", false
+		for i, chunk := range chunks {
+			data, err := bson.Marshal(chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != bsonSize(chunk) {
+				t.Fatalf("chunk %d of %d bytes encodes to %d bytes, bsonSize says %d", i, maxDocBytes, len(data), bsonSize(chunk))
+			}
+			keys := chunkKeys(t, chunk)
+			single := len(keys) == 1 && len(keys[0].Map()["ids"].([]interface{})) == 1
+			if len(data) > maxDocBytes && !single {
+				t.Fatalf("chunk %d of %d bytes encodes to %d bytes", i, maxDocBytes, len(data))
+			}
+			expect(t, fmt.Sprintf("number of chunk %d of %d bytes", i, maxDocBytes), chunk.Map()["n"], i)
+			for j, entry := range keys {
+				key := entry.Map()["k"].(string)
+				if started && (key < prev || key == prev && j != 0) {
+					t.Fatalf("chunk %d of %d bytes: key %q after %q", i, maxDocBytes, key, prev)
+				}
+				prev, started = key, true
+			}
+		}
+		if maxDocBytes >= 64<<10 && len(chunks) != 1 {
+			t.Fatalf("%d chunks of %d bytes, want 1", len(chunks), maxDocBytes)
+		}
+	}
+	expect(t, "chunks of an empty Trie", len(NewTrie().ToBSONChunks(100)), 1)
+}
+
+// TestBSONChunksRoundTrip rebuilds Tries from their chunks, shuffled and as mgo decodes them, and compares them with the
+// Tries that were chunked
+func TestBSONChunksRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr := chunkFixture()
+	want := tr.ToMap()
+	for _, maxDocBytes := range []int{0, 64, 150, 1 << 10, MaxBSONDocBytes} {
+		chunks := tr.ToBSONChunks(maxDocBytes)
+		rng.Shuffle(len(chunks), func(i, j int) { chunks[i], chunks[j] = chunks[j], chunks[i] })
+		decoded := make([]bson.D, len(chunks))
+		for i, chunk := range chunks {
+			data, err := bson.Marshal(chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := bson.Unmarshal(data, &decoded[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for name, chunks := range map[string][]bson.D{"written": chunks, "decoded": decoded} {
+			got, err := FromBSONChunks(chunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect(t, fmt.Sprintf("ToMap of %s chunks of %d bytes", name, maxDocBytes), got.ToMap(), want)
+			expect(t, fmt.Sprintf("Keys of %s chunks of %d bytes", name, maxDocBytes), got.Keys("", 1000), tr.Keys("", 1000))
+			expect(t, fmt.Sprintf("GetMany of %s chunks of %d bytes", name, maxDocBytes), got.GetMany("", 1000), tr.GetMany("", 1000))
+		}
+	}
+
+	strs := NewStringTrie()
+	strs.Add("Key", "a")
+	strs.Add("key", "b")
+	strs.Add("other", "")
+	got, err := FromBSONChunksGeneric[string](strs.ToBSONChunks(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "ToMap of a StringTrie", got.ToMap(), strs.ToMap())
+	expect(t, "Keys of a StringTrie", got.Keys("", 10), strs.Keys("", 10))
+}
+
+func TestBSONChunksMalformed(t *testing.T) {
+	valid := NewTrie().ToBSONChunks(0)[0]
+	for _, c := range []struct {
+		name  string
+		chunk bson.D
+	}{
+		{"a missing version", bson.D{{Name: "keys", Value: []bson.D{}}}},
+		{"a later version", bson.D{{Name: "v", Value: bsonChunkVersion + 1}, {Name: "keys", Value: []bson.D{}}}},
+		{"keys that are not an array", bson.D{{Name: "v", Value: bsonChunkVersion}, {Name: "keys", Value: "x"}}},
+		{"an entry that is not a document", bson.D{{Name: "v", Value: bsonChunkVersion}, {Name: "keys", Value: []interface{}{1}}}},
+		{"ids that are not an array", bson.D{{Name: "v", Value: bsonChunkVersion}, {Name: "keys", Value: []interface{}{bson.M{"k": "a"}}}}},
+		{"an id that is not an ObjectId", bson.D{{Name: "v", Value: bsonChunkVersion}, {Name: "keys", Value: []interface{}{bson.M{"k": "a", "ids": []interface{}{"x"}}}}}},
+	} {
+		if _, err := FromBSONChunks([]bson.D{valid, c.chunk}); err == nil {
+			t.Fatalf("FromBSONChunks of %s succeeded", c.name)
+		}
+	}
+}
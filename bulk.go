@@ -0,0 +1,140 @@
+package indexes
+
+import (
+	"context"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+BuildTrie bulk loads a new Trie from entries using a pool of workers. Entries are normalized and sharded by the first
+rune of their key across worker-local tries, which need no locking, and once the channel is closed the shards are merged
+into one Trie by installing their disjoint root links. The result is identical to adding every entry in turn with Add,
+including skipping duplicates and empty keys. The options configure the returned Trie.
+*/
+func BuildTrie[V comparable](entries <-chan GenericKeyID[V], workers int, opts ...Option) *GenericTrie[V] {
+	if workers < 1 {
+		workers = 1
+	}
+	t := newTrie[V](newConfig(opts))
+	// entry carries a normalized key along with the form it was given in
+	type entry struct {
+		GenericKeyID[V]
+		original string
+	}
+	// The shards keep the options that shape the nodes, such as WithClock and WithRefreshAddedAt, but skip the log and
+	// the auxiliary indexes, which are built once over the merged Trie
+	shardCfg := t.cfg
+	shardCfg.reverseIndex, shardCfg.infixIndex, shardCfg.suffixIndex, shardCfg.queryStats = false, false, false, 0
+	shardCfg.wal = nil
+	shards := make([]*GenericTrie[V], workers)
+	inputs := make([]chan entry, workers)
+	var wg sync.WaitGroup
+	for i := range shards {
+		shards[i] = newTrie[V](shardCfg)
+		inputs[i] = make(chan entry, 1024)
+		wg.Add(1)
+		go func(shard *GenericTrie[V], in <-chan entry) {
+			defer wg.Done()
+			// The shard is owned by this goroutine until the merge, so it is filled without taking its lock
+			for e := range in {
+				shard.insert(e.Key, e.original, e.ID)
+			}
+		}(shards[i], inputs[i])
+	}
+	for e := range entries {
+		key, err := t.storedKey(e.Key)
+		if err != nil {
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(key)
+		inputs[int(r)%workers] <- entry{GenericKeyID[V]{Key: key, ID: e.ID}, e.Key}
+	}
+	for _, in := range inputs {
+		close(in)
+	}
+	wg.Wait()
+
+	for _, shard := range shards {
+		for r, link := range shard.root.link {
+			t.root.PutLink(r, link)
+		}
+		// Keep the generation ahead of those stamped on the shard's nodes
+		if shard.gen > t.gen {
+			t.gen = shard.gen
+		}
+	}
+	t.rebuildAux()
+	t.startWAL()
+	return t
+}
+
+// NewTrieFromMap builds a Trie from a map of keys to ids in one pass without per-entry locking.
+// Keys are normalized as Add would normalize them, ids are deduplicated per key, and empty keys are skipped.
+func NewTrieFromMap[V comparable](m map[string][]V, opts ...Option) *GenericTrie[V] {
+	t := newTrie[V](newConfig(opts))
+	for key, ids := range m {
+		stored, err := t.storedKey(key)
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			t.insert(stored, key, id)
+		}
+	}
+	t.startWAL()
+	return t
+}
+
+// ToMap returns every stored key, in its normalized form, mapped to a copy of its ids, leaving out expired pairs. With
+// WithBinaryKeys the keys are the bytes they were added as. It is the inverse of NewTrieFromMap.
+func (t *GenericTrie[V]) ToMap() map[string][]V {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	m := make(map[string][]V, t.keys)
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		if ids := node.liveVals(now); len(ids) != 0 {
+			m[t.cfg.givenKey(string(key))] = ids
+		}
+		return true
+	})
+	return m
+}
+
+// rebuildProgressEvery is the number of entries Rebuild adds between calls to its progress callback
+const rebuildProgressEvery = 10000
+
+/*
+Rebuild repopulates the Trie from the entries produced by src. The entries are added to a fresh Trie off to the side,
+which is installed under a brief write lock only once src has yielded everything, so queries keep being answered from
+the old contents for the whole rebuild. progress, if not nil, is called every 10000 entries and once more at the end
+with the number of entries processed. If ctx is cancelled before src finishes, Rebuild stops asking src for entries,
+leaves the Trie untouched and returns ctx.Err().
+*/
+func (t *GenericTrie[V]) Rebuild(ctx context.Context, src func(yield func(GenericKeyID[V]) bool), progress func(done int)) error {
+	fresh := newTrie[V](t.cfg)
+	done := 0
+	var err error
+	src(func(e GenericKeyID[V]) bool {
+		if err = ctx.Err(); err != nil {
+			return false
+		}
+		if key, err := fresh.storedKey(e.Key); err == nil {
+			fresh.insert(key, e.Key, e.ID)
+		}
+		done++
+		if progress != nil && done%rebuildProgressEvery == 0 {
+			progress(done)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(done)
+	}
+	t.replace(fresh)
+	return nil
+}
@@ -0,0 +1,133 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// bulkEntries returns n entries with keys spread over many first runes, so BuildTrie can shard them
+func bulkEntries(n int) []KeyID {
+	rng := rand.New(rand.NewSource(1))
+	entries := make([]KeyID, n)
+	for i := range entries {
+		entries[i] = KeyID{Key: fmt.Sprintf("%c%x", 'a'+rng.Intn(26), rng.Int63()), ID: objectID(rng.Intn(n))}
+	}
+	return entries
+}
+
+// feed sends entries on a new channel, closing it once they have all been received
+func feed(entries []KeyID) <-chan KeyID {
+	ch := make(chan KeyID, 1024)
+	go func() {
+		for _, e := range entries {
+			ch <- e
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// TestBuildTrie checks that BuildTrie leaves the Trie exactly as adding every entry in turn would, with the options
+// that affect what is stored at each node
+func TestBuildTrie(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	opts := []Option{WithClock(func() time.Time { return now }), WithRefreshAddedAt(), WithReverseIndex(), WithSuffixIndex()}
+	entries := append(bulkEntries(2000), KeyID{Key: "", ID: objectID(1)}, KeyID{Key: "Ada", ID: objectID(1)})
+	entries = append(entries, entries[:100]...)
+	want := NewTrie(opts...)
+	for _, e := range entries {
+		want.Add(e.Key, e.ID)
+	}
+	for _, workers := range []int{0, 1, 4, 8} {
+		got := BuildTrie(feed(entries), workers, opts...)
+		if !bytes.Equal(marshalBinary(t, got), marshalBinary(t, want)) {
+			t.Fatalf("BuildTrie with %d workers differs from adding each entry", workers)
+		}
+		expect(t, fmt.Sprintf("KeyCount with %d workers", workers), got.KeyCount(), want.KeyCount())
+		expect(t, fmt.Sprintf("GetBySuffix with %d workers", workers), got.GetBySuffix("a", 50), want.GetBySuffix("a", 50))
+		expect(t, fmt.Sprintf("RemoveID with %d workers", workers), got.RemoveID(objectID(1)), want.Clone().RemoveID(objectID(1)))
+	}
+}
+
+// BenchmarkBuildTrie compares BuildTrie with 1, 4 and 8 workers, the speedup being the ratio of their times
+func BenchmarkBuildTrie(b *testing.B) {
+	entries := bulkEntries(100000)
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				BuildTrie(feed(entries), workers)
+			}
+		})
+	}
+}
+
+// TestRebuildProgress checks that progress is called every rebuildProgressEvery entries and once at the end, and that
+// queries are answered from the old contents until the rebuild is installed
+func TestRebuildProgress(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("old", objectID(1))
+	for _, c := range []struct {
+		entries int
+		want    []int
+	}{
+		{0, []int{0}},
+		{25000, []int{10000, 20000, 25000}},
+		{20000, []int{10000, 20000, 20000}},
+	} {
+		var calls []int
+		err := tr.Rebuild(context.Background(), func(yield func(KeyID) bool) {
+			for i := 0; i < c.entries; i++ {
+				if i == c.entries/2 {
+					expect(t, "contents during Rebuild", tr.Get("old"), []bson.ObjectId{objectID(1)})
+				}
+				if !yield(KeyID{Key: fmt.Sprintf("key %d", i), ID: objectID(i)}) {
+					return
+				}
+			}
+		}, func(done int) { calls = append(calls, done) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(t, fmt.Sprintf("progress of %d entries", c.entries), calls, c.want)
+		expect(t, fmt.Sprintf("KeyCount after rebuilding from %d entries", c.entries), tr.KeyCount(), c.entries)
+		tr.Add("old", objectID(1))
+	}
+}
+
+// TestRebuildCancel checks that cancelling partway through stops src and leaves the Trie exactly as it was
+func TestRebuildCancel(t *testing.T) {
+	tr := NewTrie(WithReverseIndex())
+	for _, e := range bulkEntries(1000) {
+		tr.Add(e.Key, e.ID)
+	}
+	before := marshalBinary(t, tr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls []int
+	yielded := 0
+	err := tr.Rebuild(ctx, func(yield func(KeyID) bool) {
+		for i := 0; i < 50000; i++ {
+			if i == 12000 {
+				cancel()
+			}
+			if !yield(KeyID{Key: fmt.Sprintf("key %d", i), ID: objectID(i)}) {
+				return
+			}
+			yielded++
+		}
+	}, func(done int) { calls = append(calls, done) })
+	if err != context.Canceled {
+		t.Fatalf("Rebuild = %v, want context.Canceled", err)
+	}
+	expect(t, "entries accepted before the cancellation", yielded, 12000)
+	expect(t, "progress before the cancellation", calls, []int{10000})
+	if !bytes.Equal(marshalBinary(t, tr), before) {
+		t.Fatal("a cancelled Rebuild changed the Trie")
+	}
+}
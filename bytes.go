@@ -0,0 +1,32 @@
+package indexes
+
+// AddBytes is Add for a binary key, on a Trie created with WithBinaryKeys. Without that option the key is
+// normalized like any string key.
+func (t *GenericTrie[V]) AddBytes(key []byte, id V) (bool, error) {
+	return t.Add(string(key), id)
+}
+
+// GetBytes is Get for a binary key
+func (t *GenericTrie[V]) GetBytes(key []byte) []V {
+	return t.Get(string(key))
+}
+
+// GetManyBytes is GetMany for a binary prefix
+func (t *GenericTrie[V]) GetManyBytes(prefix []byte, n int) []V {
+	return t.GetMany(string(prefix), n)
+}
+
+// RemoveBytes is Remove for a binary key
+func (t *GenericTrie[V]) RemoveBytes(key []byte, id V) bool {
+	return t.Remove(string(key), id)
+}
+
+// KeysBytes is Keys for a binary prefix, returning each key as the bytes it was added as
+func (t *GenericTrie[V]) KeysBytes(prefix []byte, n int) [][]byte {
+	keys := t.Keys(string(prefix), n)
+	res := make([][]byte, len(keys))
+	for i, key := range keys {
+		res[i] = []byte(key)
+	}
+	return res
+}
@@ -0,0 +1,55 @@
+package indexes
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestBinaryKeys checks keys with embedded NULs and invalid UTF-8, which must come back byte for byte and be ordered
+// by their bytes
+func TestBinaryKeys(t *testing.T) {
+	tr := NewTrie(WithBinaryKeys())
+	keys := [][]byte{{0x00}, {0x00, 0x00}, {'a', 0x00, 'b'}, {'A'}, {0xc3}, {0xc3, 0xa9}, {0xff, 0xfe, 0x00}, []byte("Hash")}
+	for i, key := range keys {
+		if _, err := tr.AddBytes(key, objectID(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, key := range keys {
+		expect(t, "GetBytes", tr.GetBytes(key), []bson.ObjectId{objectID(i)})
+	}
+	expect(t, "GetManyBytes of a NUL", tr.GetManyBytes([]byte{0x00}, 10), []bson.ObjectId{objectID(0), objectID(1)})
+	expect(t, "GetManyBytes of half a rune", tr.GetManyBytes([]byte{0xc3}, 10), []bson.ObjectId{objectID(4), objectID(5)})
+	expect(t, "GetManyBytes keeping case", tr.GetManyBytes([]byte("h"), 10), []bson.ObjectId{})
+	expect(t, "KeysBytes in byte order", tr.KeysBytes(nil, 10), [][]byte{
+		{0x00}, {0x00, 0x00}, {'A'}, []byte("Hash"), {'a', 0x00, 'b'}, {0xc3}, {0xc3, 0xa9}, {0xff, 0xfe, 0x00},
+	})
+	for key := range tr.ToMap() {
+		found := false
+		for _, k := range keys {
+			found = found || bytes.Equal([]byte(key), k)
+		}
+		if !found {
+			t.Fatalf("ToMap key %q was not added", key)
+		}
+	}
+	decoded := NewTrie(WithBinaryKeys())
+	if err := decoded.UnmarshalBinary(marshalBinary(t, tr)); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "KeysBytes after a binary round trip", decoded.KeysBytes(nil, 10), tr.KeysBytes(nil, 10))
+	expect(t, "RemoveBytes", tr.RemoveBytes([]byte{0xff, 0xfe, 0x00}, objectID(6)), true)
+	expect(t, "RemoveBytes of a prefix", tr.RemoveBytes([]byte{0xc3}, objectID(5)), false)
+	expect(t, "GetBytes after RemoveBytes", tr.GetBytes([]byte{0xff, 0xfe, 0x00}), []bson.ObjectId{})
+	if _, err := tr.AddBytes(nil, objectID(1)); err != ErrEmptyKey {
+		t.Fatalf("AddBytes of an empty key = %v, want ErrEmptyKey", err)
+	}
+
+	// The default mode still lowercases and indexes by rune
+	str := NewTrie()
+	str.AddBytes([]byte("Hash\x00"), objectID(1))
+	expect(t, "GetBytes in string mode", str.GetBytes([]byte("hash\x00")), []bson.ObjectId{objectID(1)})
+	expect(t, "Keys in string mode", str.Keys("", 10), []string{"Hash\x00"})
+}
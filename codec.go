@@ -0,0 +1,191 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Encodings of values in binary snapshots, write-ahead logs and cursors
+const (
+	codecObjectID = 1 // the 12 bytes of a bson.ObjectId or primitive.ObjectID, so the two read each other's snapshots
+	codecString   = 2 // the bytes of a string
+	codecJSON     = 3 // the value as encoding/json writes it, for every other type
+)
+
+// valueCodec converts the values of a GenericTrie to and from the forms they are serialized in
+type valueCodec[V comparable] struct {
+	tag    byte                    // one of the codec constants, recorded in binary snapshots
+	size   int                     // length of every encoded value, 0 if it varies
+	encode func(V) ([]byte, error) // the bytes written to binary snapshots, logs and cursors
+	decode func([]byte) (V, error)
+	format func(V) string // the text written to JSON, DOT labels and accepted by LoadCSV: hex for ObjectIds
+	parse  func(string) (V, error)
+}
+
+var objectIDCodec = &valueCodec[bson.ObjectId]{
+	tag:  codecObjectID,
+	size: 12,
+	encode: func(id bson.ObjectId) ([]byte, error) {
+		if !id.Valid() {
+			return nil, ErrInvalidObjectID
+		}
+		return []byte(id), nil
+	},
+	decode: func(b []byte) (bson.ObjectId, error) {
+		if len(b) != 12 {
+			return "", ErrInvalidObjectID
+		}
+		return bson.ObjectId(b), nil
+	},
+	format: bson.ObjectId.Hex,
+	parse: func(s string) (bson.ObjectId, error) {
+		if !bson.IsObjectIdHex(s) {
+			return "", fmt.Errorf("invalid ObjectId hex %q", s)
+		}
+		return bson.ObjectIdHex(s), nil
+	},
+}
+
+var primitiveCodec = &valueCodec[primitive.ObjectID]{
+	tag:  codecObjectID,
+	size: 12,
+	encode: func(id primitive.ObjectID) ([]byte, error) {
+		return id[:], nil
+	},
+	decode: func(b []byte) (primitive.ObjectID, error) {
+		var id primitive.ObjectID
+		if len(b) != len(id) {
+			return id, ErrInvalidObjectID
+		}
+		copy(id[:], b)
+		return id, nil
+	},
+	format: primitive.ObjectID.Hex,
+	parse: func(s string) (primitive.ObjectID, error) {
+		id, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return id, fmt.Errorf("invalid ObjectId hex %q", s)
+		}
+		return id, nil
+	},
+}
+
+var stringCodec = &valueCodec[string]{
+	tag:    codecString,
+	encode: func(s string) ([]byte, error) { return []byte(s), nil },
+	decode: func(b []byte) (string, error) { return string(b), nil },
+	format: func(s string) string { return s },
+	parse:  func(s string) (string, error) { return s, nil },
+}
+
+// jsonCodec returns the codec of a type without one of its own, which must be encodable with encoding/json
+func jsonCodec[V comparable]() *valueCodec[V] {
+	decode := func(b []byte) (V, error) {
+		var v V
+		err := json.Unmarshal(b, &v)
+		return v, err
+	}
+	return &valueCodec[V]{
+		tag: codecJSON,
+		encode: func(v V) ([]byte, error) {
+			return json.Marshal(v)
+		},
+		decode: decode,
+		format: func(v V) string {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Sprint(v)
+			}
+			return string(b)
+		},
+		parse: func(s string) (V, error) { return decode([]byte(s)) },
+	}
+}
+
+// codecOf returns the codec values of type V are serialized with
+func codecOf[V comparable]() *valueCodec[V] {
+	var c interface{}
+	switch interface{}((*V)(nil)).(type) {
+	case *bson.ObjectId:
+		c = objectIDCodec
+	case *primitive.ObjectID:
+		c = primitiveCodec
+	case *string:
+		c = stringCodec
+	default:
+		return jsonCodec[V]()
+	}
+	return c.(*valueCodec[V])
+}
+
+// marshalJSON writes v as a JSON value: ObjectIds as their hex strings, strings as themselves and anything else as
+// encoding/json writes it
+func (c *valueCodec[V]) marshalJSON(v V) ([]byte, error) {
+	if c.tag == codecJSON {
+		return c.encode(v)
+	}
+	return json.Marshal(c.format(v))
+}
+
+// unmarshalJSON reads a value written by marshalJSON
+func (c *valueCodec[V]) unmarshalJSON(raw json.RawMessage) (V, error) {
+	if c.tag == codecJSON {
+		return c.decode(raw)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		var zero V
+		return zero, err
+	}
+	return c.parse(s)
+}
+
+// valueOrder returns the natural order of values of type V, or nil if V has none. ObjectIds of either driver sort by
+// their bytes, which puts them in creation order.
+func valueOrder[V comparable]() func(a, b V) bool {
+	var less interface{}
+	switch interface{}((*V)(nil)).(type) {
+	case *bson.ObjectId:
+		less = func(a, b bson.ObjectId) bool { return a < b }
+	case *primitive.ObjectID:
+		less = func(a, b primitive.ObjectID) bool { return bytes.Compare(a[:], b[:]) < 0 }
+	case *string:
+		less = func(a, b string) bool { return a < b }
+	case *int:
+		less = func(a, b int) bool { return a < b }
+	case *int64:
+		less = func(a, b int64) bool { return a < b }
+	case *uint64:
+		less = func(a, b uint64) bool { return a < b }
+	default:
+		return nil
+	}
+	return less.(func(a, b V) bool)
+}
+
+// sortValues puts vals in the natural order of V, leaving them as they are if V has none
+func sortValues[V comparable](vals []V) {
+	if less := valueOrder[V](); less != nil {
+		sort.Slice(vals, func(i, j int) bool { return less(vals[i], vals[j]) })
+	}
+}
+
+// valueTime returns the creation time embedded in v, for GetManyByTime: that of an ObjectId of either driver, and the
+// zero time for values of other types
+func valueTime[V comparable](v V) time.Time {
+	switch id := interface{}(v).(type) {
+	case bson.ObjectId:
+		if id.Valid() {
+			return id.Time()
+		}
+	case primitive.ObjectID:
+		return id.Timestamp()
+	}
+	return time.Time{}
+}
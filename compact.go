@@ -0,0 +1,56 @@
+package indexes
+
+// CompactStats reports what a call to Compact reclaimed
+type CompactStats struct {
+	NodesFreed      int // nodes removed because no value was stored anywhere in their subtree
+	NilLinksRemoved int // child entries that pointed at nil
+	MapsRebuilt     int // child maps reallocated at their live size after entries were removed
+}
+
+/*
+Compact walks the whole Trie under the write lock and restores it to its minimal shape: child entries pointing at nil
+or at subtrees holding no values are deleted, and any child map that lost entries is rebuilt at its live size, since Go
+maps never shrink on delete. Get and GetMany results are unchanged. Compact is O(n) and is intended for periodic maintenance.
+*/
+func (t *GenericTrie[V]) Compact() CompactStats {
+	t.mx.Lock()
+	defer t.unlock()
+
+	// Collect the nodes parents first, then settle them children first so liveness is known before the parent is visited
+	order := []*GenericNode[V]{t.root}
+	for i := 0; i < len(order); i++ {
+		for _, link := range order[i].link {
+			if link != nil {
+				order = append(order, link)
+			}
+		}
+	}
+	var stats CompactStats
+	live := make(map[*GenericNode[V]]bool, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		removed := 0
+		for r, link := range node.link {
+			switch {
+			case link == nil:
+				stats.NilLinksRemoved++
+			case !live[link]:
+				stats.NodesFreed++
+			default:
+				continue
+			}
+			delete(node.link, r)
+			removed++
+		}
+		if removed != 0 {
+			links := make(map[rune]*GenericNode[V], len(node.link))
+			for r, link := range node.link {
+				links[r] = link
+			}
+			node.link = links
+			stats.MapsRebuilt++
+		}
+		live[node] = node.IDSet.Size() != 0 || len(node.link) != 0
+	}
+	return stats
+}
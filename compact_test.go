@@ -0,0 +1,41 @@
+package indexes
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestCompact degrades a Trie the way Remove did before it pruned, emptying nodes in place and leaving nil links, and
+// checks that Compact restores the shape of a Trie built from the same contents without changing any result
+func TestCompact(t *testing.T) {
+	tr := NewTrie()
+	for i := 0; i < 200; i++ {
+		tr.Add(fmt.Sprintf("key%03d", i), objectID(i))
+	}
+	// Empty every other key in place, without pruning, and leave nil links behind
+	for i := 0; i < 200; i += 2 {
+		node := findTip(fmt.Sprintf("key%03d", i), tr.root)
+		node.ClearVals()
+		tr.vals--
+		tr.keys--
+	}
+	tr.root.GetLink('k').PutLink('x', nil)
+	findTip("key1", tr.root).PutLink('!', nil)
+	minimal := NewTrieFromMap(tr.ToMap())
+	queries := []string{"", "k", "key0", "key01", "key011", "key100", "key19"}
+	before := map[string]interface{}{}
+	for _, q := range queries {
+		before[q] = []interface{}{tr.Get(q), tr.GetMany(q, 1000), tr.Keys(q, 1000)}
+	}
+
+	stats := tr.Compact()
+	expect(t, "NilLinksRemoved", stats.NilLinksRemoved, 2)
+	if stats.NodesFreed == 0 || stats.MapsRebuilt == 0 {
+		t.Fatalf("Compact of a degraded Trie reported %+v", stats)
+	}
+	expect(t, "Stats after Compact", tr.Stats(), minimal.Stats())
+	for _, q := range queries {
+		expect(t, fmt.Sprintf("results for %q after Compact", q), []interface{}{tr.Get(q), tr.GetMany(q, 1000), tr.Keys(q, 1000)}, before[q])
+	}
+	expect(t, "Compact of a minimal Trie", tr.Compact(), CompactStats{})
+}
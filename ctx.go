@@ -0,0 +1,127 @@
+package indexes
+
+import (
+	"context"
+)
+
+// ctxCheckEvery is the number of nodes the context-aware queries visit between checks of ctx.Err()
+const ctxCheckEvery = 1024
+
+// walkCtx is walk checking ctx every ctxCheckEvery nodes, and once before starting. It returns ctx.Err() if the walk
+// was cut short by the context, and nil if it ran to completion or visit stopped it.
+func walkCtx[V comparable](ctx context.Context, curr *GenericNode[V], prefix []rune, visit func(key []rune, node *GenericNode[V]) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	visited := 0
+	walk(curr, prefix, func(key []rune, node *GenericNode[V]) bool {
+		visited++
+		if visited%ctxCheckEvery == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		return visit(key, node)
+	})
+	return err
+}
+
+// GetCtx is Get returning ctx.Err() without a result if ctx is already done. Unlike the other context-aware queries it
+// checks ctx only before starting: Get follows the key's own path and walks no subtree, so there is nothing to cut short.
+func (t *GenericTrie[V]) GetCtx(ctx context.Context, prefix string) ([]V, error) {
+	if err := ctx.Err(); err != nil {
+		return []V{}, err
+	}
+	return t.Get(prefix), nil
+}
+
+// GetManyCtx is GetMany stopping once ctx is done, in which case it returns the ids collected so far along with ctx.Err().
+// The context is checked every ctxCheckEvery nodes, so a cancelled query may run a little past its deadline.
+func (t *GenericTrie[V]) GetManyCtx(ctx context.Context, prefix string, n int) ([]V, error) {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	res := NewSet[V]()
+	ids := []V{}
+	if n <= 0 {
+		return ids, ctx.Err()
+	}
+	err := walkCtx(ctx, t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			if res.Size() >= n {
+				return false
+			}
+			if !res.ContainsVal(id) {
+				res.SaveVal(id)
+				ids = append(ids, id)
+			}
+		}
+		return res.Size() < n
+	})
+	return ids, err
+}
+
+// KeysCtx is Keys stopping once ctx is done, in which case it returns the keys collected so far along with ctx.Err()
+func (t *GenericTrie[V]) KeysCtx(ctx context.Context, prefix string, n int) ([]string, error) {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	keys := []string{}
+	if n <= 0 {
+		return keys, ctx.Err()
+	}
+	err := walkCtx(ctx, t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		if node.hasLive(now) {
+			keys = append(keys, node.displayKey(string(key)))
+		}
+		return len(keys) < n
+	})
+	return keys, err
+}
+
+// GetManyWithKeysCtx is GetManyWithKeys stopping once ctx is done, in which case it returns the matches collected so
+// far along with ctx.Err()
+func (t *GenericTrie[V]) GetManyWithKeysCtx(ctx context.Context, prefix string, n int) ([]GenericKeyMatch[V], error) {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	matches := []GenericKeyMatch[V]{}
+	if n <= 0 {
+		return matches, ctx.Err()
+	}
+	total := 0
+	err := walkCtx(ctx, t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		if !node.hasLive(now) {
+			return true
+		}
+		ids := node.liveVals(now)
+		if len(ids) > n-total {
+			ids = ids[:n-total]
+		}
+		matches = append(matches, GenericKeyMatch[V]{Key: node.displayKey(string(key)), IDs: ids})
+		total += len(ids)
+		return total < n
+	})
+	return matches, err
+}
+
+// CountCtx is Count stopping once ctx is done, in which case it returns the number of distinct ids seen so far along
+// with ctx.Err()
+func (t *GenericTrie[V]) CountCtx(ctx context.Context, prefix string) (int, error) {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	seen := make(map[V]struct{})
+	err := walkCtx(ctx, t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			seen[id] = struct{}{}
+		}
+		return true
+	})
+	return len(seen), err
+}
@@ -0,0 +1,80 @@
+package indexes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// cancelAfter is a context that reports itself cancelled from its checks-th call to Err on, cancelling a walk at a
+// known point
+type cancelAfter struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.checks--; c.checks < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCtxAlreadyCancelled(t *testing.T) {
+	tr := largeTrie(t, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ids, err := tr.GetCtx(ctx, "aaaaaa")
+	expect(t, "GetCtx", []interface{}{ids, err}, []interface{}{[]bson.ObjectId{}, context.Canceled})
+	ids, err = tr.GetManyCtx(ctx, "", 10)
+	expect(t, "GetManyCtx", []interface{}{ids, err}, []interface{}{[]bson.ObjectId{}, context.Canceled})
+	keys, err := tr.KeysCtx(ctx, "", 10)
+	expect(t, "KeysCtx", []interface{}{keys, err}, []interface{}{[]string{}, context.Canceled})
+	matches, err := tr.GetManyWithKeysCtx(ctx, "", 10)
+	expect(t, "GetManyWithKeysCtx", []interface{}{matches, err}, []interface{}{[]KeyMatch{}, context.Canceled})
+	count, err := tr.CountCtx(ctx, "")
+	expect(t, "CountCtx", []interface{}{count, err}, []interface{}{0, context.Canceled})
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = tr.GetManyCtx(ctx, "", 10)
+	expect(t, "GetManyCtx past its deadline", err, context.DeadlineExceeded)
+}
+
+// TestCtxCancelledMidWalk cancels after a few checks and expects the results collected so far, which are the start of
+// the complete results
+func TestCtxCancelledMidWalk(t *testing.T) {
+	const n = 20000
+	tr := largeTrie(t, n)
+	mid := func() context.Context { return &cancelAfter{context.Background(), 3} }
+
+	ids, err := tr.GetManyCtx(mid(), "", n)
+	expect(t, "GetManyCtx error", err, context.Canceled)
+	if len(ids) == 0 || len(ids) >= n {
+		t.Fatalf("GetManyCtx returned %d ids, want a part of %d", len(ids), n)
+	}
+	expect(t, "GetManyCtx partial results", ids, tr.GetMany("", len(ids)))
+
+	keys, err := tr.KeysCtx(mid(), "", n)
+	expect(t, "KeysCtx error", err, context.Canceled)
+	if len(keys) == 0 || len(keys) >= n {
+		t.Fatalf("KeysCtx returned %d keys, want a part of %d", len(keys), n)
+	}
+	expect(t, "KeysCtx partial results", keys, tr.Keys("", len(keys)))
+
+	matches, err := tr.GetManyWithKeysCtx(mid(), "", n)
+	expect(t, "GetManyWithKeysCtx error", err, context.Canceled)
+	expect(t, "GetManyWithKeysCtx partial results", matches, tr.GetManyWithKeys("", len(matches)))
+
+	count, err := tr.CountCtx(mid(), "")
+	expect(t, "CountCtx error", err, context.Canceled)
+	if count == 0 || count >= n {
+		t.Fatalf("CountCtx counted %d ids, want a part of %d", count, n)
+	}
+
+	// A walk finishing between checks is not reported as cancelled
+	ids, err = tr.GetManyCtx(mid(), "aaaaa", n)
+	expect(t, "GetManyCtx of a small subtree", []interface{}{ids, err}, []interface{}{tr.GetMany("aaaaa", n), nil})
+}
@@ -0,0 +1,109 @@
+package indexes
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidCursor is returned by GetManyCursor when the cursor was not produced by a previous call
+var ErrInvalidCursor = errors.New("indexes: invalid cursor")
+
+// encodeCursor packs the key and id of the last returned result into an opaque token
+func encodeCursor[V comparable](key string, id V) string {
+	b, _ := codecOf[V]().encode(id)
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(b)+len(key))
+	buf = buf[:binary.PutUvarint(buf, uint64(len(b)))]
+	buf = append(buf, b...)
+	buf = append(buf, key...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeCursor unpacks a token produced by encodeCursor
+func decodeCursor[V comparable](cursor string) (key string, id V, err error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", id, ErrInvalidCursor
+	}
+	size, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < size {
+		return "", id, ErrInvalidCursor
+	}
+	buf = buf[n:]
+	if id, err = codecOf[V]().decode(buf[:size]); err != nil {
+		return "", id, ErrInvalidCursor
+	}
+	return string(buf[size:]), id, nil
+}
+
+/*
+GetManyCursor returns up to limit ids under keys starting with prefix, resuming strictly after the position recorded in
+cursor, along with the cursor for the following page. An empty cursor starts from the beginning and an empty next
+cursor means the results are exhausted. Results are ordered by key and then by id, as GetMany orders them; because a
+cursor cannot remember every id already returned, an id stored under several matching keys is returned once for each.
+
+The cursor records the last key and id returned rather than a position, so it survives adds and removes between
+pages: the next page resumes at the first key >= the recorded one, skipping ids of that key up to the recorded id. For
+value types without a natural order, ids of that key come in the order they were added and are skipped up to the
+position of the recorded id. Returns ErrInvalidCursor if the cursor is malformed.
+*/
+func (t *GenericTrie[V]) GetManyCursor(prefix string, limit int, cursor string) (ids []V, next string, err error) {
+	prefix = t.normalize(prefix)
+	lastKey, resume := prefix, false
+	var lastID V
+	if cursor != "" {
+		if lastKey, lastID, err = decodeCursor[V](cursor); err != nil {
+			return []V{}, "", err
+		}
+		resume = lastKey >= prefix
+		if !resume {
+			lastKey = prefix
+		}
+	}
+	less := valueOrder[V]()
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	ids = []V{}
+	if limit <= 0 {
+		return ids, "", nil
+	}
+	more := false
+	var endKey string
+	walkFrom(t.prefixTip(prefix), prefix, lastKey, func(key string, node *GenericNode[V]) bool {
+		vals := node.liveVals(now)
+		if resume && key == lastKey {
+			vals = valuesAfter(vals, lastID, less)
+		}
+		for _, id := range vals {
+			if len(ids) == limit {
+				more = true
+				return false
+			}
+			ids = append(ids, id)
+			endKey = key
+		}
+		return true
+	})
+	if more {
+		next = encodeCursor(endKey, ids[len(ids)-1])
+	}
+	return ids, next, nil
+}
+
+// valuesAfter returns the part of vals, in the order GetVals returns them, that follows last: the values greater than it
+// when less orders them, and otherwise those after its position, or all of them if it is no longer there
+func valuesAfter[V comparable](vals []V, last V, less func(a, b V) bool) []V {
+	for i, v := range vals {
+		if less != nil && less(last, v) {
+			return vals[i:]
+		}
+		if less == nil && v == last {
+			return vals[i+1:]
+		}
+	}
+	if less != nil {
+		return nil
+	}
+	return vals
+}
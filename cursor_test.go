@@ -0,0 +1,90 @@
+package indexes
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestGetManyCursorConcurrentAdds pages through a large subtree while another goroutine adds keys all over it. Every
+// id present from the start must come back exactly once and in key order, and every added id at most once.
+func TestGetManyCursorConcurrentAdds(t *testing.T) {
+	const n = 5000
+	tr := largeTrie(t, n)
+	original := make(map[bson.ObjectId]int, n)
+	for i := 0; i < n; i++ {
+		original[objectID(i)] = i
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rng := rand.New(rand.NewSource(1))
+		for i := n; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			tr.Add("a"+randomKey(rng, []rune("abcz")), objectID(i))
+		}
+	}()
+	seen := map[bson.ObjectId]bool{}
+	last := -1
+	cursor := ""
+	for pages := 0; ; pages++ {
+		ids, next, err := tr.GetManyCursor("a", 37, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			if seen[id] {
+				t.Fatalf("id %v returned twice", id)
+			}
+			seen[id] = true
+			if i, ok := original[id]; ok {
+				if i != last+1 {
+					t.Fatalf("id %d returned after %d", i, last)
+				}
+				last = i
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	close(stop)
+	wg.Wait()
+	expect(t, "last original id", last, n-1)
+}
+
+// TestGetManyCursorRemoves checks that a cursor resumes at the next key when the key it ended on is removed
+func TestGetManyCursorRemoves(t *testing.T) {
+	tr := NewTrie()
+	for i, key := range []string{"ant", "bee", "cat", "dog", "eel"} {
+		tr.Add(key, objectID(i))
+	}
+	ids, next, err := tr.GetManyCursor("", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "first page", ids, []bson.ObjectId{objectID(0), objectID(1)})
+	tr.Remove("bee", objectID(1))
+	tr.Remove("cat", objectID(2))
+	tr.Add("bear", objectID(5))
+	tr.Add("cow", objectID(6))
+	ids, next, err = tr.GetManyCursor("", 2, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "page after removing the cursor's key", ids, []bson.ObjectId{objectID(6), objectID(3)})
+	ids, next, _ = tr.GetManyCursor("", 2, next)
+	expect(t, "last page", []interface{}{ids, next}, []interface{}{[]bson.ObjectId{objectID(4)}, ""})
+	if _, _, err := tr.GetManyCursor("", 2, "not a cursor!"); err != ErrInvalidCursor {
+		t.Fatalf("GetManyCursor of a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+}
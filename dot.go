@@ -0,0 +1,78 @@
+package indexes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DOTOptions selects the part of the Trie WriteDOT draws and how much of each node it shows
+type DOTOptions struct {
+	Prefix   string // draw only the subtree under this prefix, "" for the whole Trie
+	MaxDepth int    // levels drawn below the subtree's root, 0 for no limit
+	IDs      int    // ids listed in each node's label, the rest counted as "+n more"; 0 to list none
+}
+
+/*
+WriteDOT writes the Trie to w as a Graphviz digraph, for looking at the actual shape of an index: one node per TrieNode
+labeled with the number of ids stored there and optionally the first opts.IDs of them, and one edge per link labeled
+with its rune. Nodes whose children were cut off by opts.MaxDepth are labeled with a trailing "…". Nodes are numbered and
+written in lexicographic key order with their edges in ascending rune order, so two dumps of the same Trie are
+identical and diffs between dumps are meaningful. A prefix no key starts with yields an empty graph. It walks under the
+read lock.
+*/
+func (t *GenericTrie[V]) WriteDOT(w io.Writer, opts DOTOptions) error {
+	prefix := t.normalize(opts.Prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph trie {")
+	if tip := t.prefixTip(prefix); tip != nil {
+		type frame struct {
+			node   *GenericNode[V]
+			parent int // number of the parent node, -1 for the subtree's root
+			r      rune
+			depth  int
+		}
+		now := t.cutoff()
+		stack := []frame{{node: tip, parent: -1}}
+		for num := 0; len(stack) > 0; num++ {
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			runes := f.node.GetAllRunes()
+			cut := opts.MaxDepth > 0 && f.depth >= opts.MaxDepth
+			fmt.Fprintf(bw, "\tn%d [label=%s];\n", num, strconv.Quote(dotLabel(f.node.liveVals(now), opts.IDs, cut && len(runes) != 0)))
+			if f.parent >= 0 {
+				fmt.Fprintf(bw, "\tn%d -> n%d [label=%s];\n", f.parent, num, strconv.Quote(string(f.r)))
+			}
+			if cut {
+				continue
+			}
+			// Push the children in reverse so they are numbered in ascending rune order
+			for i := len(runes) - 1; i >= 0; i-- {
+				stack = append(stack, frame{node: f.node.GetLink(runes[i]), parent: num, r: runes[i], depth: f.depth + 1})
+			}
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// dotLabel returns the label WriteDOT gives a node holding ids, listing up to n of them, with a trailing "…" if the
+// node's children are not drawn
+func dotLabel[V comparable](ids []V, n int, cut bool) string {
+	lines := []string{strconv.Itoa(len(ids))}
+	for i := 0; n > 0 && i < len(ids); i++ {
+		if i == n {
+			lines = append(lines, fmt.Sprintf("+%d more", len(ids)-n))
+			break
+		}
+		lines = append(lines, codecOf[V]().format(ids[i]))
+	}
+	if cut {
+		lines = append(lines, "…")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,36 @@
+package indexes
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestWriteDOT compares the graphs of a tiny Trie, whole and cut down, with their golden files
+func TestWriteDOT(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("to", objectID(1))
+	tr.Add("Tea", objectID(2))
+	for i := 1; i <= 3; i++ {
+		tr.Add("ten", objectID(i))
+	}
+	tr.Add("i", objectID(4))
+	for _, c := range []struct {
+		name string
+		opts DOTOptions
+	}{
+		{"trie.dot", DOTOptions{IDs: 2}},
+		{"trie_te.dot", DOTOptions{Prefix: "TE", MaxDepth: 1}},
+		{"trie_depth.dot", DOTOptions{MaxDepth: 1, IDs: 1}},
+	} {
+		var buf bytes.Buffer
+		if err := tr.WriteDOT(&buf, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		golden(t, c.name, buf.Bytes())
+	}
+	var buf bytes.Buffer
+	if err := tr.WriteDOT(&buf, DOTOptions{Prefix: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "graph of a missing prefix", buf.String(), "digraph trie {\n}\n")
+}
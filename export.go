@@ -0,0 +1,53 @@
+package indexes
+
+/*
+Export returns the contents of the Trie as a map from every stored key, in its normalized form, to its ids in ObjectId
+order; with WithBinaryKeys the keys are the bytes they were added as, so that Import restores them. The slices are
+freshly allocated, so the map may be modified freely. Like MarshalJSON only keys and ids are
+exported, not display forms or per-pair metadata; expired pairs are left out. It walks under the read lock.
+*/
+func (t *GenericTrie[V]) Export() map[string][]V {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	m := make(map[string][]V, t.keys)
+	now := t.cutoff()
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		if ids := node.liveVals(now); len(ids) != 0 {
+			m[t.cfg.givenKey(string(key))] = ids
+		}
+		return true
+	})
+	return m
+}
+
+/*
+Import adds every pair in m, as returned by Export, and returns the number of pairs newly inserted. Keys are normalized
+with the Trie's options and empty keys are skipped, as AddMany does. With replace, the previous contents are discarded:
+the new ones are built off to the side and installed under a brief write lock, like Swap, so readers see either the old
+contents or the imported ones, never a mix. Otherwise the pairs are added under a single write lock.
+*/
+func (t *GenericTrie[V]) Import(m map[string][]V, replace bool) int {
+	dst := t
+	if replace {
+		dst = newTrie[V](t.cfg)
+	} else {
+		t.mx.Lock()
+		defer t.unlock()
+	}
+	imported := 0
+	for key, ids := range m {
+		stored, err := dst.storedKey(key)
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			if _, ok := dst.insert(stored, key, id); ok {
+				imported++
+			}
+		}
+	}
+	if replace {
+		t.replace(dst)
+	}
+	return imported
+}
@@ -0,0 +1,82 @@
+package indexes
+
+import "gopkg.in/mgo.v2/bson"
+
+/*
+AddTagged is Add recording which field of the document the key was taken from, such as "first" or "username", for
+GetManyFielded. A pair may carry several fields when the same key comes from more than one of them. Tagging a pair that
+is already stored adds the field to it; the returned bool still reports only whether the pair was newly stored.
+*/
+func (t *GenericTrie[V]) AddTagged(key string, id V, field string) (bool, error) {
+	stored, err := t.storedKey(key)
+	if err != nil {
+		return false, err
+	}
+	t.mx.Lock()
+	defer t.unlock()
+	node, inserted := t.insert(stored, key, id)
+	if m := node.putMeta(id); !containsString(m.fields, field) {
+		m.fields = append(m.fields, field)
+	}
+	return inserted, nil
+}
+
+// GenericFieldedMatch pairs an id with the distinct fields it matched through, in the order they were first met
+type GenericFieldedMatch[V comparable] struct {
+	ID     V
+	Fields []string
+}
+
+// FieldedMatch is the GenericFieldedMatch of a Trie
+type FieldedMatch = GenericFieldedMatch[bson.ObjectId]
+
+/*
+GetManyFielded returns the n ids under keys starting with prefix that matched through the most distinct fields, most
+first, with those fields. Ids matched only through keys added without a field have no Fields and rank last, and ids
+matching equally many fields keep GetMany order. Like GetManyCounted it tallies the whole subtree before returning.
+*/
+func (t *GenericTrie[V]) GetManyFielded(prefix string, n int) []GenericFieldedMatch[V] {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	fields := make(map[V][]string)
+	var order []V
+	walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			seen, ok := fields[id]
+			if !ok {
+				order = append(order, id)
+				seen = []string{}
+			}
+			if m := node.getMeta(id); m != nil {
+				for _, f := range m.fields {
+					if !containsString(seen, f) {
+						seen = append(seen, f)
+					}
+				}
+			}
+			fields[id] = seen
+		}
+		return true
+	})
+	top := newTopK(n, func(a, b *candidate[V]) bool { return a.score < b.score }, false)
+	for _, id := range order {
+		top.offer(candidate[V]{id: id, score: float64(len(fields[id]))})
+	}
+	res := []GenericFieldedMatch[V]{}
+	for _, c := range top.drain() {
+		res = append(res, GenericFieldedMatch[V]{ID: c.id, Fields: fields[c.id]})
+	}
+	return res
+}
+
+// containsString reports whether s is one of list
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package indexes
+
+/*
+fuzzyWalk walks the trie below root depth first in lexicographic key order, carrying the last two rows of the optimal
+string alignment dynamic-programming table down each path: row[j] is the edit distance between the node's key and
+query[:j], counting insertions, deletions, substitutions and transpositions of adjacent runes as one edit each. visit
+receives every node along with its key, its row and best, the smallest row[len(query)] seen along the path from the
+root, i.e. the distance from query to the closest prefix of the node's key. The key slice is only valid during the call.
+
+A subtree is abandoned once every entry of the row exceeds maxEdits, since no longer key can come closer. In prefix
+mode a subtree is also kept while best is within maxEdits, because every key below then has a matching prefix. Pruning
+on the last row alone is safe, since a transposition never costs less than the substitution before it.
+*/
+func fuzzyWalk[V comparable](root *GenericNode[V], query []rune, maxEdits int, prefix bool, visit func(key []rune, node *GenericNode[V], row []int, best int)) {
+	type frame struct {
+		node  *GenericNode[V]
+		depth int
+		r     rune
+		row   []int
+		prev  []int // the row of the parent, nil at the root
+		best  int
+	}
+	first := make([]int, len(query)+1)
+	for j := range first {
+		first[j] = j
+	}
+	var key []rune
+	stack := []frame{{root, 0, 0, first, nil, len(query)}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.depth > 0 {
+			key = append(key[:f.depth-1], f.r)
+		}
+		visit(key, f.node, f.row, f.best)
+
+		runes := f.node.GetAllRunes()
+		// Push the children in reverse so they are popped in ascending rune order
+		for i := len(runes) - 1; i >= 0; i-- {
+			r := runes[i]
+			row := make([]int, len(query)+1)
+			row[0] = f.row[0] + 1
+			lowest := row[0]
+			for j := 1; j <= len(query); j++ {
+				cost := 1
+				if query[j-1] == r {
+					cost = 0
+				}
+				row[j] = minInt(f.row[j]+1, row[j-1]+1, f.row[j-1]+cost)
+				if f.prev != nil && j > 1 && r == query[j-2] && f.r == query[j-1] {
+					// The key's last two runes are the query's, swapped
+					row[j] = minInt(row[j], f.prev[j-2]+1)
+				}
+				if row[j] < lowest {
+					lowest = row[j]
+				}
+			}
+			best := minInt(f.best, row[len(query)])
+			if lowest > maxEdits && !(prefix && best <= maxEdits) {
+				continue
+			}
+			stack = append(stack, frame{f.node.GetLink(r), f.depth + 1, r, row, f.row, best})
+		}
+	}
+}
+
+// minInt returns the smallest of its arguments
+func minInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v < first {
+			first = v
+		}
+	}
+	return first
+}
+
+/*
+GetFuzzy returns up to n ids stored under keys that have a prefix within maxEdits edits (insertions, deletions or
+substitutions of a rune, or transpositions of two adjacent runes) of the normalized query prefix. Results are ordered
+by edit distance first, so exact prefix matches come before distance-1 matches, then in lexicographic key order, and
+are deduplicated like GetMany. With maxEdits 0 GetFuzzy returns exactly what GetMany returns. The trie is walked once
+with a dynamic-programming row per node, and branches that can no longer come within maxEdits are skipped rather than
+enumerating every key.
+*/
+func (t *GenericTrie[V]) GetFuzzy(prefix string, maxEdits int, n int) []V {
+	query := []rune(t.normalize(prefix))
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	ids := []V{}
+	if maxEdits < 0 || n <= 0 {
+		return ids
+	}
+	// Bucket the matching nodes by distance; each bucket fills in lexicographic key order
+	buckets := make([][]*GenericNode[V], maxEdits+1)
+	fuzzyWalk(t.root, query, maxEdits, true, func(_ []rune, node *GenericNode[V], _ []int, best int) {
+		if best <= maxEdits && node.hasLive(now) {
+			buckets[best] = append(buckets[best], node)
+		}
+	})
+	res := NewSet[V]()
+	for _, nodes := range buckets {
+		for _, node := range nodes {
+			for _, id := range node.liveVals(now) {
+				if res.Size() >= n {
+					return ids
+				}
+				if !res.ContainsVal(id) {
+					res.SaveVal(id)
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+/*
+Suggest returns up to n stored keys within maxEdits edits of the whole normalized query, for "did you mean" prompts,
+ordered by edit distance and then lexicographically. Unlike GetFuzzy the complete key is compared, not just a prefix of
+it. A transposition of two adjacent runes counts as one edit, as in the optimal string alignment distance, though a
+transposed pair is not edited again. It shares GetFuzzy's walk, so only branches that can still come within maxEdits of
+the query are visited.
+*/
+func (t *GenericTrie[V]) Suggest(query string, maxEdits, n int) []string {
+	q := []rune(t.normalize(query))
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	suggestions := []string{}
+	if maxEdits < 0 || n <= 0 {
+		return suggestions
+	}
+	buckets := make([][]string, maxEdits+1)
+	fuzzyWalk(t.root, q, maxEdits, false, func(key []rune, node *GenericNode[V], row []int, _ int) {
+		if d := row[len(q)]; d <= maxEdits && node.hasLive(now) {
+			buckets[d] = append(buckets[d], node.displayKey(string(key)))
+		}
+	})
+	for _, keys := range buckets {
+		for _, key := range keys {
+			if len(suggestions) == n {
+				return suggestions
+			}
+			suggestions = append(suggestions, key)
+		}
+	}
+	return suggestions
+}
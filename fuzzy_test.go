@@ -0,0 +1,127 @@
+package indexes
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// osaDistance returns the optimal string alignment distance between a and b, the reference fuzzyWalk is checked against
+func osaDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func TestSuggestTransposition(t *testing.T) {
+	tr := NewTrie()
+	for _, key := range []string{"receive", "recieve", "relieve", "ca", "abc", "acb", "bca"} {
+		tr.Add(key, objectID(1))
+	}
+	expect(t, "Suggest of a transposition", tr.Suggest("recevie", 1, 10), []string{"receive"})
+	expect(t, "Suggest of the transposed key", tr.Suggest("recieve", 1, 10), []string{"recieve", "receive", "relieve"})
+	expect(t, "Suggest with no edits", tr.Suggest("acb", 0, 10), []string{"acb"})
+	expect(t, "Suggest of adjacent swaps", tr.Suggest("abc", 1, 10), []string{"abc", "acb"})
+	// Optimal string alignment does not edit a transposed pair again, so "ca" is three edits from "abc"
+	expect(t, "Suggest of a transposition edited again", tr.Suggest("ac", 1, 10), []string{"abc", "acb", "ca"})
+	expect(t, "Suggest within two edits", tr.Suggest("cab", 2, 10), []string{"acb", "ca", "abc", "bca"})
+}
+
+func TestGetFuzzyTransposition(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	tr.Add("receive", a)
+	tr.Add("recieve", b)
+	expect(t, "GetFuzzy of a transposed prefix", tr.GetFuzzy("rcee", 1, 10), []bson.ObjectId{a})
+	expect(t, "GetFuzzy ordered by distance", tr.GetFuzzy("recie", 1, 10), []bson.ObjectId{b, a})
+}
+
+// TestSuggestRandom checks Suggest against the distance to every stored key for random keys and queries
+func TestSuggestRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	letters := []rune("abcd")
+	tr := NewTrie()
+	for i := 0; i < 300; i++ {
+		tr.Add(randomKey(rng, letters), objectID(i))
+	}
+	keys := tr.Keys("", 1000)
+	for i := 0; i < 200; i++ {
+		query := []rune(randomKey(rng, letters))
+		for maxEdits := 0; maxEdits <= 2; maxEdits++ {
+			var want []string
+			dist := map[string]int{}
+			for _, key := range keys {
+				if d := osaDistance([]rune(key), query); d <= maxEdits {
+					dist[key] = d
+					want = append(want, key)
+				}
+			}
+			sort.SliceStable(want, func(i, j int) bool { return dist[want[i]] < dist[want[j]] })
+			if want == nil {
+				want = []string{}
+			}
+			expect(t, fmt.Sprintf("Suggest(%q, %d)", string(query), maxEdits), tr.Suggest(string(query), maxEdits, 1000), want)
+		}
+	}
+}
+
+// TestGetFuzzyEdits checks prefixes one insertion, deletion and substitution away, and that closer matches come first
+func TestGetFuzzyEdits(t *testing.T) {
+	tr := NewTrie()
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("johnson", a)
+	tr.Add("jonson", b)
+	tr.Add("jansen", c)
+	for _, q := range []struct {
+		prefix   string
+		maxEdits int
+		want     []bson.ObjectId
+	}{
+		{"john", 0, []bson.ObjectId{a}},
+		{"jhn", 1, []bson.ObjectId{c, a, b}},   // an insertion reaches "john", substitutions "jan" and "jon"
+		{"johhn", 1, []bson.ObjectId{a}},       // a deletion
+		{"jahn", 1, []bson.ObjectId{c, a}},     // a deletion reaches "jan", a substitution "john"
+		{"jonsen", 1, []bson.ObjectId{c, b}},   // "jansen" and "jonson" by one substitution each
+		{"jonson", 1, []bson.ObjectId{b, a}},   // the exact prefix first
+		{"xyz", 2, []bson.ObjectId{}},          // nothing within two edits
+		{"jo", -1, []bson.ObjectId{}},          // a negative distance matches nothing
+		{"", 0, []bson.ObjectId{c, a, b}},      // every key has the empty prefix
+		{"xx", 2, []bson.ObjectId{c, a, b}},    // two substitutions of the first two runes
+		{"johnsonville", 1, []bson.ObjectId{}}, // longer than any key by more than one rune
+	} {
+		expect(t, fmt.Sprintf("GetFuzzy(%q, %d)", q.prefix, q.maxEdits), tr.GetFuzzy(q.prefix, q.maxEdits, 10), q.want)
+	}
+}
+
+// BenchmarkGetFuzzy measures a prefix search within one and two edits over 100k keys
+func BenchmarkGetFuzzy(b *testing.B) {
+	tr := largeTrie(b, 100000)
+	for _, maxEdits := range []int{1, 2} {
+		b.Run(fmt.Sprintf("edits=%d", maxEdits), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tr.GetFuzzy("aabxc", maxEdits, 10)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package indexes
+
+import (
+	"sync/atomic"
+)
+
+/*
+Generation returns a counter that grows with every change to the stored pairs: an Add that stores a pair, a Remove that
+removes one, Rename, ReplaceVal, DeleteSubtree, Purge, the batch methods, Clear, Swap and Rebuild. Calls that change
+nothing, such as adding a pair that is already stored, leave it alone, as do changes to weights, hits and payloads.
+It is read atomically without taking any lock, so a cache can cheaply check whether results it holds may be stale.
+*/
+func (t *GenericTrie[V]) Generation() uint64 {
+	return atomic.LoadUint64(&t.gen)
+}
+
+/*
+PrefixGeneration is Generation for the keys starting with prefix: it changes whenever a pair stored under such a key
+changes, so cached results for prefix can be invalidated without dropping those for unrelated prefixes. It may also
+change when nothing under prefix did, such as when no stored key starts with prefix, but never stays the same across a
+change. It takes the read lock and walks the prefix.
+*/
+func (t *GenericTrie[V]) PrefixGeneration(prefix string) uint64 {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	// A prefix without a node of its own goes by its deepest ancestor, which every removal below it stamps
+	curr := t.root
+	for _, r := range prefix {
+		next := curr.GetLink(r)
+		if next == nil {
+			break
+		}
+		curr = next
+	}
+	if curr.gen < t.epoch {
+		return t.epoch
+	}
+	return curr.gen
+}
+
+// touch counts a change to a pair stored under the already normalized key and stamps the new generation on every node
+// left along the key's path. The caller must hold the write lock.
+func (t *GenericTrie[V]) touch(key string) {
+	gen := atomic.AddUint64(&t.gen, 1)
+	curr := t.root
+	curr.gen = gen
+	for _, r := range key {
+		if curr = curr.GetLink(r); curr == nil {
+			return
+		}
+		curr.gen = gen
+	}
+}
@@ -0,0 +1,94 @@
+package indexes
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestGenerationNoOps checks that the generation moves with every change and stays put for calls that change nothing
+func TestGenerationNoOps(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	last := tr.Generation()
+	step := func(what string, changed bool) {
+		t.Helper()
+		gen := tr.Generation()
+		if changed && gen <= last {
+			t.Fatalf("Generation after %s = %d, want more than %d", what, gen, last)
+		}
+		if !changed && gen != last {
+			t.Fatalf("Generation after %s = %d, want it unchanged at %d", what, gen, last)
+		}
+		last = gen
+	}
+	tr.Add("alice", a)
+	step("Add", true)
+	tr.Add("Alice", a)
+	step("Add of a stored pair", false)
+	tr.AddMany([]KeyID{{Key: "alice", ID: a}})
+	step("AddMany of a stored pair", false)
+	tr.Remove("alice", b)
+	step("Remove of a missing id", false)
+	tr.Remove("bob", a)
+	step("Remove of a missing key", false)
+	tr.Remove("ali", a)
+	step("Remove at a prefix of a key", false)
+	tr.Rename("bob", "carol")
+	step("Rename of a missing key", false)
+	tr.ReplaceVal("alice", b, a)
+	step("ReplaceVal of a missing id", false)
+	tr.DeleteSubtree("bob")
+	step("DeleteSubtree of a missing prefix", false)
+	tr.RemoveID(b)
+	step("RemoveID of a missing id", false)
+	tr.RemoveMany([]KeyID{{Key: "bob", ID: a}})
+	step("RemoveMany of missing pairs", false)
+	tr.SetWeight("alice", a, 2)
+	tr.RecordHit("alice", a)
+	tr.AddEntry("alice", a, "payload")
+	step("metadata changes", false)
+	tr.Purge()
+	step("Purge without expiring pairs", false)
+
+	tr.Rename("alice", "alicia")
+	step("Rename", true)
+	tr.ReplaceVal("alicia", a, b)
+	step("ReplaceVal", true)
+	tr.Remove("alicia", b)
+	step("Remove", true)
+	tr.Add("bob", a)
+	step("Add", true)
+	tr.Clear()
+	step("Clear", true)
+	other := NewTrie()
+	other.Add("carol", b)
+	tr.Swap(other)
+	step("Swap", true)
+	expect(t, "contents after Swap", tr.Get("carol"), []bson.ObjectId{b})
+}
+
+// TestPrefixGeneration checks that a change moves the generations of the prefixes above it and leaves the others alone
+func TestPrefixGeneration(t *testing.T) {
+	tr := NewTrie()
+	a := objectID(1)
+	tr.Add("alice", a)
+	tr.Add("bob", a)
+	al, bo, root := tr.PrefixGeneration("al"), tr.PrefixGeneration("bo"), tr.PrefixGeneration("")
+	tr.Add("alina", a)
+	if tr.PrefixGeneration("al") == al || tr.PrefixGeneration("") == root {
+		t.Fatal("PrefixGeneration unchanged above an Add")
+	}
+	expect(t, "PrefixGeneration of an unrelated prefix", tr.PrefixGeneration("bo"), bo)
+	al = tr.PrefixGeneration("al")
+	tr.Add("alina", a)
+	tr.Remove("bob", objectID(2))
+	expect(t, "PrefixGeneration after no-ops", []uint64{tr.PrefixGeneration("al"), tr.PrefixGeneration("bo")}, []uint64{al, bo})
+	alice := tr.PrefixGeneration("alice")
+	tr.Remove("alice", a)
+	// The removed key has no node left, so it goes by the ancestor its removal stamped
+	if tr.PrefixGeneration("alice") == alice || tr.PrefixGeneration("al") == al {
+		t.Fatal("PrefixGeneration unchanged by a Remove")
+	}
+	expect(t, "PrefixGeneration of an unrelated prefix after Remove", tr.PrefixGeneration("bo"), bo)
+}
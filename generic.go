@@ -0,0 +1,10 @@
+package indexes
+
+// StringTrie maps keys to string values, such as tags offered for completion, with every feature of Trie. Identical
+// strings stored at one key are kept once, and a key's values come back in lexicographic order.
+type StringTrie = GenericTrie[string]
+
+// NewStringTrie creates an empty StringTrie configured by the given options
+func NewStringTrie(opts ...Option) *StringTrie {
+	return NewGenericTrie[string](opts...)
+}
@@ -0,0 +1,80 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestStringTrie(t *testing.T) {
+	tags := NewStringTrie(WithDiacriticFolding())
+	for _, p := range [][2]string{
+		{"Golang", "go"}, {"golang", "go"}, {"Go", "go"}, {"Gopher", "mascot"}, {"Gopher", "animal"}, {"Müller", "name"},
+	} {
+		tags.Add(p[0], p[1])
+	}
+	expect(t, "Get", tags.Get("GOLANG"), []string{"go"})
+	expect(t, "Get of a key holding several values", tags.Get("gopher"), []string{"animal", "mascot"})
+	expect(t, "GetMany", tags.GetMany("go", 10), []string{"go", "animal", "mascot"})
+	expect(t, "GetMany with folded diacritics", tags.GetMany("mul", 10), []string{"name"})
+	expect(t, "Keys", tags.Keys("go", 10), []string{"Go", "golang", "Gopher"})
+	expect(t, "Count", tags.Count("g"), 3)
+	expect(t, "ValueCount", tags.ValueCount(), 5)
+	expect(t, "Remove", tags.Remove("gopher", "mascot"), true)
+	expect(t, "Remove of a missing value", tags.Remove("gopher", "mascot"), false)
+	expect(t, "Get after Remove", tags.Get("gopher"), []string{"animal"})
+	expect(t, "RemoveAll", tags.RemoveAll("golang"), 1)
+	expect(t, "Has after RemoveAll", tags.Has("golang"), false)
+	expect(t, "GetFuzzy", tags.GetFuzzy("gpher", 1, 10), []string{"animal"})
+}
+
+func TestStringTrieSerialize(t *testing.T) {
+	tags := NewStringTrie()
+	tags.Add("Tag", "b")
+	tags.Add("tag", "a")
+	tags.Add("tags", `with "quotes" and , commas`)
+	tags.Add("émoji", "😀")
+	want := tags.ToMap()
+
+	data, err := json.Marshal(tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "JSON", string(data), `{"tag":["a","b"],"tags":["with \"quotes\" and , commas"],"émoji":["😀"]}`)
+	fromJSON := NewStringTrie()
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "JSON round trip", fromJSON.ToMap(), want)
+
+	data, err = tags.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBinary := NewStringTrie()
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "binary round trip", fromBinary.ToMap(), want)
+
+	var buf bytes.Buffer
+	if err := tags.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGeneric[string](&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "Save and Load", loaded.ToMap(), want)
+	expect(t, "display forms after Load", loaded.Keys("", 10), []string{"tag", "tags", "émoji"})
+
+	buf.Reset()
+	if err := tags.EncodeGob(&buf); err != nil {
+		t.Fatal(err)
+	}
+	fromGob, err := DecodeGobGeneric[string](&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "gob round trip", fromGob.ToMap(), want)
+}
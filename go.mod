@@ -0,0 +1,15 @@
+module github.com/CalvinKorver/go_tree
+
+go 1.18
+
+require (
+	github.com/rivo/uniseg v0.4.7
+	go.mongodb.org/mongo-driver v1.17.1
+	golang.org/x/text v0.17.0
+	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+)
+
+require (
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
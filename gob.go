@@ -0,0 +1,104 @@
+package indexes
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// gobHeader starts a gob encoded Trie
+type gobHeader struct {
+	Version int  // gobVersion at the time of encoding
+	Keys    int  // number of snapshotKey records that follow
+	Codec   byte // tag of the codec the ids are encoded with
+}
+
+// gobVersion is the version of the gob encoding written by EncodeGob. Ids are encoded with their codec, as in binary
+// snapshots, so ObjectIds of either driver read each other's encodings.
+const gobVersion = 1
+
+/*
+EncodeGob writes the Trie to w with encoding/gob, as a header followed by one record per stored key in lexicographic
+order, so that nodes are never encoded recursively however long the keys. Display forms and all per-pair metadata are
+included; payloads stored by AddEntry are encoded as gob interface values, so their concrete types must be registered
+with gob.Register. The read lock is held while writing, so w should not block for long. Options are not encoded.
+*/
+func (t *GenericTrie[V]) EncodeGob(w io.Writer) error {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	enc := gob.NewEncoder(w)
+	codec := codecOf[V]()
+	if err := enc.Encode(gobHeader{Version: gobVersion, Keys: t.keys, Codec: codec.tag}); err != nil {
+		return err
+	}
+	return t.snapshot(func(k snapshotKey[V]) error {
+		rec := snapshotKey[string]{Key: k.Key, Display: k.Display, Pairs: make([]snapshotPair[string], len(k.Pairs))}
+		for i, p := range k.Pairs {
+			id, err := codec.encode(p.ID)
+			if err != nil {
+				return err
+			}
+			rec.Pairs[i] = snapshotPair[string]{ID: string(id), Weight: p.Weight, Hits: p.Hits, HitAt: p.HitAt,
+				Fields: p.Fields, Payload: p.Payload, AddedAt: p.AddedAt, Expires: p.Expires}
+		}
+		return enc.Encode(rec)
+	})
+}
+
+// DecodeGob reads a Trie written by EncodeGob from r. It must be given the options the encoded Trie was created
+// with, since keys are restored in their stored form without being normalized again.
+func DecodeGob(r io.Reader, opts ...Option) (*Trie, error) {
+	return DecodeGobGeneric[bson.ObjectId](r, opts...)
+}
+
+// DecodeGobGeneric is DecodeGob for a GenericTrie, such as a StringTrie
+func DecodeGobGeneric[V comparable](r io.Reader, opts ...Option) (*GenericTrie[V], error) {
+	dec := gob.NewDecoder(r)
+	var h gobHeader
+	if err := dec.Decode(&h); err != nil {
+		return nil, err
+	}
+	codec := codecOf[V]()
+	if h.Version != gobVersion {
+		return nil, fmt.Errorf("indexes: unsupported gob encoding version %d", h.Version)
+	}
+	if h.Codec != codec.tag {
+		return nil, fmt.Errorf("indexes: gob encoding holds values of codec %d, not %d", h.Codec, codec.tag)
+	}
+	t := newTrie[V](newConfig(opts))
+	for i := 0; i < h.Keys; i++ {
+		k, err := decodeGobKey(dec, codec)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if err := t.restore(k); err != nil {
+			return nil, err
+		}
+	}
+	t.startWAL()
+	return t, nil
+}
+
+// decodeGobKey reads the next key record of a gob encoding
+func decodeGobKey[V comparable](dec *gob.Decoder, codec *valueCodec[V]) (snapshotKey[V], error) {
+	var k snapshotKey[V]
+	var rec snapshotKey[string]
+	if err := dec.Decode(&rec); err != nil {
+		return k, err
+	}
+	k = snapshotKey[V]{Key: rec.Key, Display: rec.Display, Pairs: make([]snapshotPair[V], len(rec.Pairs))}
+	for i, p := range rec.Pairs {
+		id, err := codec.decode([]byte(p.ID))
+		if err != nil {
+			return k, err
+		}
+		k.Pairs[i] = snapshotPair[V]{ID: id, Weight: p.Weight, Hits: p.Hits, HitAt: p.HitAt,
+			Fields: p.Fields, Payload: p.Payload, AddedAt: p.AddedAt, Expires: p.Expires}
+	}
+	return k, nil
+}
@@ -0,0 +1,70 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+// encodeGob returns the gob encoding of tr, failing the test on error
+func encodeGob(tb testing.TB, tr *Trie) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	if err := tr.EncodeGob(&buf); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestGobRoundTrip checks that a gob round trip keeps every key, pair and piece of metadata, including a key deep
+// enough to overflow a recursive encoding of the nodes
+func TestGobRoundTrip(t *testing.T) {
+	tr, data := snapshotFixture(t, 500)
+	deep := strings.Repeat("deep", 25000)
+	tr.Add(deep, objectID(1))
+	tr.RecordHit(deep, objectID(1))
+	decoded, err := DecodeGob(bytes.NewReader(encodeGob(t, tr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshalBinary(t, decoded), marshalBinary(t, tr)) {
+		t.Fatal("gob round trip changed the Trie")
+	}
+	for _, prefix := range []string{"", "key 00", "key 0042", "deepdeep"} {
+		expect(t, "GetManyWithKeys("+prefix+")", decoded.GetManyWithKeys(prefix, 1000), tr.GetManyWithKeys(prefix, 1000))
+		expect(t, "GetManyRanked("+prefix+")", decoded.GetManyRanked(prefix, 10), tr.GetManyRanked(prefix, 10))
+	}
+	expect(t, "deep key", decoded.Has(deep), true)
+	decoded.Remove(deep, objectID(1))
+	expect(t, "round trip of the original snapshot", bytes.Equal(marshalBinary(t, decoded), data), true)
+
+	var buf bytes.Buffer
+	gob.NewEncoder(&buf).Encode(gobHeader{Version: gobVersion + 1})
+	if _, err := DecodeGob(&buf); err == nil {
+		t.Fatal("DecodeGob of an unknown version succeeded")
+	}
+	if _, err := DecodeGob(bytes.NewReader(encodeGob(t, tr)[:200])); err == nil {
+		t.Fatal("DecodeGob of a truncated encoding succeeded")
+	}
+}
+
+// BenchmarkGob measures encoding and decoding a 1M-key Trie with gob, reporting the size of the encoding
+func BenchmarkGob(b *testing.B) {
+	tr := largeTrie(b, 1000000)
+	data := encodeGob(b, tr)
+	b.Run("encode", func(b *testing.B) {
+		b.ReportMetric(float64(len(data)), "bytes")
+		for i := 0; i < b.N; i++ {
+			encodeGob(b, tr)
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		b.ReportMetric(float64(len(data)), "bytes")
+		for i := 0; i < b.N; i++ {
+			if _, err := DecodeGob(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
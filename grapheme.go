@@ -0,0 +1,123 @@
+package indexes
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rivo/uniseg"
+)
+
+/*
+clusterState is what joins needs to know about the runes before a position to tell whether the next rune starts a new
+grapheme cluster: the cluster in progress there. The Unicode extended grapheme cluster rules (UAX #29) never look back
+past the start of the cluster in progress, so segmenting it followed by the next rune with uniseg decides the boundary
+as segmenting the whole key would.
+*/
+type clusterState struct {
+	cluster string // the grapheme cluster ending at the position, "" at the start of a key
+}
+
+// clusterStateOf returns the state after runes
+func clusterStateOf(runes []rune) clusterState {
+	var s clusterState
+	state := -1
+	for rest := string(runes); rest != ""; {
+		s.cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+	}
+	return s
+}
+
+// push returns the state after r
+func (s clusterState) push(r rune) clusterState {
+	if s.joins(r) {
+		return clusterState{s.cluster + string(r)}
+	}
+	return clusterState{string(r)}
+}
+
+// joins reports whether r continues the grapheme cluster in progress rather than starting a new one
+func (s clusterState) joins(r rune) bool {
+	if s.cluster == "" {
+		return false
+	}
+	cluster, _, _, _ := uniseg.FirstGraphemeClusterInString(s.cluster+string(r), -1)
+	return len(cluster) > len(s.cluster)
+}
+
+// boundaryView returns curr as seen by a prefix query ending at a cluster boundary in state s: the children whose rune
+// would continue the cluster are hidden. If there are none curr itself is returned, otherwise a shallow copy sharing
+// curr's values, which must only be read.
+func boundaryView[V comparable](curr *GenericNode[V], s clusterState) *GenericNode[V] {
+	if curr == nil {
+		return nil
+	}
+	var view *GenericNode[V]
+	for r, link := range curr.link {
+		if link == nil || !s.joins(r) {
+			continue
+		}
+		if view == nil {
+			view = &GenericNode[V]{link: make(map[rune]*GenericNode[V], len(curr.link)), IDSet: curr.IDSet, meta: curr.meta, display: curr.display}
+			for r, link := range curr.link {
+				view.link[r] = link
+			}
+		}
+		delete(view.link, r)
+	}
+	if view == nil {
+		return curr
+	}
+	return view
+}
+
+// prefixTip returns the node below which the keys starting with the normalized prefix are found. With
+// WithGraphemeClusters, keys in which the prefix ends partway through a grapheme cluster are hidden from the result.
+func (t *GenericTrie[V]) prefixTip(prefix string) *GenericNode[V] {
+	curr := findTip(prefix, t.root)
+	if !t.cfg.graphemes || prefix == "" {
+		return curr
+	}
+	return boundaryView(curr, clusterStateOf([]rune(prefix)))
+}
+
+// hasKeyPrefix reports whether the stored key starts with the normalized prefix the way prefixTip sees it
+func (t *GenericTrie[V]) hasKeyPrefix(key, prefix string) bool {
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+	if !t.cfg.graphemes || prefix == "" || len(key) == len(prefix) {
+		return true
+	}
+	next := []rune(key[len(prefix):])[0]
+	return !clusterStateOf([]rune(prefix)).joins(next)
+}
+
+// nextClusters lists the grapheme clusters that can follow prefix below its boundary view curr, for NextCharacters,
+// leaving out the pairs expired at now
+func nextClusters[V comparable](curr *GenericNode[V], prefix []rune, now time.Time) []RuneCount {
+	counts := []RuneCount{}
+	start := clusterStateOf(prefix)
+	type frame struct {
+		node    *GenericNode[V]
+		cluster string
+		state   clusterState
+	}
+	for _, r := range curr.GetAllRunes() {
+		// Follow the runes that extend the cluster r starts, listing each cluster that ends with ids below it
+		stack := []frame{{curr.GetLink(r), string(r), start.push(r)}}
+		for len(stack) > 0 {
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if count := countIDs(boundaryView(f.node, f.state), now); count != 0 {
+				counts = append(counts, RuneCount{Rune: r, Count: count, Cluster: f.cluster})
+			}
+			runes := f.node.GetAllRunes()
+			for i := len(runes) - 1; i >= 0; i-- {
+				if f.state.joins(runes[i]) {
+					stack = append(stack, frame{f.node.GetLink(runes[i]), f.cluster + string(runes[i]), f.state.push(runes[i])})
+				}
+			}
+		}
+	}
+	return counts
+}
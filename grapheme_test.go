@@ -0,0 +1,92 @@
+package indexes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/rivo/uniseg"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestClusterState checks that pushing runes one at a time finds the cluster boundaries uniseg finds in the whole string
+func TestClusterState(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	runes := []rune("ae\r\ń‍각👍🏽👩💻🇫🇷🏴\U000e0067\U000e007f️")
+	for i := 0; i < 2000; i++ {
+		s := make([]rune, 1+rng.Intn(8))
+		for j := range s {
+			s[j] = runes[rng.Intn(len(runes))]
+		}
+		var want []string
+		for g := uniseg.NewGraphemes(string(s)); g.Next(); {
+			want = append(want, g.Str())
+		}
+		var got []string
+		var state clusterState
+		for _, r := range s {
+			if state.joins(r) {
+				got[len(got)-1] += string(r)
+			} else {
+				got = append(got, string(r))
+			}
+			state = state.push(r)
+		}
+		expect(t, fmt.Sprintf("clusters of %+q", string(s)), got, want)
+		expect(t, fmt.Sprintf("clusterStateOf(%+q)", string(s)), clusterStateOf(s), state)
+	}
+}
+
+func TestGraphemeClusters(t *testing.T) {
+	tr := NewTrie(WithGraphemeClusters())
+	a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+	tr.Add("👍", a)
+	tr.Add("👍🏽", b)
+	// A Hangul syllable spelled out in conjoining jamo, which is a single cluster
+	tr.Add("각", c)
+	tr.Add("é", d)
+	expect(t, "GetMany of a cluster prefixing a longer one", tr.GetMany("👍", 10), []bson.ObjectId{a})
+	expect(t, "GetMany partway through conjoining jamo", tr.GetMany("ᄀ", 10), []bson.ObjectId{})
+	expect(t, "GetMany of the whole syllable", tr.GetMany("각", 10), []bson.ObjectId{c})
+	expect(t, "Keys before a combining accent", tr.Keys("e", 10), []string{})
+	expect(t, "Keys of everything", tr.Keys("", 10), []string{"é", "각", "👍", "👍🏽"})
+	expect(t, "NextCharacters", tr.NextCharacters(""), []RuneCount{
+		{Rune: 'e', Count: 1, Cluster: "é"},
+		{Rune: 'ᄀ', Count: 1, Cluster: "각"},
+		{Rune: '👍', Count: 1, Cluster: "👍"},
+		{Rune: '👍', Count: 1, Cluster: "👍🏽"},
+	})
+	expect(t, "Match of one cluster", tr.Match("?", 10), []bson.ObjectId{d, c, a, b})
+	key, _, ok := tr.LongestPrefixMatch("👍🏽!")
+	expect(t, "LongestPrefixMatch", []interface{}{key, ok}, []interface{}{"👍🏽", true})
+	expect(t, "DeleteSubtree keeping longer clusters", tr.DeleteSubtree("👍"), 1)
+	expect(t, "contents after DeleteSubtree", tr.Get("👍🏽"), []bson.ObjectId{b})
+}
+
+// BenchmarkGraphemeClusters compares prefix queries with and without WithGraphemeClusters
+func BenchmarkGraphemeClusters(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	runes := []rune("abcdeé́👍🏽🇫🇷")
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{{"runes", nil}, {"clusters", []Option{WithGraphemeClusters()}}} {
+		tr := NewTrie(mode.opts...)
+		var prefixes []string
+		for i := 0; i < 10000; i++ {
+			key := randomKey(rng, runes)
+			tr.Add(key, objectID(i))
+			prefixes = append(prefixes, string([]rune(key)[:1+rng.Intn(len([]rune(key)))]))
+		}
+		b.Run("GetMany/"+mode.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tr.GetMany(prefixes[i%len(prefixes)], 10)
+			}
+		})
+		b.Run("NextCharacters/"+mode.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tr.NextCharacters(prefixes[i%len(prefixes)])
+			}
+		})
+	}
+}
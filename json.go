@@ -0,0 +1,109 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+MarshalJSON encodes the Trie as an object mapping every stored key, in its normalized form, to the array of its ids as
+24-character hex strings, such as {"bob":["5f1d7a..."]}. Keys come out in sorted order and each key's ids in ObjectId
+order, so the output of an unchanged Trie is stable and diffs well. Only keys and ids are encoded: display forms and
+per-pair metadata such as weights and payloads are left out, as are expired pairs; use EncodeGob to keep them. With
+WithBinaryKeys the keys are written as the standard base64 encoding of their bytes, since JSON strings cannot hold
+arbitrary bytes. It walks under the read lock.
+*/
+func (t *GenericTrie[V]) MarshalJSON() ([]byte, error) {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	codec := codecOf[V]()
+	now := t.cutoff()
+	err := t.snapshot(func(k snapshotKey[V]) error {
+		live := k.Pairs[:0]
+		for _, p := range k.Pairs {
+			if now.IsZero() || p.Expires.IsZero() || now.Before(p.Expires) {
+				live = append(live, p)
+			}
+		}
+		if k.Pairs = live; len(live) == 0 {
+			return nil
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, err := json.Marshal(t.jsonKey(k.Key))
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteString(":[")
+		for i, p := range k.Pairs {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			id, err := codec.marshalJSON(p.ID)
+			if err != nil {
+				return err
+			}
+			buf.Write(id)
+		}
+		buf.WriteByte(']')
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonKey returns the already normalized key as MarshalJSON writes it
+func (t *GenericTrie[V]) jsonKey(key string) string {
+	if t.cfg.binaryKeys {
+		return base64.StdEncoding.EncodeToString([]byte(t.cfg.givenKey(key)))
+	}
+	return key
+}
+
+/*
+UnmarshalJSON replaces the contents of the Trie with those of an object written by MarshalJSON. Keys are normalized
+with the Trie's options, so hand-written input may use any casing. An invalid hex id fails with an error naming its key,
+as does an empty key, and leaves the Trie unchanged. The new contents are built off to the side and installed under a
+brief write lock, like Swap. A zero Trie may be unmarshaled into, and is then configured with the defaults.
+*/
+func (t *GenericTrie[V]) UnmarshalJSON(data []byte) error {
+	var m map[string][]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	codec := codecOf[V]()
+	fresh := newTrie[V](t.cfg)
+	for key, raws := range m {
+		if t.cfg.binaryKeys {
+			b, err := base64.StdEncoding.DecodeString(key)
+			if err != nil {
+				return fmt.Errorf("indexes: key %q: %w", key, err)
+			}
+			key = string(b)
+		}
+		stored, err := fresh.storedKey(key)
+		if err != nil {
+			return fmt.Errorf("indexes: key %q: %w", key, err)
+		}
+		for _, raw := range raws {
+			id, err := codec.unmarshalJSON(raw)
+			if err != nil {
+				return fmt.Errorf("indexes: key %q: %w", key, err)
+			}
+			fresh.insert(stored, key, id)
+		}
+	}
+	t.replace(fresh)
+	return nil
+}
@@ -0,0 +1,152 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the golden file testdata/name, rewriting the file instead with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s differs from its golden file:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// binaryKeys are keys no JSON string can hold as bytes
+var binaryKeys = []string{"\xff\x01", "\x00", "a\x00b", "\xc3\xbf", "plain"}
+
+func TestJSON(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("Zed", objectID(2))
+	tr.Add("zed", objectID(1))
+	tr.Add(`al"x`, objectID(1))
+	tr.Add("Émile", objectID(3))
+	data, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "trie.json", data)
+	var fromJSON Trie
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "round trip", fromJSON.ToMap(), tr.ToMap())
+
+	err = json.Unmarshal([]byte(`{"bob":["zz"]}`), &fromJSON)
+	if err == nil || !strings.Contains(err.Error(), `"bob"`) {
+		t.Fatalf("Unmarshal of an invalid id = %v, want an error naming its key", err)
+	}
+	expect(t, "contents after a failed Unmarshal", fromJSON.ToMap(), tr.ToMap())
+}
+
+func TestJSONBinaryKeys(t *testing.T) {
+	tr := NewTrie(WithBinaryKeys())
+	want := map[string][]bson.ObjectId{}
+	for i, key := range binaryKeys {
+		tr.Add(key, objectID(i))
+		want[key] = []bson.ObjectId{objectID(i)}
+	}
+	data, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "binarykeys.json", data)
+	fromJSON := NewTrie(WithBinaryKeys())
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "round trip", fromJSON.ToMap(), want)
+	expect(t, "Get after the round trip", fromJSON.Get("\xff\x01"), []bson.ObjectId{objectID(0)})
+
+	err = json.Unmarshal([]byte(`{"not base64!":["5f0000000000000000000001"]}`), fromJSON)
+	if err == nil || !strings.Contains(err.Error(), `"not base64!"`) {
+		t.Fatalf("Unmarshal of a key that is not base64 = %v, want an error naming it", err)
+	}
+}
+
+func TestExportBinaryKeys(t *testing.T) {
+	tr := NewTrie(WithBinaryKeys())
+	for i, key := range binaryKeys {
+		tr.Add(key, objectID(i))
+	}
+	exported := tr.Export()
+	expect(t, "Export", exported, tr.ToMap())
+	imported := NewTrie(WithBinaryKeys())
+	expect(t, "Import", imported.Import(exported, true), len(binaryKeys))
+	expect(t, "Export after Import", imported.Export(), exported)
+	fromMap := NewTrieFromMap(tr.ToMap(), WithBinaryKeys())
+	expect(t, "NewTrieFromMap of ToMap", fromMap.ToMap(), exported)
+	expect(t, "Keys", fromMap.Keys("\xff", 10), []string{"\xff\x01"})
+}
+
+// TestExportImportRandom checks on random contents that Import of an Export rebuilds the same Trie, that Export of an
+// Import returns the map imported, and that the exported slices are the caller's own
+func TestExportImportRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	letters := []rune("abcAé")
+	for i := 0; i < 50; i++ {
+		tr := NewTrie()
+		pairs := 0
+		for j := rng.Intn(200); j > 0; j-- {
+			if added, _ := tr.Add(randomKey(rng, letters), objectID(rng.Intn(50))); added {
+				pairs++
+			}
+		}
+		exported := tr.Export()
+		imported := NewTrie()
+		imported.Add("stale", objectID(1))
+		expect(t, fmt.Sprintf("Import %d", i), imported.Import(exported, true), pairs)
+		expect(t, fmt.Sprintf("Export after Import %d", i), imported.Export(), exported)
+		expect(t, fmt.Sprintf("ToMap after Import %d", i), imported.ToMap(), tr.ToMap())
+		expect(t, fmt.Sprintf("Import %d again", i), imported.Import(exported, false), 0)
+
+		sets := map[string]map[bson.ObjectId]bool{}
+		for j := rng.Intn(100); j > 0; j-- {
+			key := strings.ToLower(randomKey(rng, letters))
+			if sets[key] == nil {
+				sets[key] = map[bson.ObjectId]bool{}
+			}
+			sets[key][objectID(rng.Intn(50))] = true
+		}
+		m := map[string][]bson.ObjectId{}
+		for key, set := range sets {
+			for id := range set {
+				m[key] = append(m[key], id)
+			}
+			m[key] = sortedIDs(m[key])
+		}
+		fromMap := NewTrie()
+		fromMap.Import(m, false)
+		expect(t, fmt.Sprintf("Export of an imported map %d", i), fromMap.Export(), m)
+	}
+
+	tr := NewTrie()
+	tr.Add("a", objectID(1))
+	exported := tr.Export()
+	exported["a"][0] = objectID(2)
+	exported["b"] = []bson.ObjectId{objectID(3)}
+	expect(t, "Export after changing an exported map", tr.Export(), map[string][]bson.ObjectId{"a": {objectID(1)}})
+}
@@ -0,0 +1,95 @@
+package indexes
+
+import (
+	"sort"
+)
+
+// keyTrie files the keys of a Trie under derived strings, such as every suffix of each key, and backs the optional
+// auxiliary indexes. Its nodes hold a set of keys rather than ids, so a key is filed once however many ids it holds.
+type keyTrie struct {
+	root *keyNode
+}
+
+type keyNode struct {
+	link map[rune]*keyNode
+	keys map[string]struct{}
+}
+
+func newKeyNode() *keyNode {
+	return &keyNode{link: make(map[rune]*keyNode), keys: make(map[string]struct{})}
+}
+
+func newKeyTrie() *keyTrie {
+	return &keyTrie{root: newKeyNode()}
+}
+
+// add files key under path
+func (kt *keyTrie) add(path []rune, key string) {
+	curr := kt.root
+	for _, r := range path {
+		next := curr.link[r]
+		if next == nil {
+			next = newKeyNode()
+			curr.link[r] = next
+		}
+		curr = next
+	}
+	curr.keys[key] = struct{}{}
+}
+
+// remove unfiles key from path, pruning nodes left with neither keys nor children
+func (kt *keyTrie) remove(path []rune, key string) {
+	nodes := make([]*keyNode, 0, len(path)+1)
+	curr := kt.root
+	nodes = append(nodes, curr)
+	for _, r := range path {
+		curr = curr.link[r]
+		if curr == nil {
+			return
+		}
+		nodes = append(nodes, curr)
+	}
+	delete(curr.keys, key)
+	for i := len(nodes) - 1; i > 0; i-- {
+		if len(nodes[i].keys) != 0 || len(nodes[i].link) != 0 {
+			return
+		}
+		delete(nodes[i-1].link, path[i-1])
+	}
+}
+
+// collect calls visit with every key filed under a path starting with prefix, ordered by path and then by key,
+// until visit returns false. A key filed under several such paths is visited once for each.
+func (kt *keyTrie) collect(prefix []rune, visit func(key string) bool) {
+	curr := kt.root
+	for _, r := range prefix {
+		curr = curr.link[r]
+		if curr == nil {
+			return
+		}
+	}
+	stack := []*keyNode{curr}
+	for len(stack) > 0 {
+		curr = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		keys := make([]string, 0, len(curr.keys))
+		for key := range curr.keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !visit(key) {
+				return
+			}
+		}
+		runes := make([]rune, 0, len(curr.link))
+		for r := range curr.link {
+			runes = append(runes, r)
+		}
+		// Push the children in descending order so they are popped in ascending rune order
+		sort.Slice(runes, func(i, j int) bool { return runes[i] > runes[j] })
+		for _, r := range runes {
+			stack = append(stack, curr.link[r])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package indexes
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LoadOption configures LoadCSV and LoadNDJSON
+type LoadOption func(*loadConfig)
+
+type loadConfig struct {
+	skipMalformed bool
+	skipped       *int
+}
+
+// SkipMalformed makes the loaders skip malformed records instead of failing, counting them in *skipped if it is not nil
+func SkipMalformed(skipped *int) LoadOption {
+	return func(c *loadConfig) {
+		c.skipMalformed = true
+		c.skipped = skipped
+	}
+}
+
+// malformed reports err for the record at line, or counts it and returns nil when malformed records are skipped
+func (c *loadConfig) malformed(line int, err error) error {
+	if !c.skipMalformed {
+		return fmt.Errorf("indexes: line %d: %v", line, err)
+	}
+	if c.skipped != nil {
+		*c.skipped++
+	}
+	return nil
+}
+
+// addRecord validates a (key, hex id) record and adds it to the Trie
+func (t *GenericTrie[V]) addRecord(key, hex string) error {
+	id, err := codecOf[V]().parse(hex)
+	if err != nil {
+		return err
+	}
+	_, err = t.Add(key, id)
+	return err
+}
+
+/*
+LoadCSV streams CSV records of the form key,hex-objectid from r and adds each pair to the Trie, returning the number of
+records added. Records are read one at a time, so arbitrarily large inputs are never buffered in memory. A malformed
+record (wrong field count, bad quoting, invalid ObjectId or empty key) fails the load with an error naming its line,
+unless SkipMalformed is given.
+*/
+func (t *GenericTrie[V]) LoadCSV(r io.Reader, opts ...LoadOption) (int, error) {
+	var cfg loadConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.ReuseRecord = true
+	added := 0
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return added, nil
+		}
+		var line int
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return added, err
+			}
+			line = perr.Line
+		} else {
+			line, _ = cr.FieldPos(0)
+			err = t.addRecord(record[0], strings.TrimSpace(record[1]))
+		}
+		if err != nil {
+			if err = cfg.malformed(line, err); err != nil {
+				return added, err
+			}
+			continue
+		}
+		added++
+	}
+}
+
+// ndjsonRecord is one line of the input to LoadNDJSON
+type ndjsonRecord struct {
+	Key string `json:"key"`
+	ID  string `json:"id"`
+}
+
+/*
+LoadNDJSON streams newline-delimited JSON records of the form {"key": "...", "id": "<hex objectid>"} from r and adds
+each pair to the Trie, returning the number of records added. Blank lines are ignored. Lines are read one at a time,
+so arbitrarily large inputs are never buffered in memory. A malformed record fails the load with an error naming its
+line, unless SkipMalformed is given.
+*/
+func (t *GenericTrie[V]) LoadNDJSON(r io.Reader, opts ...LoadOption) (int, error) {
+	var cfg loadConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	br := bufio.NewReader(r)
+	added := 0
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return added, err
+		}
+		if strings.TrimSpace(text) != "" {
+			var rec ndjsonRecord
+			recErr := json.Unmarshal([]byte(text), &rec)
+			if recErr == nil {
+				recErr = t.addRecord(rec.Key, rec.ID)
+			}
+			if recErr == nil {
+				added++
+			} else if recErr = cfg.malformed(line, recErr); recErr != nil {
+				return added, recErr
+			}
+		}
+		if err == io.EOF {
+			return added, nil
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package indexes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestLoadCSV(t *testing.T) {
+	a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+	input := fmt.Sprintf("alpha,%s\n\n\"Smith, John\",%s\n\"say \"\"hi\"\"\", %s\n\"two\nlines\",%s", a.Hex(), b.Hex(), c.Hex(), d.Hex())
+	tr := NewTrie()
+	added, err := tr.LoadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "records added", added, 4)
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{
+		"alpha":       {a},
+		"smith, john": {b},
+		`say "hi"`:    {c},
+		"two\nlines":  {d},
+	})
+	long := strings.Repeat("x", 100000)
+	tr = NewTrie()
+	if _, err := tr.LoadCSV(strings.NewReader(long + "," + a.Hex() + "\nbeta," + b.Hex())); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "contents after a long line", tr.ToMap(), map[string][]bson.ObjectId{long: {a}, "beta": {b}})
+
+	for _, m := range []struct {
+		name, input, line string
+	}{
+		{"an invalid ObjectId", "alpha," + a.Hex() + "\nbeta,not hex\n", "line 2"},
+		{"a short ObjectId", "alpha," + a.Hex()[:20] + "\n", "line 1"},
+		{"an empty key", "alpha," + a.Hex() + "\n\n  ," + b.Hex() + "\n", "line 3"},
+		{"a missing field", "\"multi\nline\"," + a.Hex() + "\nbeta\n", "line 3"},
+		{"an extra field", "alpha," + a.Hex() + ",x\n", "line 1"},
+		{"bad quoting", "alpha," + a.Hex() + "\nbe\"ta," + b.Hex() + "\n", "line 2"},
+	} {
+		_, err := NewTrie().LoadCSV(strings.NewReader(m.input))
+		if err == nil || !strings.Contains(err.Error(), m.line) {
+			t.Fatalf("LoadCSV of %s = %v, want an error naming %s", m.name, err, m.line)
+		}
+	}
+
+	skipped := 0
+	tr = NewTrie()
+	input = fmt.Sprintf("alpha,%s\nbeta,zz\ngamma\n,%s\ndelta,%s,x\nepsilon,%s\n", a.Hex(), b.Hex(), c.Hex(), d.Hex())
+	added, err = tr.LoadCSV(strings.NewReader(input), SkipMalformed(&skipped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "records added skipping malformed ones", added, 2)
+	expect(t, "records skipped", skipped, 4)
+	expect(t, "contents after skipping", tr.ToMap(), map[string][]bson.ObjectId{"alpha": {a}, "epsilon": {d}})
+}
+
+func TestLoadNDJSON(t *testing.T) {
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	long := strings.Repeat("x", 100000)
+	input := fmt.Sprintf("{\"key\": \"alpha\", \"id\": %q}\n\n   \n{\"key\": %q, \"id\": %q}\n{\"key\": \"gamma\", \"id\": %q}",
+		a.Hex(), long, b.Hex(), c.Hex())
+	tr := NewTrie()
+	added, err := tr.LoadNDJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "records added", added, 3)
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{"alpha": {a}, long: {b}, "gamma": {c}})
+
+	for _, m := range []struct {
+		name, input, line string
+	}{
+		{"an invalid ObjectId", fmt.Sprintf("{\"key\": \"a\", \"id\": %q}\n{\"key\": \"b\", \"id\": \"zz\"}\n", a.Hex()), "line 2"},
+		{"an empty key", fmt.Sprintf("\n\n{\"key\": \" \", \"id\": %q}\n", a.Hex()), "line 3"},
+		{"a missing id", "{\"key\": \"a\"}\n", "line 1"},
+		{"invalid JSON after a long line", fmt.Sprintf("{\"key\": %q, \"id\": %q}\n{\"key\": \n", long, a.Hex()), "line 2"},
+		{"a trailing line without a newline", fmt.Sprintf("{\"key\": \"a\", \"id\": %q}\n[]", a.Hex()), "line 2"},
+	} {
+		_, err := NewTrie().LoadNDJSON(strings.NewReader(m.input))
+		if err == nil || !strings.Contains(err.Error(), m.line) {
+			t.Fatalf("LoadNDJSON of %s = %v, want an error naming %s", m.name, err, m.line)
+		}
+	}
+
+	skipped := 0
+	tr = NewTrie()
+	input = fmt.Sprintf("{\"key\": \"a\", \"id\": %q}\nnot json\n{\"key\": \"b\", \"id\": \"zz\"}\n\n{\"key\": \"c\", \"id\": %q}\n{",
+		a.Hex(), c.Hex())
+	added, err = tr.LoadNDJSON(strings.NewReader(input), SkipMalformed(&skipped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "records added skipping malformed ones", added, 2)
+	expect(t, "records skipped", skipped, 3)
+	expect(t, "contents after skipping", tr.ToMap(), map[string][]bson.ObjectId{"a": {a}, "c": {c}})
+	if _, err := NewTrie().LoadNDJSON(strings.NewReader("not json\n"), SkipMalformed(nil)); err != nil {
+		t.Fatalf("SkipMalformed(nil) = %v", err)
+	}
+}
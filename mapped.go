@@ -0,0 +1,371 @@
+package indexes
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ErrNotMapped is returned by OpenMapped for a file that is not a trie written by WriteMapped
+var ErrNotMapped = errors.New("indexes: not a mapped trie file")
+
+/*
+The mapped trie layout written by WriteMapped is immutable and read in place, all integers little-endian:
+
+	header, mappedHeaderSize bytes:  magic "GTRM", uint32 version, uint64 root node offset, uint64 id count
+	ids:  every id as 12 raw bytes, those of each node contiguous and in ObjectId order
+	nodes:  one record per node, children before their parent, so the root comes last:
+		uint32 child count, uint32 id count, uint64 index of the node's first id, uint32 display length
+		the children, sorted by rune: uint32 rune, uint64 node offset
+		the display form of the node's key, if it differs from the stored form
+*/
+const (
+	mappedMagic      = "GTRM"
+	mappedVersion    = 1
+	mappedHeaderSize = 4 + 4 + 8 + 8
+	mappedNodeSize   = 4 + 4 + 8 + 4
+	mappedChildSize  = 4 + 8
+	mappedIDSize     = 12
+)
+
+/*
+WriteMapped writes the Trie in the mapped layout read by OpenMapped, under the read lock. Nodes are written children
+first, so the Trie is walked once holding no more than one path of nodes; w only needs to support writing at offsets,
+such as an *os.File, and is written in chunks of 64 KiB. Expired pairs are left out, and ids that are not 12 bytes long cannot be written and fail with ErrInvalidObjectID.
+Only ObjectIds of either driver can be written; a ReadonlyTrie returns them as bson.ObjectIds.
+*/
+func (t *GenericTrie[V]) WriteMapped(w io.WriterAt) error {
+	codec := codecOf[V]()
+	if codec.tag != codecObjectID {
+		return ErrInvalidObjectID
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	type frame struct {
+		node     *GenericNode[V]
+		runes    []rune
+		children []uint64 // offsets of the children written so far
+	}
+	le := binary.LittleEndian
+	now := t.cutoff()
+	ids := &chunkWriter{w: w, off: mappedHeaderSize}
+	nodes := &chunkWriter{w: w, off: int64(mappedHeaderSize) + int64(t.vals)*mappedIDSize}
+	var count uint64   // ids written so far
+	var written uint64 // offset of the node written last
+	stack := []*frame{{node: t.root, runes: t.root.GetAllRunes()}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		if len(f.children) < len(f.runes) {
+			child := f.node.GetLink(f.runes[len(f.children)])
+			stack = append(stack, &frame{node: child, runes: child.GetAllRunes()})
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		vals := f.node.liveVals(now)
+		first := count
+		for _, id := range vals {
+			b, err := codec.encode(id)
+			if err != nil {
+				return err
+			}
+			if err := ids.write(b); err != nil {
+				return err
+			}
+			count++
+		}
+		rec := make([]byte, mappedNodeSize+len(f.runes)*mappedChildSize+len(f.node.display))
+		le.PutUint32(rec[0:], uint32(len(f.runes)))
+		le.PutUint32(rec[4:], uint32(len(vals)))
+		le.PutUint64(rec[8:], first)
+		le.PutUint32(rec[16:], uint32(len(f.node.display)))
+		for i, r := range f.runes {
+			at := mappedNodeSize + i*mappedChildSize
+			le.PutUint32(rec[at:], uint32(r))
+			le.PutUint64(rec[at+4:], f.children[i])
+		}
+		copy(rec[mappedNodeSize+len(f.runes)*mappedChildSize:], f.node.display)
+		written = uint64(nodes.next())
+		if err := nodes.write(rec); err != nil {
+			return err
+		}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, written)
+		}
+	}
+	if err := ids.flush(); err != nil {
+		return err
+	}
+	if err := nodes.flush(); err != nil {
+		return err
+	}
+	header := make([]byte, mappedHeaderSize)
+	copy(header, mappedMagic)
+	le.PutUint32(header[4:], mappedVersion)
+	le.PutUint64(header[8:], written)
+	le.PutUint64(header[16:], count)
+	_, err := w.WriteAt(header, 0)
+	return err
+}
+
+// mappedChunkSize is the number of bytes WriteMapped buffers before writing them to the file in one call
+const mappedChunkSize = 1 << 16
+
+// chunkWriter writes consecutive bytes of a region of w from off on, buffered into chunks of mappedChunkSize bytes
+type chunkWriter struct {
+	w   io.WriterAt
+	off int64 // offset of the first buffered byte
+	buf []byte
+}
+
+// next returns the offset the next byte written will land at
+func (c *chunkWriter) next() int64 {
+	return c.off + int64(len(c.buf))
+}
+
+func (c *chunkWriter) write(b []byte) error {
+	if len(c.buf)+len(b) > mappedChunkSize {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	c.buf = append(c.buf, b...)
+	return nil
+}
+
+// flush writes the buffered bytes
+func (c *chunkWriter) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	if _, err := c.w.WriteAt(c.buf, c.off); err != nil {
+		return err
+	}
+	c.off += int64(len(c.buf))
+	c.buf = c.buf[:0]
+	return nil
+}
+
+/*
+ReadonlyTrie answers queries directly against a file written by WriteMapped and mapped into memory by OpenMapped, so
+opening even a very large index costs neither load time nor heap: nodes are read in place, children are found by
+binary search in their sorted tables, and only results are allocated. It cannot be modified; keep recent changes in a
+small Trie alongside it if needed. A ReadonlyTrie is safe for concurrent use until Close is called.
+*/
+type ReadonlyTrie struct {
+	data  []byte
+	root  uint64
+	ids   uint64
+	cfg   config
+	unmap func() error
+}
+
+// mappedNode is a node record of a ReadonlyTrie, decoded from its fixed-size part
+type mappedNode struct {
+	off      uint64 // offset of the record
+	children uint32
+	vals     uint32
+	first    uint64 // index of the first id
+	display  uint32 // length of the display form
+}
+
+/*
+OpenMapped maps the file at path, written by WriteMapped, and returns a ReadonlyTrie reading it. It must be given the
+key options of the Trie that was written, since lookups normalize their input the same way, and WithGraphemeClusters
+for GetMany and Keys to match prefixes on grapheme cluster boundaries as the Trie did. The file must not change
+while it is open; on systems without memory mapping it is read into memory instead. Files that are not mapped tries fail
+with ErrNotMapped.
+*/
+func OpenMapped(path string, opts ...Option) (*ReadonlyTrie, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rt := &ReadonlyTrie{data: data, cfg: newConfig(opts), unmap: unmap}
+	if rt.cfg.binaryKeys {
+		rt.cfg.graphemes = false
+	}
+	le := binary.LittleEndian
+	if len(data) < mappedHeaderSize || string(data[:4]) != mappedMagic || le.Uint32(data[4:]) != mappedVersion {
+		unmap()
+		return nil, ErrNotMapped
+	}
+	rt.root, rt.ids = le.Uint64(data[8:]), le.Uint64(data[16:])
+	if rt.ids > uint64(len(data)-mappedHeaderSize)/mappedIDSize {
+		unmap()
+		return nil, ErrNotMapped
+	}
+	if _, ok := rt.node(rt.root); !ok {
+		unmap()
+		return nil, ErrNotMapped
+	}
+	return rt, nil
+}
+
+// Close unmaps the file. The ReadonlyTrie must not be used afterwards.
+func (rt *ReadonlyTrie) Close() error {
+	rt.data = nil
+	return rt.unmap()
+}
+
+// node decodes the record at off, reporting false if it does not lie within the file
+func (rt *ReadonlyTrie) node(off uint64) (mappedNode, bool) {
+	if off < mappedHeaderSize || off > uint64(len(rt.data)) || uint64(len(rt.data))-off < mappedNodeSize {
+		return mappedNode{}, false
+	}
+	le := binary.LittleEndian
+	rec := rt.data[off:]
+	n := mappedNode{off: off, children: le.Uint32(rec), vals: le.Uint32(rec[4:]), first: le.Uint64(rec[8:]), display: le.Uint32(rec[16:])}
+	size := uint64(mappedNodeSize) + uint64(n.children)*mappedChildSize + uint64(n.display)
+	if uint64(len(rec)) < size || n.first > rt.ids || uint64(n.vals) > rt.ids-n.first {
+		return mappedNode{}, false
+	}
+	return n, true
+}
+
+// child returns the i-th child of n and its rune
+func (rt *ReadonlyTrie) child(n mappedNode, i int) (rune, uint64) {
+	at := n.off + mappedNodeSize + uint64(i)*mappedChildSize
+	return rune(binary.LittleEndian.Uint32(rt.data[at:])), binary.LittleEndian.Uint64(rt.data[at+4:])
+}
+
+// tip follows the already normalized prefix from the root, reporting false if no key starts with it
+func (rt *ReadonlyTrie) tip(prefix string) (mappedNode, bool) {
+	n, ok := rt.node(rt.root)
+	for _, r := range prefix {
+		if !ok {
+			break
+		}
+		// Binary search for r in the sorted child table
+		lo, hi := 0, int(n.children)
+		for lo < hi {
+			mid := int(uint(lo+hi) >> 1)
+			if c, _ := rt.child(n, mid); c < r {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		if lo == int(n.children) {
+			return mappedNode{}, false
+		}
+		c, off := rt.child(n, lo)
+		if c != r {
+			return mappedNode{}, false
+		}
+		n, ok = rt.node(off)
+	}
+	return n, ok
+}
+
+// id returns the i-th id of n
+func (rt *ReadonlyTrie) id(n mappedNode, i int) bson.ObjectId {
+	at := mappedHeaderSize + (n.first+uint64(i))*mappedIDSize
+	return bson.ObjectId(rt.data[at : at+mappedIDSize])
+}
+
+// walk visits n, the tip of prefix, and its descendants in lexicographic key order like walk, until visit returns
+// false. With WithGraphemeClusters the children of n continuing the last grapheme cluster of prefix are skipped, as
+// prefixTip hides them. The key slice is only valid during the call.
+func (rt *ReadonlyTrie) walk(n mappedNode, prefix []rune, visit func(key []rune, n mappedNode) bool) {
+	type frame struct {
+		off   uint64
+		depth int
+		r     rune
+	}
+	key := append([]rune(nil), prefix...)
+	base := len(key)
+	boundary := rt.cfg.graphemes && base > 0
+	state := clusterStateOf(prefix)
+	stack := []frame{{n.off, base, 0}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		n, ok := rt.node(f.off)
+		if !ok {
+			continue
+		}
+		if f.depth > base {
+			key = append(key[:f.depth-1], f.r)
+		}
+		if !visit(key, n) {
+			return
+		}
+		// Push the children in reverse so they are popped in ascending rune order
+		for i := int(n.children) - 1; i >= 0; i-- {
+			r, off := rt.child(n, i)
+			if boundary && f.depth == base && state.joins(r) {
+				continue
+			}
+			stack = append(stack, frame{off, f.depth + 1, r})
+		}
+	}
+}
+
+// Get returns the ids stored at the exact key, as Trie.Get does
+func (rt *ReadonlyTrie) Get(key string) []bson.ObjectId {
+	ids := []bson.ObjectId{}
+	if n, ok := rt.tip(rt.cfg.normalize(key)); ok {
+		for i := 0; i < int(n.vals); i++ {
+			ids = append(ids, rt.id(n, i))
+		}
+	}
+	return ids
+}
+
+// Has returns true if the exact key holds at least one id
+func (rt *ReadonlyTrie) Has(key string) bool {
+	n, ok := rt.tip(rt.cfg.normalize(key))
+	return ok && n.vals != 0
+}
+
+// GetMany returns up to n distinct ids stored under keys starting with prefix, in the order Trie.GetMany would
+func (rt *ReadonlyTrie) GetMany(prefix string, n int) []bson.ObjectId {
+	ids := []bson.ObjectId{}
+	prefix = rt.cfg.normalize(prefix)
+	tip, ok := rt.tip(prefix)
+	if !ok || n <= 0 {
+		return ids
+	}
+	seen := make(map[bson.ObjectId]struct{})
+	rt.walk(tip, []rune(prefix), func(_ []rune, node mappedNode) bool {
+		for i := 0; i < int(node.vals); i++ {
+			id := rt.id(node, i)
+			if _, dup := seen[id]; dup {
+				continue
+			}
+			seen[id] = struct{}{}
+			if ids = append(ids, id); len(ids) == n {
+				return false
+			}
+		}
+		return true
+	})
+	return ids
+}
+
+// Keys returns up to n of the stored keys starting with prefix, in lexicographic order and in the form they were
+// last added in, as Trie.Keys does
+func (rt *ReadonlyTrie) Keys(prefix string, n int) []string {
+	prefix = rt.cfg.normalize(prefix)
+	keys := []string{}
+	tip, ok := rt.tip(prefix)
+	if !ok || n <= 0 {
+		return keys
+	}
+	rt.walk(tip, []rune(prefix), func(key []rune, node mappedNode) bool {
+		if node.vals == 0 {
+			return true
+		}
+		if node.display != 0 {
+			at := node.off + mappedNodeSize + uint64(node.children)*mappedChildSize
+			keys = append(keys, string(rt.data[at:at+uint64(node.display)]))
+		} else {
+			keys = append(keys, string(key))
+		}
+		return len(keys) < n
+	})
+	return keys
+}
@@ -0,0 +1,136 @@
+package indexes
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// writeMapped writes tr to a new file with WriteMapped and opens it with opts
+func writeMapped(t *testing.T, tr *Trie, opts ...Option) *ReadonlyTrie {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "trie.gtrm")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.WriteMapped(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rt, err := OpenMapped(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rt.Close() })
+	return rt
+}
+
+// randomKey returns a key of one to six runes drawn from letters
+func randomKey(rng *rand.Rand, letters []rune) string {
+	key := make([]rune, 1+rng.Intn(6))
+	for i := range key {
+		key[i] = letters[rng.Intn(len(letters))]
+	}
+	return string(key)
+}
+
+// TestMappedRandom fills Tries at random under several sets of key options and checks that the ReadonlyTrie of each
+// answers every query as the Trie does
+func TestMappedRandom(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		opts    []Option
+		letters []rune
+	}{
+		{"default", nil, []rune("abcAé日")},
+		{"case sensitive", []Option{WithCaseSensitive()}, []rune("abcAB")},
+		{"grapheme clusters", []Option{WithGraphemeClusters()}, []rune("aé̈‍👩🇫🇷")},
+		{"binary keys", []Option{WithBinaryKeys()}, []rune("ab\x00\xff")},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			now := time.Unix(1500000000, 0)
+			tr := NewTrie(append(c.opts, WithClock(func() time.Time { return now }))...)
+			var prefixes []string
+			for i := 0; i < 2000; i++ {
+				key := randomKey(rng, c.letters)
+				prefixes = append(prefixes, key, string([]rune(key)[:1+rng.Intn(len([]rune(key)))]))
+				switch id := objectID(rng.Intn(500)); rng.Intn(10) {
+				case 0:
+					tr.AddWithTTL(key, id, time.Minute)
+				case 1:
+					tr.Remove(key, id)
+				default:
+					tr.Add(key, id)
+				}
+			}
+			now = now.Add(time.Minute)
+			rt := writeMapped(t, tr, c.opts...)
+			for _, p := range append(prefixes[:400], "") {
+				expect(t, fmt.Sprintf("Get(%q)", p), rt.Get(p), tr.Get(p))
+				expect(t, fmt.Sprintf("Has(%q)", p), rt.Has(p), tr.Has(p))
+				for _, n := range []int{0, 1, 7, 5000} {
+					expect(t, fmt.Sprintf("GetMany(%q, %d)", p, n), rt.GetMany(p, n), tr.GetMany(p, n))
+					expect(t, fmt.Sprintf("Keys(%q, %d)", p, n), rt.Keys(p, n), tr.Keys(p, n))
+				}
+			}
+		})
+	}
+}
+
+// countingWriterAt counts the calls writing to a file
+type countingWriterAt struct {
+	*os.File
+	calls int
+}
+
+func (w *countingWriterAt) WriteAt(b []byte, off int64) (int, error) {
+	w.calls++
+	return w.File.WriteAt(b, off)
+}
+
+// TestMappedChunks checks that WriteMapped writes in chunks rather than once per id or node
+func TestMappedChunks(t *testing.T) {
+	tr := NewTrie()
+	for i := 0; i < 5000; i++ {
+		tr.Add(fmt.Sprintf("key %d", i), objectID(i))
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "trie.gtrm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := &countingWriterAt{File: f}
+	if err := tr.WriteMapped(w); err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := 3 + int(info.Size()/mappedChunkSize); w.calls > max {
+		t.Fatalf("WriteMapped made %d calls for %d bytes, want at most %d", w.calls, info.Size(), max)
+	}
+}
+
+func TestMappedNotMapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trie.gtrm")
+	if err := os.WriteFile(path, []byte("GTRB not a mapped trie at all"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenMapped(path); err != ErrNotMapped {
+		t.Fatalf("OpenMapped = %v, want ErrNotMapped", err)
+	}
+	if err := NewStringTrie().WriteMapped(&countingWriterAt{}); err != ErrInvalidObjectID {
+		t.Fatalf("WriteMapped of a StringTrie = %v, want ErrInvalidObjectID", err)
+	}
+	expect(t, "Get of an empty mapped Trie", writeMapped(t, NewTrie()).Get("x"), []bson.ObjectId{})
+}
@@ -0,0 +1,67 @@
+package indexes
+
+import (
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Iterator is the subset of *mgo.Iter used to stream documents into a Trie
+type Iterator interface {
+	Next(result interface{}) bool
+	Close() error
+}
+
+/*
+LoadFromCollection streams every document of the collection and adds the string value of each of the given fields
+to the Trie under the document's _id. Fields may be dotted paths into subdocuments such as "profile.username".
+Documents are decoded one at a time, so the collection is never held in memory. Returns the number of entries indexed.
+*/
+func LoadFromCollection(c *mgo.Collection, fields []string, t *Trie) (int, error) {
+	projection := bson.M{"_id": 1}
+	for _, f := range fields {
+		projection[f] = 1
+	}
+	return LoadFromIter(c.Find(nil).Select(projection).Iter(), fields, t)
+}
+
+// LoadFromIter adds the given fields of every document produced by iter to the Trie, as LoadFromCollection does.
+// Documents without an ObjectId _id and fields that are missing, empty or not strings are skipped. The error
+// reported by iter.Close is returned along with the number of entries indexed before it occurred.
+func LoadFromIter(iter Iterator, fields []string, t *Trie) (int, error) {
+	indexed := 0
+	var doc bson.M
+	for iter.Next(&doc) {
+		id, ok := doc["_id"].(bson.ObjectId)
+		if ok {
+			for _, f := range fields {
+				value, ok := lookupPath(doc, f).(string)
+				if !ok {
+					continue
+				}
+				if _, err := t.Add(value, id); err == nil {
+					indexed++
+				}
+			}
+		}
+		doc = nil
+	}
+	return indexed, iter.Close()
+}
+
+// lookupPath returns the value at the dotted path within doc, or nil if any element of the path is missing
+func lookupPath(doc bson.M, path string) interface{} {
+	var value interface{} = doc
+	for _, name := range strings.Split(path, ".") {
+		switch m := value.(type) {
+		case bson.M:
+			value = m[name]
+		case map[string]interface{}:
+			value = m[name]
+		default:
+			return nil
+		}
+	}
+	return value
+}
@@ -0,0 +1,54 @@
+package indexes
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// fakeIter is an Iterator over documents, each decoded into the result like *mgo.Iter decodes them
+type fakeIter struct {
+	docs []bson.M
+	err  error
+}
+
+func (it *fakeIter) Next(result interface{}) bool {
+	if len(it.docs) == 0 {
+		return false
+	}
+	data, err := bson.Marshal(it.docs[0])
+	it.docs = it.docs[1:]
+	if err == nil {
+		err = bson.Unmarshal(data, result)
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+	return true
+}
+
+func (it *fakeIter) Close() error { return it.err }
+
+func TestLoadFromIter(t *testing.T) {
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	iter := &fakeIter{docs: []bson.M{
+		{"_id": a, "name": "Ada Lovelace", "profile": bson.M{"username": "ada"}},
+		{"_id": b, "name": "Bob", "profile": bson.M{"username": 7}},
+		{"_id": "not an ObjectId", "name": "Eve"},
+		{"_id": c, "profile": "not a subdocument", "name": ""},
+	}}
+	tr := NewTrie()
+	indexed, err := LoadFromIter(iter, []string{"name", "profile.username"}, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "entries indexed", indexed, 3)
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{"ada lovelace": {a}, "ada": {a}, "bob": {b}})
+
+	failing := &fakeIter{docs: []bson.M{{"_id": a, "name": "Ada"}}, err: errors.New("cursor killed")}
+	indexed, err = LoadFromIter(failing, []string{"name"}, NewTrie())
+	expect(t, "entries indexed before the error", indexed, 1)
+	expect(t, "error", err, failing.err)
+}
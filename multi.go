@@ -0,0 +1,139 @@
+package indexes
+
+import (
+	"math"
+	"sort"
+)
+
+// GetManyUnion returns up to n distinct ids stored under any of the prefixes, taking the read lock once for the whole
+// query. The prefixes are processed fully in argument order, each in the order GetMany would return, and an id reachable
+// from several prefixes appears once, at its first position.
+func (t *GenericTrie[V]) GetManyUnion(prefixes []string, n int) []V {
+	normalized := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		normalized[i] = t.normalize(prefix)
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	res := NewSet[V]()
+	ids := []V{}
+	now := t.cutoff()
+	for _, prefix := range normalized {
+		if curr := t.prefixTip(prefix); curr != nil {
+			depthFirst(curr, n, res, &ids, now)
+		}
+	}
+	return ids
+}
+
+/*
+GetManyIntersect returns up to n ids stored under every one of the prefixes, such as a first and a last name, in the
+order GetMany would return them for the first prefix. A single prefix behaves like GetMany and no prefixes give an
+empty result. If any prefix has no values below it the query returns at once without walking the others; otherwise
+each prefix's ids are gathered and intersected starting from the smallest set.
+*/
+func (t *GenericTrie[V]) GetManyIntersect(prefixes []string, n int) []V {
+	ids := []V{}
+	if len(prefixes) == 0 || n <= 0 {
+		return ids
+	}
+	normalized := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		normalized[i] = t.normalize(prefix)
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	tips := make([]*GenericNode[V], len(normalized))
+	for i, prefix := range normalized {
+		tips[i] = t.prefixTip(prefix)
+		if !hasValues(tips[i], now) {
+			return ids
+		}
+	}
+	if len(tips) == 1 {
+		depthFirst(tips[0], n, NewSet[V](), &ids, now)
+		return ids
+	}
+	lists := make([][]V, len(tips))
+	for i, tip := range tips {
+		depthFirst(tip, math.MaxInt, NewSet[V](), &lists[i], now)
+	}
+	bySize := make([]int, len(lists))
+	for i := range bySize {
+		bySize[i] = i
+	}
+	sort.Slice(bySize, func(i, j int) bool { return len(lists[bySize[i]]) < len(lists[bySize[j]]) })
+
+	candidates := make(map[V]bool, len(lists[bySize[0]]))
+	for _, id := range lists[bySize[0]] {
+		candidates[id] = true
+	}
+	for _, i := range bySize[1:] {
+		kept := make(map[V]bool, len(candidates))
+		for _, id := range lists[i] {
+			if candidates[id] {
+				kept[id] = true
+			}
+		}
+		if candidates = kept; len(candidates) == 0 {
+			return ids
+		}
+	}
+	for _, id := range lists[0] {
+		if len(ids) == n {
+			break
+		}
+		if candidates[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+/*
+GetManyExcept returns up to n ids stored under the include prefix that are not stored under any of the exclude
+prefixes, in GetMany order and under a single read lock. With WithReverseIndex each candidate is checked against the
+keys it is stored under, so no exclusion set is built at all. Otherwise the set of excluded ids is only gathered once
+the include prefix has produced its first candidate.
+*/
+func (t *GenericTrie[V]) GetManyExcept(include string, exclude []string, n int) []V {
+	include = t.normalize(include)
+	excludes := make([]string, len(exclude))
+	for i, prefix := range exclude {
+		excludes[i] = t.normalize(prefix)
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	var excluded map[V]bool
+	now := t.cutoff()
+	keep := func(id V) bool {
+		if t.reverse != nil {
+			for _, key := range t.reverse[id] {
+				for _, prefix := range excludes {
+					if t.hasKeyPrefix(key, prefix) && !findTip(key, t.root).expired(id, now) {
+						return false
+					}
+				}
+			}
+			return true
+		}
+		if excluded == nil {
+			excluded = make(map[V]bool)
+			for _, prefix := range excludes {
+				walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+					for _, id := range node.liveVals(now) {
+						excluded[id] = true
+					}
+					return true
+				})
+			}
+		}
+		return !excluded[id]
+	}
+	ids := []V{}
+	if curr := t.prefixTip(include); curr != nil {
+		depthFirstFilter(curr, n, NewSet[V](), &ids, keep, now)
+	}
+	return ids
+}
@@ -0,0 +1,84 @@
+package indexes
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestGetManyUnionDuplicates checks that an id reachable from several prefixes, or several keys of one, appears once
+func TestGetManyUnionDuplicates(t *testing.T) {
+	tr := NewTrie()
+	a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+	tr.Add("ann", a)
+	tr.Add("anna", b)
+	tr.Add("anna", a)
+	tr.Add("bob", a)
+	tr.Add("bob", c)
+	tr.Add("bobby", d)
+	tr.Add("carl", b)
+	expect(t, "GetManyUnion across prefixes", tr.GetManyUnion([]string{"an", "bo", "c"}, 10), []bson.ObjectId{a, b, c, d})
+	expect(t, "GetManyUnion in argument order", tr.GetManyUnion([]string{"c", "bob", "ann"}, 10), []bson.ObjectId{b, a, c, d})
+	expect(t, "GetManyUnion of overlapping prefixes", tr.GetManyUnion([]string{"ann", "a", "anna"}, 10), []bson.ObjectId{a, b})
+	expect(t, "GetManyUnion of a repeated prefix", tr.GetManyUnion([]string{"BOB", "bob"}, 10), []bson.ObjectId{a, c, d})
+	expect(t, "GetManyUnion stopping at n", tr.GetManyUnion([]string{"c", "bob"}, 2), []bson.ObjectId{b, a})
+	expect(t, "GetManyUnion counting duplicates once", tr.GetManyUnion([]string{"an", "bo"}, 3), []bson.ObjectId{a, b, c})
+	expect(t, "GetManyUnion with a missing prefix", tr.GetManyUnion([]string{"x", "carl"}, 10), []bson.ObjectId{b})
+	expect(t, "GetManyUnion of no prefixes", tr.GetManyUnion(nil, 10), []bson.ObjectId{})
+}
+
+// TestGetManyIntersectSizes intersects a prefix holding thousands of ids with one holding a few
+func TestGetManyIntersectSizes(t *testing.T) {
+	tr := largeTrie(t, 20000)
+	tr.Add("smith", objectID(17000))
+	tr.Add("smith", objectID(30000))
+	tr.Add("smith", objectID(5))
+	tr.Add("smithers", objectID(12))
+	expect(t, "GetManyIntersect in the order of the large prefix", tr.GetManyIntersect([]string{"a", "smith"}, 10),
+		[]bson.ObjectId{objectID(5), objectID(12), objectID(17000)})
+	expect(t, "GetManyIntersect in the order of the small prefix", tr.GetManyIntersect([]string{"smith", "a"}, 10),
+		[]bson.ObjectId{objectID(5), objectID(17000), objectID(12)})
+	expect(t, "GetManyIntersect stopping at n", tr.GetManyIntersect([]string{"a", "smith"}, 2), []bson.ObjectId{objectID(5), objectID(12)})
+	expect(t, "GetManyIntersect of three prefixes", tr.GetManyIntersect([]string{"a", "smith", "smithe"}, 10), []bson.ObjectId{objectID(12)})
+	expect(t, "GetManyIntersect with the empty prefix", tr.GetManyIntersect([]string{"", "smithers"}, 10), []bson.ObjectId{objectID(12)})
+	expect(t, "GetManyIntersect with a prefix matching nothing", tr.GetManyIntersect([]string{"a", "zzz"}, 10), []bson.ObjectId{})
+	expect(t, "GetManyIntersect with a narrower prefix", tr.GetManyIntersect([]string{"aaa", "smith"}, 10), []bson.ObjectId{objectID(5), objectID(12), objectID(17000)})
+	expect(t, "GetManyIntersect of disjoint prefixes", tr.GetManyIntersect([]string{"aab", "smith"}, 10), []bson.ObjectId{})
+	expect(t, "GetManyIntersect of one prefix", tr.GetManyIntersect([]string{"a"}, 30), tr.GetMany("a", 30))
+	expect(t, "GetManyIntersect of no prefixes", tr.GetManyIntersect(nil, 10), []bson.ObjectId{})
+}
+
+// BenchmarkGetManyIntersectMissing intersects a large prefix with one that matches nothing, which should not walk the
+// large one at all
+func BenchmarkGetManyIntersectMissing(b *testing.B) {
+	tr := largeTrie(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.GetManyIntersect([]string{"a", "zzz"}, 10)
+	}
+}
+
+// TestGetManyExceptOverlap checks exclude prefixes overlapping the include prefix, with and without the reverse index
+func TestGetManyExceptOverlap(t *testing.T) {
+	for name, opts := range map[string][]Option{"scan": nil, "reverse index": {WithReverseIndex()}} {
+		t.Run(name, func(t *testing.T) {
+			tr := NewTrie(opts...)
+			a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+			tr.Add("jo", a)
+			tr.Add("john", b)
+			tr.Add("johnny", c)
+			tr.Add("joan", d)
+			tr.Add("zed", b)
+			expect(t, "GetManyExcept of a branch inside the include prefix", tr.GetManyExcept("jo", []string{"joh"}, 10), []bson.ObjectId{a, d})
+			expect(t, "GetManyExcept of a deeper branch", tr.GetManyExcept("jo", []string{"johnn"}, 10), []bson.ObjectId{a, d, b})
+			expect(t, "GetManyExcept of an id stored elsewhere too", tr.GetManyExcept("jo", []string{"z"}, 10), []bson.ObjectId{a, d, c})
+			expect(t, "GetManyExcept of the include prefix", tr.GetManyExcept("john", []string{"john"}, 10), []bson.ObjectId{})
+			expect(t, "GetManyExcept of a wider prefix", tr.GetManyExcept("john", []string{"j"}, 10), []bson.ObjectId{})
+			expect(t, "GetManyExcept of everything", tr.GetManyExcept("", []string{""}, 10), []bson.ObjectId{})
+			expect(t, "GetManyExcept of several prefixes", tr.GetManyExcept("", []string{"joa", "johnny", "z"}, 10), []bson.ObjectId{a})
+			expect(t, "GetManyExcept of nothing", tr.GetManyExcept("jo", nil, 10), tr.GetMany("jo", 10))
+			expect(t, "GetManyExcept of a missing prefix", tr.GetManyExcept("jo", []string{"x"}, 2), []bson.ObjectId{a, d})
+			expect(t, "GetManyExcept stopping at n", tr.GetManyExcept("", []string{"joa"}, 2), []bson.ObjectId{a, b})
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package indexes
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latinBase maps each precomposed letter in U+00C0 to U+017F, Latin-1 Supplement and Latin Extended-A, to the letter it
+// decomposes to with its combining marks removed. Letters that do not decompose, such as "ø" and "ß", map to themselves.
+var latinBase = []rune("" +
+	"AAAAAAÆCEEEEIIII" + // U+00C0
+	"ÐNOOOOO×ØUUUUYÞß" + // U+00D0
+	"aaaaaaæceeeeiiii" + // U+00E0
+	"ðnooooo÷øuuuuyþy" + // U+00F0
+	"AaAaAaCcCcCcCcDd" + // U+0100
+	"ĐđEeEeEeEeEeGgGg" + // U+0110
+	"GgGgHhĦħIiIiIiIi" + // U+0120
+	"IıĲĳJjKkĸLlLlLlĿ" + // U+0130
+	"ŀŁłNnNnNnŉŊŋOoOo" + // U+0140
+	"OoŒœRrRrRrSsSsSs" + // U+0150
+	"SsTtTtŦŧUuUuUuUu" + // U+0160
+	"UuUuWwYyYZzZzZzſ") // U+0170
+
+/*
+foldDiacritics removes the accents from s for WithDiacriticFolding: precomposed Latin letters are replaced by their base
+letter and combining marks (category Mn) are dropped, so "José" and "Jose" followed by a combining acute both become
+"Jose". It works without Unicode decomposition tables, so precomposed letters outside the Latin ranges of latinBase,
+such as Greek "ά", are left as they are; scripts without combining marks, such as Chinese, pass through unchanged.
+*/
+func foldDiacritics(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0xC0 && r < 0xC0+rune(len(latinBase)):
+			return latinBase[r-0xC0]
+		case unicode.Is(unicode.Mn, r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// tidySpace trims leading and trailing whitespace from s when trim is set, and replaces each internal run of
+// whitespace with a single space when collapse is set
+func tidySpace(s string, trim, collapse bool) string {
+	if collapse {
+		fields := strings.Fields(s)
+		if !trim && len(fields) != 0 {
+			// Keep a single space where leading or trailing whitespace was
+			if strings.TrimLeftFunc(s, unicode.IsSpace) != s {
+				fields[0] = " " + fields[0]
+			}
+			if strings.TrimRightFunc(s, unicode.IsSpace) != s {
+				fields[len(fields)-1] += " "
+			}
+		}
+		return strings.Join(fields, " ")
+	}
+	if trim {
+		return strings.TrimSpace(s)
+	}
+	return s
+}
+
+// stripRunes removes every rune of s that is in set
+func stripRunes(s, set string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(set, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// normalize converts a key or prefix to the form it is stored under: brought to the WithUnicodeForm normal form if one
+// is set, rid of the WithIgnoredRunes runes and tidied by WithTrimSpace and WithCollapseSpace, lowercased, by the
+// WithLocaleCase rules if given, unless WithCaseSensitive is used, then stripped of accents with WithDiacriticFolding.
+// A WithNormalizer function replaces all of these steps. With WithBinaryKeys none of them apply: each byte of s
+// becomes one rune instead, so that the Trie links one node per byte.
+func (c *config) normalize(s string) string {
+	if c.binaryKeys {
+		return byteRunes(s)
+	}
+	if c.normalizer != nil {
+		return c.normalizer(s)
+	}
+	if c.unicodeForm != nil {
+		s = c.unicodeForm(s)
+	}
+	if c.ignoredRunes != "" {
+		s = stripRunes(s, c.ignoredRunes)
+	}
+	s = tidySpace(s, c.trimSpace, c.collapseSpace)
+	switch {
+	case c.caseSensitive:
+	case c.localeCase != nil:
+		s = c.localeCase(s)
+	default:
+		s = strings.ToLower(s)
+	}
+	if c.foldDiacritics {
+		s = foldDiacritics(s)
+	}
+	return s
+}
+
+// storedKey normalizes a key about to be added, returning ErrEmptyKey if it is blank before or after normalizing
+func (c *config) storedKey(s string) (string, error) {
+	if c.binaryKeys {
+		if s == "" {
+			return "", ErrEmptyKey
+		}
+		return byteRunes(s), nil
+	}
+	if strings.TrimSpace(s) == "" {
+		return "", ErrEmptyKey
+	}
+	key := c.normalize(s)
+	if strings.TrimSpace(key) == "" {
+		return "", ErrEmptyKey
+	}
+	return key, nil
+}
+
+// byteRunes returns s with each of its bytes, including NULs and those of invalid UTF-8, turned into the rune of the
+// same value, so that walking the result rune by rune visits s byte by byte, in byte order
+func byteRunes(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// givenKey returns a stored key in the form it is given in to Add: with WithBinaryKeys the bytes it was added as,
+// undoing byteRunes, and otherwise the stored key itself, which normalizes to itself as long as the normalizer is
+// idempotent, as WithNormalizer requires
+func (c *config) givenKey(key string) string {
+	if !c.binaryKeys {
+		return key
+	}
+	b := make([]byte, 0, len(key))
+	for _, r := range key {
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
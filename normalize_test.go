@@ -0,0 +1,275 @@
+package indexes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestLocaleCase checks the Turkish dotted and dotless i quartet under both ways of giving WithLocaleCase Turkish rules
+func TestLocaleCase(t *testing.T) {
+	for name, lower := range map[string]func(string) string{
+		"cases.Caser": func(s string) string { return cases.Lower(language.Turkish).String(s) },
+		"strings.ToLowerSpecial": func(s string) string {
+			return strings.ToLowerSpecial(unicode.TurkishCase, s)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tr := NewTrie(WithLocaleCase(lower))
+			for given, want := range map[string]string{"İ": "i", "I": "ı", "i": "i", "ı": "ı", "İSTANBUL": "istanbul", "IRMAK": "ırmak"} {
+				expect(t, "Normalize("+given+")", tr.Normalize(given), want)
+			}
+			a, b := objectID(1), objectID(2)
+			tr.Add("İstanbul", a)
+			tr.Add("IRMAK", b)
+			expect(t, "Keys of dotted i", tr.Keys("i", 10), []string{"İstanbul"})
+			expect(t, "Has of the lowercase form", tr.Has("istanbul"), true)
+			expect(t, "Has with a dotless i", tr.Has("ıstanbul"), false)
+			expect(t, "Has of the dotless form", tr.Has("ırmak"), true)
+			expect(t, "Has with a dotted i", tr.Has("irmak"), false)
+			expect(t, "Remove through the lowercase form", tr.Remove("ırmak", b), true)
+		})
+	}
+	// Without the option both "I" and "İ" lower to a dotted "i", while "ı" is kept
+	tr := NewTrie()
+	expect(t, "default Normalize", tr.Normalize("Iİiı"), "iiiı")
+	expect(t, "WithCaseSensitive", NewTrie(WithLocaleCase(strings.ToUpper), WithCaseSensitive()).Normalize("Iı"), "Iı")
+}
+
+// TestIgnoredRunes checks that keys reach the same path with their ignored runes present or absent, in every direction
+func TestIgnoredRunes(t *testing.T) {
+	tr := NewTrie(WithIgnoredRunes("-_ "))
+	a, b := objectID(1), objectID(2)
+	expect(t, "Add with separators", mustAdd(t, tr, "555-1234", a), true)
+	expect(t, "Add of the same key without them", mustAdd(t, tr, "5551234", a), false)
+	tr.Add("ab_cd", b)
+	expect(t, "Get without separators", tr.Get("5551234"), []bson.ObjectId{a})
+	expect(t, "Get with other separators", tr.Get("555 12-34"), []bson.ObjectId{a})
+	expect(t, "GetMany across a separator", tr.GetMany("5551", 10), []bson.ObjectId{a})
+	expect(t, "GetMany of a prefix ending in a separator", tr.GetMany("ab_", 10), []bson.ObjectId{b})
+	expect(t, "Keys in the form last added", tr.Keys("", 10), []string{"5551234", "ab_cd"})
+	tr.Add("ab-cd", b)
+	expect(t, "Keys after adding another form", tr.Keys("ab", 10), []string{"ab-cd"})
+	if _, err := tr.Add("- _", a); err != ErrEmptyKey {
+		t.Fatalf("Add of a key of ignored runes = %v, want ErrEmptyKey", err)
+	}
+	expect(t, "Get of a key of ignored runes", tr.Get("--"), []bson.ObjectId{})
+
+	expect(t, "Remove through the form without separators", tr.Remove("abcd", b), true)
+	expect(t, "Remove of the removed pair", tr.Remove("ab_cd", b), false)
+	expect(t, "Remove through other separators", tr.Remove("5-5-5-1-2-3-4", a), true)
+	expect(t, "contents after Remove", tr.KeyCount(), 0)
+	expect(t, "ValueCount after Remove", tr.ValueCount(), 0)
+}
+
+// TestCaseSensitive builds one Trie in each mode and checks that lookups and Remove of a mixed-case key agree with it
+func TestCaseSensitive(t *testing.T) {
+	a, b := objectID(1), objectID(2)
+	sensitive := NewTrie(WithCaseSensitive())
+	sensitive.Add("AbC", a)
+	sensitive.Add("abc", b)
+	expect(t, "Get of the mixed-case key", sensitive.Get("AbC"), []bson.ObjectId{a})
+	expect(t, "Get of the lowercase key", sensitive.Get("abc"), []bson.ObjectId{b})
+	expect(t, "Get of another casing", sensitive.Get("ABC"), []bson.ObjectId{})
+	expect(t, "GetMany of an uppercase prefix", sensitive.GetMany("A", 10), []bson.ObjectId{a})
+	expect(t, "Keys", sensitive.Keys("", 10), []string{"AbC", "abc"})
+	expect(t, "Remove through another casing", sensitive.Remove("abC", a), false)
+	expect(t, "Remove of the mixed-case key", sensitive.Remove("AbC", a), true)
+	expect(t, "Keys after Remove", sensitive.Keys("", 10), []string{"abc"})
+
+	insensitive := NewTrie()
+	insensitive.Add("AbC", a)
+	insensitive.Add("abc", b)
+	expect(t, "Get of any casing", insensitive.Get("ABC"), []bson.ObjectId{a, b})
+	expect(t, "GetMany of an uppercase prefix", insensitive.GetMany("A", 10), []bson.ObjectId{a, b})
+	expect(t, "Remove through another casing", insensitive.Remove("abC", a), true)
+	expect(t, "Get after Remove", insensitive.Get("abc"), []bson.ObjectId{b})
+}
+
+// TestDisplayCasings adds two casings of the same key in sequence and checks that the last one added is displayed
+func TestDisplayCasings(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	tr.Add("mcdonald", a)
+	expect(t, "Keys after the first casing", tr.Keys("mc", 10), []string{"mcdonald"})
+	tr.Add("McDonald", b)
+	expect(t, "Keys after the second casing", tr.Keys("mc", 10), []string{"McDonald"})
+	expect(t, "GetManyWithKeys", tr.GetManyWithKeys("MC", 10), []KeyMatch{{Key: "McDonald", IDs: []bson.ObjectId{a, b}}})
+	tr.Add("MCDONALD", a)
+	expect(t, "Keys after adding a stored pair", tr.Keys("mc", 10), []string{"MCDONALD"})
+	expect(t, "ToMap in the stored form", tr.ToMap(), map[string][]bson.ObjectId{"mcdonald": {a, b}})
+
+	if err := tr.Rename("mcdonald", "MacDonald"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "Keys after Rename", tr.Keys("", 10), []string{"MacDonald"})
+	tr.Remove("macdonald", a)
+	tr.Remove("macdonald", b)
+	tr.Add("macdonald", a)
+	expect(t, "Keys after removing and adding again", tr.Keys("", 10), []string{"macdonald"})
+}
+
+// TestUnicodeForm checks that composed and decomposed forms of the same visible string reach the same node
+func TestUnicodeForm(t *testing.T) {
+	composed, decomposed := "Jos\u00e9", "Jose\u0301"
+	a, b := objectID(1), objectID(2)
+	tr := NewTrie(WithUnicodeForm(norm.NFC.String))
+	tr.Add(composed, a)
+	expect(t, "Add of the decomposed form", mustAdd(t, tr, decomposed, a), false)
+	tr.Add(decomposed, b)
+	expect(t, "Get of the composed form", tr.Get(composed), []bson.ObjectId{a, b})
+	expect(t, "Get of the decomposed form", tr.Get(decomposed), []bson.ObjectId{a, b})
+	expect(t, "GetMany of a decomposed prefix", tr.GetMany("jose\u0301", 10), []bson.ObjectId{a, b})
+	expect(t, "KeyCount", tr.KeyCount(), 1)
+	expect(t, "stored form", tr.Normalize(decomposed), "jos\u00e9")
+	if err := tr.Rename(decomposed, "Jos\u00e9 Luis"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "Remove through the decomposed form", tr.Remove("jose\u0301 luis", a), true)
+	expect(t, "Keys after Remove", tr.Keys("", 10), []string{"Jos\u00e9 Luis"})
+
+	compat := NewTrie(WithUnicodeForm(norm.NFKC.String))
+	compat.Add("\ufb01le", a)
+	expect(t, "NFKC folding a ligature", compat.Get("file"), []bson.ObjectId{a})
+
+	// Without the option the two forms are different keys
+	plain := NewTrie()
+	plain.Add(composed, a)
+	expect(t, "Get of the decomposed form without the option", plain.Get(decomposed), []bson.ObjectId{})
+}
+
+// TestDiacriticFolding checks Latin accents in both composed and decomposed form, combined with the other options,
+// and that scripts without accents to fold are indexed unchanged
+func TestDiacriticFolding(t *testing.T) {
+	tr := NewTrie(WithDiacriticFolding())
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("José", a)
+	tr.Add("Ångström", b)
+	tr.Add("Łódź", c)
+	for _, q := range []string{"josé", "José", "jose", "JOSE", "José"} {
+		expect(t, "Get("+q+")", tr.Get(q), []bson.ObjectId{a})
+	}
+	expect(t, "GetMany of an unaccented prefix", tr.GetMany("angs", 10), []bson.ObjectId{b})
+	// "ł" does not decompose, so only the accent on the "o" is folded
+	expect(t, "GetMany of a stroked letter", tr.GetMany("łod", 10), []bson.ObjectId{c})
+	expect(t, "GetMany without the stroke", tr.GetMany("lod", 10), []bson.ObjectId{})
+	expect(t, "Keys keep their accents", tr.Keys("", 10), []string{"Ångström", "José", "Łódź"})
+	expect(t, "Normalize", tr.Normalize("Crème Brûlée"), "creme brulee")
+	expect(t, "Remove through the unaccented form", tr.Remove("jose", a), true)
+
+	// Case sensitivity only keeps the case; accents are still folded
+	sensitive := NewTrie(WithDiacriticFolding(), WithCaseSensitive())
+	sensitive.Add("José", a)
+	expect(t, "Get with WithCaseSensitive", sensitive.Get("Jose"), []bson.ObjectId{a})
+	expect(t, "Get of another case with WithCaseSensitive", sensitive.Get("jose"), []bson.ObjectId{})
+
+	// Scripts without combining marks, and letters outside the Latin ranges folded without decomposition, are kept
+	for _, s := range []string{"東京", "москва", "ά", "ø", "ß"} {
+		expect(t, "Normalize("+s+")", tr.Normalize(s), s)
+	}
+	// Combining marks are dropped whatever letter they follow
+	expect(t, "Normalize of a Greek decomposed accent", tr.Normalize("ά"), "α")
+}
+
+// TestNormalizerOnce uses a normalizer that changes its own output again, which WithNormalizer does not allow, so that
+// applying it twice to any key or query would miss, and counts its calls
+func TestNormalizerOnce(t *testing.T) {
+	calls := 0
+	tr := NewTrie(WithNormalizer(func(s string) string {
+		calls++
+		return "#" + strings.ToLower(s)
+	}))
+	a, b := objectID(1), objectID(2)
+	once := func(what string, n int) {
+		t.Helper()
+		expect(t, "normalizer calls by "+what, calls, n)
+		calls = 0
+	}
+	tr.Add("Alpha", a)
+	once("Add", 1)
+	expect(t, "Get", tr.Get("ALPHA"), []bson.ObjectId{a})
+	once("Get", 1)
+	expect(t, "GetMany", tr.GetMany("al", 10), []bson.ObjectId{a})
+	once("GetMany", 1)
+	expect(t, "Keys", tr.Keys("Al", 10), []string{"Alpha"})
+	once("Keys", 1)
+	expect(t, "Has", tr.Has("alpha"), true)
+	once("Has", 1)
+	if err := tr.Rename("alpha", "Beta"); err != nil {
+		t.Fatal(err)
+	}
+	once("Rename", 2)
+	tr.Add("beta", b)
+	expect(t, "Remove", tr.Remove("BETA", a), true)
+	calls = 0
+	expect(t, "Normalize", tr.Normalize("Beta"), "#beta")
+	once("Normalize", 1)
+	expect(t, "ToMap in the stored form", tr.ToMap(), map[string][]bson.ObjectId{"#beta": {b}})
+	expect(t, "GetMany of the stored form", tr.GetMany("#beta", 10), []bson.ObjectId{})
+
+	for _, s := range []string{"MiXeD Case", "  spaced  ", "ÀÉÎ", "ΣΑΣ", "İ"} {
+		expect(t, "default Normalize("+s+")", NewTrie().Normalize(s), strings.ToLower(s))
+	}
+}
+
+// TestNormalizerRoundTrip checks that the keys ToMap and Export return in stored form, normalized again by
+// NewTrieFromMap and Import, land on the same keys under an idempotent normalizer
+func TestNormalizerRoundTrip(t *testing.T) {
+	straighten := strings.NewReplacer("‘", "'", "’", "'", "“", `"`, "”", `"`)
+	opts := []Option{WithNormalizer(func(s string) string { return strings.ToLower(straighten.Replace(s)) })}
+	tr := NewTrie(opts...)
+	tr.Add("O’Brien", objectID(1))
+	tr.Add("“Quoted”", objectID(2))
+	tr.Add("o'brien", objectID(3))
+	want := map[string][]bson.ObjectId{"o'brien": {objectID(1), objectID(3)}, `"quoted"`: {objectID(2)}}
+	expect(t, "ToMap", tr.ToMap(), want)
+	expect(t, "NewTrieFromMap of ToMap", NewTrieFromMap(tr.ToMap(), opts...).ToMap(), want)
+	imported := NewTrie(opts...)
+	imported.Import(tr.Export(), true)
+	expect(t, "Import of Export", imported.ToMap(), want)
+}
+
+// TestTidyOptions checks every combination of WithTrimSpace, WithCollapseSpace and WithIgnoredRunes on messy names
+func TestTidyOptions(t *testing.T) {
+	names := []string{" O'Brien ", "de  la\tCruz", "  Mary-Jo  O'Neil. "}
+	for _, c := range []struct {
+		trim, collapse, strip bool
+		want                  []string
+	}{
+		{false, false, false, []string{" o'brien ", "de  la\tcruz", "  mary-jo  o'neil. "}},
+		{true, false, false, []string{"o'brien", "de  la\tcruz", "mary-jo  o'neil."}},
+		{false, true, false, []string{" o'brien ", "de la cruz", " mary-jo o'neil. "}},
+		{true, true, false, []string{"o'brien", "de la cruz", "mary-jo o'neil."}},
+		{false, false, true, []string{" obrien ", "de  la\tcruz", "  mary-jo  oneil "}},
+		{true, false, true, []string{"obrien", "de  la\tcruz", "mary-jo  oneil"}},
+		{false, true, true, []string{" obrien ", "de la cruz", " mary-jo oneil "}},
+		{true, true, true, []string{"obrien", "de la cruz", "mary-jo oneil"}},
+	} {
+		t.Run(fmt.Sprintf("trim=%v,collapse=%v,strip=%v", c.trim, c.collapse, c.strip), func(t *testing.T) {
+			var opts []Option
+			if c.trim {
+				opts = append(opts, WithTrimSpace())
+			}
+			if c.collapse {
+				opts = append(opts, WithCollapseSpace())
+			}
+			if c.strip {
+				opts = append(opts, WithIgnoredRunes("'."))
+			}
+			tr := NewTrie(opts...)
+			for i, name := range names {
+				expect(t, fmt.Sprintf("Normalize(%q)", name), tr.Normalize(name), c.want[i])
+				tr.Add(name, objectID(i))
+				// Queries get the same treatment, so the stored form finds the key again
+				expect(t, fmt.Sprintf("Get(%q)", c.want[i]), tr.Get(c.want[i]), []bson.ObjectId{objectID(i)})
+			}
+			expect(t, "Has of a clean query", tr.Has("obrien"), c.trim && c.strip)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package indexes
+
+import (
+	"io"
+	"time"
+)
+
+// Option configures a Trie at construction time
+type Option func(*config)
+
+// config holds the settings chosen by the options passed to NewTrie. Clones and rebuilt tries share them.
+type config struct {
+	reverseIndex   bool // maintain Trie.reverse
+	chunkSize      int  // entries applied per write lock by batch methods, 0 for a single lock
+	visitBudget    int  // nodes a pattern search may visit, 0 for defaultVisitBudget
+	infixIndex     bool // maintain Trie.infix
+	suffixIndex    bool // maintain Trie.suffix
+	queryStats     int  // frequent prefixes reported through Trie.queries, 0 to track none
+	caseSensitive  bool // store and look up keys without lowercasing them
+	foldDiacritics bool // strip accents from keys with foldDiacritics
+	trimSpace      bool // trim leading and trailing whitespace from keys
+	collapseSpace  bool // collapse internal runs of whitespace in keys to one space
+	graphemes      bool // match prefixes on grapheme cluster boundaries
+	binaryKeys     bool // store keys one byte per edge without normalizing them
+	refreshAddedAt bool // restamp a pair's added-at time when it is added again
+	partialLoad    bool // keep the keys decoded before a corrupt binary snapshot record
+
+	scorer       func(query, key string) float64 // scores keys for GetManyScored, nil for coverageScore
+	halfLife     time.Duration                   // period over which hit counts halve, 0 for no decay
+	unicodeForm  func(string) string             // brings keys to a Unicode normal form, nil to leave them as given
+	normalizer   func(string) string             // replaces config.normalize's built-in steps, nil to use them
+	localeCase   func(string) string             // lowercases keys by language-specific rules, nil for strings.ToLower
+	ignoredRunes string                          // runes removed from keys, such as punctuation
+	separators   string                          // runes AddFields splits values on, "" for whitespace
+	clock        func() time.Time                // source of the current time, nil for time.Now
+	wal          io.Writer                       // receives the log of mutations, nil for none
+}
+
+// sameIndexes reports whether tries configured by c and other maintain the same auxiliary indexes
+func (c config) sameIndexes(other config) bool {
+	return c.reverseIndex == other.reverseIndex && c.infixIndex == other.infixIndex && c.suffixIndex == other.suffixIndex
+}
+
+/*
+WithReverseIndex makes the Trie maintain a reverse index from each id to the keys it is stored under, so RemoveID
+can find them without walking the whole Trie. The reverse index costs one string header (16 bytes, sharing the key's
+bytes) per (key, id) pair plus one map entry and slice header per distinct id, roughly 60 bytes per id on top of 16 per pair.
+*/
+func WithReverseIndex() Option {
+	return func(c *config) {
+		c.reverseIndex = true
+	}
+}
+
+// WithBatchChunkSize makes AddMany and RemoveMany apply entries in chunks of n, releasing the write
+// lock between chunks so readers can make progress. A batch is no longer atomic as a whole when chunked.
+// By default, or when n <= 0, a batch is applied under a single write lock.
+func WithBatchChunkSize(n int) Option {
+	return func(c *config) {
+		c.chunkSize = n
+	}
+}
+
+// WithVisitBudget caps the number of nodes a single pattern search such as Match may visit before it gives up and
+// returns the results found so far. It guards against pathological patterns on large tries; n <= 0 keeps the default.
+func WithVisitBudget(n int) Option {
+	return func(c *config) {
+		c.visitBudget = n
+	}
+}
+
+/*
+WithInfixIndex enables GetContaining by additionally filing every key under each of its suffixes, so a substring query
+becomes a prefix query on the suffixes. This multiplies the memory used by keys by roughly their average length in runes,
+which is why it is opt-in. The infix entries are kept consistent by every method that adds or removes keys.
+*/
+func WithInfixIndex() Option {
+	return func(c *config) {
+		c.infixIndex = true
+	}
+}
+
+// WithSuffixIndex enables GetBySuffix by additionally filing every key under its rune-wise reversal, kept in sync by
+// every method that adds or removes keys under the same lock. It costs about one extra node per key rune; without the
+// option no suffix index is allocated or maintained.
+func WithSuffixIndex() Option {
+	return func(c *config) {
+		c.suffixIndex = true
+	}
+}
+
+// WithScorer replaces the function GetManyScored ranks keys with. score receives the normalized query and a stored key
+// starting with it, and higher scores rank first; it runs under the read lock, so it must not call back into the Trie.
+func WithScorer(score func(query, key string) float64) Option {
+	return func(c *config) {
+		c.scorer = score
+	}
+}
+
+// WithQueryStats makes Get and GetMany record the prefixes they are called with for TopQueries, in memory bounded by a
+// small multiple of topK, the number of most frequent prefixes to report on. Without the option nothing is recorded.
+func WithQueryStats(topK int) Option {
+	return func(c *config) {
+		c.queryStats = topK
+	}
+}
+
+// WithHitHalfLife makes the hit counts kept by RecordHit decay exponentially, halving over every period d, so that
+// GetManyRanked favours what is popular now over what was popular long ago. d <= 0 keeps counts from decaying.
+func WithHitHalfLife(d time.Duration) Option {
+	return func(c *config) {
+		c.halfLife = d
+	}
+}
+
+// WithClock replaces the clock the Trie reads the current time from, by default time.Now, chiefly so tests can
+// control how time passes
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.clock = now
+	}
+}
+
+// WithCaseSensitive stops the Trie lowercasing keys and prefixes, so "AbC" and "abc" are distinct keys. By default
+// every key and query is lowercased before it reaches the Trie.
+func WithCaseSensitive() Option {
+	return func(c *config) {
+		c.caseSensitive = true
+	}
+}
+
+/*
+WithUnicodeForm brings every key and query to a Unicode normal form before it is case folded, so that "é" typed as one
+code point and as "e" followed by a combining accent reach the same node. form does the conversion, which keeps
+golang.org/x/text out of this package's dependencies for callers that do not need it: pass norm.NFC.String from
+golang.org/x/text/unicode/norm for the usual composed form, or norm.NFKC.String to also fold compatibility characters
+such as "ﬁ". Without the option keys are indexed as given.
+*/
+func WithUnicodeForm(form func(string) string) Option {
+	return func(c *config) {
+		c.unicodeForm = form
+	}
+}
+
+// WithDiacriticFolding strips accents from keys and queries as the last normalizing step, after case folding, so
+// "josé", "José" and "jose" all reach the same node. Keys are still displayed with their accents.
+// See foldDiacritics for which characters are folded.
+func WithDiacriticFolding() Option {
+	return func(c *config) {
+		c.foldDiacritics = true
+	}
+}
+
+/*
+WithNormalizer replaces the way keys and queries are normalized, for canonicalization the built-in options do not
+cover, such as mapping smart quotes. normalize takes the place of every built-in step, including lowercasing and those
+chosen by WithCaseSensitive, WithUnicodeForm and WithDiacriticFolding, so it should lowercase itself if matching is to
+ignore case. It is applied exactly once to each key or query passing into the Trie; see Normalize.
+
+normalize must be idempotent: normalize(normalize(s)) must equal normalize(s). ToMap and Export return keys in their
+normalized form, and NewTrieFromMap and Import normalize them again, so a normalizer that keeps changing its own
+output, such as one appending a suffix, would store them under different keys than the Trie they came from.
+*/
+func WithNormalizer(normalize func(string) string) Option {
+	return func(c *config) {
+		c.normalizer = normalize
+	}
+}
+
+/*
+WithLocaleCase lowercases keys and queries with lower rather than strings.ToLower, for language-specific rules such as
+Turkish ones, under which "I" lowers to dotless "ı" and "İ" to "i". Like WithUnicodeForm it keeps golang.org/x/text out
+of this package's dependencies: pass the String method of cases.Lower(language.Turkish) from golang.org/x/text/cases,
+building a Caser per call since Casers must not be shared between goroutines, or strings.ToLowerSpecial with
+unicode.TurkishCase. It has no effect with WithCaseSensitive.
+*/
+func WithLocaleCase(lower func(string) string) Option {
+	return func(c *config) {
+		c.localeCase = lower
+	}
+}
+
+// WithTrimSpace trims leading and trailing whitespace from keys and queries, so " anna " and "anna" are the same key.
+// Without it whitespace is kept as given.
+func WithTrimSpace() Option {
+	return func(c *config) {
+		c.trimSpace = true
+	}
+}
+
+// WithCollapseSpace replaces every run of whitespace in keys and queries with a single space, so "de  la cruz" and
+// "de la cruz" are the same key. Leading and trailing runs also become one space unless WithTrimSpace is used.
+func WithCollapseSpace() Option {
+	return func(c *config) {
+		c.collapseSpace = true
+	}
+}
+
+// WithFieldSeparators makes AddFields and RemoveFields split values on the runes in set, such as " ,;", instead of on
+// whitespace
+func WithFieldSeparators(set string) Option {
+	return func(c *config) {
+		c.separators = set
+	}
+}
+
+/*
+WithGraphemeClusters makes prefix queries respect grapheme cluster boundaries, so a prefix only matches keys in which
+it ends where a user-perceived character ends: "👍" no longer completes to "👍🏽", nor "e" to "e" followed by a
+combining accent. NextCharacters then lists whole clusters, '?' in Match consumes a whole cluster and DeleteSubtree
+keeps the keys the prefix would stop partway into. Nodes are still linked one rune at a time, so each query pays for the
+boundary checks at the end of its prefix. Clusters follow the full Unicode rules as implemented by
+github.com/rivo/uniseg. GetFuzzy and Suggest still count edits in runes.
+*/
+func WithGraphemeClusters() Option {
+	return func(c *config) {
+		c.graphemes = true
+	}
+}
+
+/*
+WithIgnoredRunes skips every rune in set wherever it occurs in keys and queries, before any whitespace tidying, so with
+set "-_ " phone numbers and ids such as "555-1234" and "5551234" share a path, and with set "'." so do "O'Brien" and
+"obrien". Keys are still displayed as added, and a key made only of ignored runes is empty and rejected with
+ErrEmptyKey. Repeating the option ignores the runes of every set given.
+*/
+func WithIgnoredRunes(set string) Option {
+	return func(c *config) {
+		c.ignoredRunes += set
+	}
+}
+
+/*
+WithBinaryKeys makes the Trie store keys as raw byte sequences, such as hashes or serialized tuples, one byte per edge.
+Keys are not normalized at all, so embedded NUL bytes and invalid UTF-8 are kept as given and only the empty key is
+rejected. The key normalizing options and WithGraphemeClusters have no effect. AddBytes and the other *Bytes methods take
+keys as []byte, while the string methods treat a string as its bytes, and keys come back from Keys exactly as added.
+*/
+func WithBinaryKeys() Option {
+	return func(c *config) {
+		c.binaryKeys = true
+	}
+}
+
+// WithRefreshAddedAt makes adding a pair that is already stored reset its added-at time to the current time, so that
+// GetAddedSince reports pairs re-added since. By default a pair keeps the time it was first stored.
+func WithRefreshAddedAt() Option {
+	return func(c *config) {
+		c.refreshAddedAt = true
+	}
+}
+
+/*
+WithWAL makes the Trie append a record to w for every operation that changes it, in the order they take effect, so
+that Replay can bring a snapshot up to date after a crash. A record holds one small entry per pair the operation
+added, changed or removed, as the operation left it, metadata included, so every mutator is covered, from Add to
+Apply, DeleteSubtree, Purge and Import. Clear logs a single entry; an operation replacing the whole contents, such as
+Swap, Rebuild or UnmarshalJSON, logs every new pair, encoded before the write lock is taken. Payloads stored by
+AddEntry are not logged. Records are written after the write lock is released, so a slow w holds up only the calls
+waiting for their own records, never readers. The first write error stops the log and is reported by WALError. The
+contents a Trie is created with by Load, BuildTrie and the other constructors are not logged, and a Clone does not
+log.
+*/
+func WithWAL(w io.Writer) Option {
+	return func(c *config) {
+		c.wal = w
+	}
+}
+
+/*
+WithPartialLoad makes Load and UnmarshalBinary keep what could be decoded from a corrupt binary snapshot, for recovering
+from a damaged backup: Load returns the Trie holding every key before the record that failed along with the
+CorruptSnapshotError, and UnmarshalBinary installs those keys before returning it. Data that is not a snapshot at all
+still yields nothing.
+*/
+func WithPartialLoad() Option {
+	return func(c *config) {
+		c.partialLoad = true
+	}
+}
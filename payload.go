@@ -0,0 +1,103 @@
+package indexes
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GenericEntry is an id found by GetEntries, with the key it was found under, the payload stored alongside it and when the
+// pair was added
+type GenericEntry[V comparable] struct {
+	Key     string
+	ID      V
+	Payload interface{}
+	AddedAt time.Time
+}
+
+// Entry is the GenericEntry of a Trie
+type Entry = GenericEntry[bson.ObjectId]
+
+/*
+AddEntry is Add storing payload alongside the id, such as the display name and avatar URL a completion row shows, so
+that GetEntries can render results without looking each id up. Adding a pair that is already stored replaces its
+payload, and a nil payload clears it; the returned bool still reports only whether the pair was newly stored. The
+payload is kept as given and never copied, so it should not be modified once added. It is dropped along with the pair.
+*/
+func (t *GenericTrie[V]) AddEntry(key string, id V, payload interface{}) (bool, error) {
+	stored, err := t.storedKey(key)
+	if err != nil {
+		return false, err
+	}
+	t.mx.Lock()
+	defer t.unlock()
+	node, inserted := t.insert(stored, key, id)
+	if payload != nil || node.getMeta(id) != nil {
+		node.putMeta(id).payload = payload
+	}
+	return inserted, nil
+}
+
+// GetEntries returns up to n entries stored under keys starting with prefix, in the order of GetMany. An id stored
+// under several matching keys is returned once, with the key and payload it was first found under. Ids added without
+// a payload come back with a nil one.
+func (t *GenericTrie[V]) GetEntries(prefix string, n int) []GenericEntry[V] {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	entries := []GenericEntry[V]{}
+	if n <= 0 {
+		return entries
+	}
+	res := NewSet[V]()
+	walk(t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			if res.ContainsVal(id) {
+				continue
+			}
+			res.SaveVal(id)
+			entries = append(entries, GenericEntry[V]{
+				Key:     node.displayKey(string(key)),
+				ID:      id,
+				Payload: node.payload(id),
+				AddedAt: node.addedAt(id),
+			})
+			if len(entries) == n {
+				return false
+			}
+		}
+		return true
+	})
+	return entries
+}
+
+/*
+GetAddedSince returns up to n distinct ids stored under keys starting with prefix whose pair was added at or after
+since, in the order of GetMany, for syncing downstream copies incrementally. Pairs keep the time they were first stored
+unless WithRefreshAddedAt is used; a renamed key keeps the times of its pairs. Times come from the WithClock clock.
+*/
+func (t *GenericTrie[V]) GetAddedSince(prefix string, since time.Time, n int) []V {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	ids := []V{}
+	if n <= 0 {
+		return ids
+	}
+	res := NewSet[V]()
+	walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			if res.ContainsVal(id) || node.addedAt(id).Before(since) {
+				continue
+			}
+			res.SaveVal(id)
+			if ids = append(ids, id); len(ids) == n {
+				return false
+			}
+		}
+		return true
+	})
+	return ids
+}
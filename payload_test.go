@@ -0,0 +1,114 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// profile is the kind of payload a completion row renders
+type profile struct {
+	Name   string
+	Avatar string
+}
+
+func init() {
+	gob.Register(profile{})
+}
+
+// payloads returns the payload of each entry GetEntries finds under prefix
+func payloads(tr *Trie, prefix string) []interface{} {
+	var res []interface{}
+	for _, e := range tr.GetEntries(prefix, 100) {
+		res = append(res, e.Payload)
+	}
+	return res
+}
+
+func TestAddEntryPayloads(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	ada := profile{"Ada Lovelace", "ada.png"}
+	inserted, _ := tr.AddEntry("ada", a, ada)
+	expect(t, "AddEntry of a new pair", inserted, true)
+	tr.AddEntry("adam", b, nil)
+	expect(t, "payloads", payloads(tr, "ad"), []interface{}{ada, nil})
+
+	updated := profile{"Ada King", "king.png"}
+	inserted, _ = tr.AddEntry("Ada", a, updated)
+	expect(t, "AddEntry of a stored pair", inserted, false)
+	expect(t, "payloads after an update", payloads(tr, "ad"), []interface{}{updated, nil})
+	tr.Add("ada", a)
+	expect(t, "payloads after a plain Add", payloads(tr, "ada"), []interface{}{updated, nil})
+	tr.AddEntry("ada", a, nil)
+	expect(t, "payloads after a nil payload", payloads(tr, "ada"), []interface{}{nil, nil})
+
+	tr.AddEntry("ada", a, ada)
+	tr.Remove("ada", a)
+	tr.Add("ada", a)
+	expect(t, "payloads after Remove and Add", payloads(tr, "ada"), []interface{}{nil, nil})
+
+	tr.AddEntry("ada", a, ada)
+	clone := tr.Clone()
+	tr.AddEntry("ada", a, updated)
+	expect(t, "payloads of the clone", payloads(clone, "ad"), []interface{}{ada, nil})
+	var buf bytes.Buffer
+	if err := tr.EncodeGob(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeGob(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "payloads after a gob round trip", payloads(decoded, "ad"), []interface{}{updated, nil})
+}
+
+// TestGetAddedSince checks the boundary where since equals a pair's time exactly, re-adding with and without
+// WithRefreshAddedAt, and that serialization keeps the times
+func TestGetAddedSince(t *testing.T) {
+	start := time.Unix(1500000000, 123456789)
+	now := start
+	clock := WithClock(func() time.Time { return now })
+	tr := NewTrie(clock)
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("doc/a", a)
+	now = now.Add(time.Second)
+	tr.Add("doc/b", b)
+	now = now.Add(time.Nanosecond)
+	tr.Add("doc/c", c)
+	second := start.Add(time.Second)
+	expect(t, "GetAddedSince at a pair's time", tr.GetAddedSince("doc", second, 10), []bson.ObjectId{b, c})
+	expect(t, "GetAddedSince just after it", tr.GetAddedSince("doc", second.Add(time.Nanosecond), 10), []bson.ObjectId{c})
+	expect(t, "GetAddedSince just before it", tr.GetAddedSince("doc", second.Add(-time.Nanosecond), 10), []bson.ObjectId{b, c})
+	expect(t, "GetAddedSince stopping at n", tr.GetAddedSince("doc", start, 2), []bson.ObjectId{a, b})
+	expect(t, "AddedAt of GetEntries", tr.GetEntries("doc/a", 1)[0].AddedAt, start)
+
+	now = now.Add(time.Hour)
+	tr.Add("doc/a", a)
+	expect(t, "GetAddedSince after re-adding", tr.GetAddedSince("doc", now, 10), []bson.ObjectId{})
+	refreshing := NewTrie(clock, WithRefreshAddedAt())
+	refreshing.Add("doc/a", a)
+	now = now.Add(time.Hour)
+	refreshing.Add("doc/a", a)
+	expect(t, "GetAddedSince after re-adding with WithRefreshAddedAt", refreshing.GetAddedSince("doc", now, 10), []bson.ObjectId{a})
+
+	decoded := decodeState(t, marshalBinary(t, tr))
+	expect(t, "GetAddedSince after a binary round trip", decoded.GetAddedSince("doc", second, 10), []bson.ObjectId{b, c})
+	expect(t, "AddedAt after a binary round trip", decoded.GetEntries("doc", 3), tr.GetEntries("doc", 3))
+	var buf bytes.Buffer
+	if err := tr.EncodeGob(&buf); err != nil {
+		t.Fatal(err)
+	}
+	fromGob, err := DecodeGob(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "GetAddedSince after a gob round trip", fromGob.GetAddedSince("doc", second, 10), []bson.ObjectId{b, c})
+	if err := tr.Rename("doc/b", "doc/z"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "GetAddedSince after Rename", tr.GetAddedSince("doc", second, 10), []bson.ObjectId{c, b})
+}
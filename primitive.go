@@ -0,0 +1,42 @@
+package indexes
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ErrInvalidObjectID is returned when a bson.ObjectId is not 12 bytes long and so has no primitive.ObjectID form
+var ErrInvalidObjectID = errors.New("indexes: id is not a 12-byte ObjectId")
+
+/*
+PrimitiveTrie is a Trie holding mongo-driver primitive.ObjectID values, for services on go.mongodb.org/mongo-driver. It
+has the full API of Trie, and both write ObjectIds as the same 12 bytes in binary snapshots, logs and cursors and as the
+same hex strings in JSON, so a snapshot saved by either loads into the other with its ids unchanged.
+*/
+type PrimitiveTrie = GenericTrie[primitive.ObjectID]
+
+// NewPrimitiveTrie returns an empty PrimitiveTrie configured with opts
+func NewPrimitiveTrie(opts ...Option) *PrimitiveTrie {
+	return NewGenericTrie[primitive.ObjectID](opts...)
+}
+
+/*
+FromPrimitive converts a mongo-driver primitive.ObjectID to the mgo bson.ObjectId the Trie stores. Both are the same 12
+bytes, so the conversion is lossless and ToPrimitive turns the result back into id.
+*/
+func FromPrimitive(id primitive.ObjectID) bson.ObjectId {
+	return bson.ObjectId(id[:])
+}
+
+// ToPrimitive converts a bson.ObjectId to a mongo-driver primitive.ObjectID, returning ErrInvalidObjectID if it is not
+// 12 bytes long
+func ToPrimitive(id bson.ObjectId) (primitive.ObjectID, error) {
+	var p primitive.ObjectID
+	if !id.Valid() {
+		return p, ErrInvalidObjectID
+	}
+	copy(p[:], id)
+	return p, nil
+}
@@ -0,0 +1,109 @@
+package indexes
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// primitiveID returns the i-th of a sequence of mongo-driver ids in ascending order, the same bytes as objectID(i)
+func primitiveID(i int) primitive.ObjectID {
+	var id primitive.ObjectID
+	copy(id[:], objectID(i))
+	return id
+}
+
+func TestPrimitiveTrie(t *testing.T) {
+	tr := NewPrimitiveTrie()
+	a, b, c := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	tr.Add("Ada", a)
+	tr.Add("Adams", b)
+	tr.Add("Adams", a)
+	tr.Add("Bob", c)
+	expect(t, "Get", tr.Get("adams"), []primitive.ObjectID{a, b})
+	expect(t, "GetMany", tr.GetMany("ad", 10), []primitive.ObjectID{a, b})
+	expect(t, "GetManyWithKeys", tr.GetManyWithKeys("ad", 10), []GenericKeyMatch[primitive.ObjectID]{
+		{Key: "Ada", IDs: []primitive.ObjectID{a}}, {Key: "Adams", IDs: []primitive.ObjectID{a, b}},
+	})
+	expect(t, "RemoveID", tr.RemoveID(a), 2)
+	expect(t, "ToMap after RemoveID", tr.ToMap(), map[string][]primitive.ObjectID{"adams": {b}, "bob": {c}})
+	newest := tr.GetManyByTime("", 1, true)
+	expect(t, "GetManyByTime", newest, []primitive.ObjectID{c})
+}
+
+func TestPrimitiveConversion(t *testing.T) {
+	p := primitive.NewObjectID()
+	id := FromPrimitive(p)
+	expect(t, "FromPrimitive", id.Hex(), p.Hex())
+	back, err := ToPrimitive(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "ToPrimitive", back, p)
+	if _, err := ToPrimitive(bson.ObjectId("short")); err != ErrInvalidObjectID {
+		t.Fatalf("ToPrimitive of a short id = %v, want ErrInvalidObjectID", err)
+	}
+}
+
+// TestPrimitiveCrossLoad checks that a Trie and a PrimitiveTrie read each other's serializations with the ids unchanged
+func TestPrimitiveCrossLoad(t *testing.T) {
+	mgoTrie := NewTrie()
+	driverTrie := NewPrimitiveTrie()
+	want := map[string][]primitive.ObjectID{}
+	for i, key := range []string{"alpha", "beta", "alpha", "gamma"} {
+		mgoTrie.Add(key, objectID(i))
+		driverTrie.Add(key, primitiveID(i))
+		want[key] = append(want[key], primitiveID(i))
+	}
+	wantMgo := mgoTrie.ToMap()
+
+	// binary
+	data, err := mgoTrie.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromMgo := NewPrimitiveTrie()
+	if err := fromMgo.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "binary snapshot of a Trie loaded as a PrimitiveTrie", fromMgo.ToMap(), want)
+	if data, err = driverTrie.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	fromDriver := NewTrie()
+	if err := fromDriver.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "binary snapshot of a PrimitiveTrie loaded as a Trie", fromDriver.ToMap(), wantMgo)
+
+	// JSON
+	mgoJSON, _ := json.Marshal(mgoTrie)
+	driverJSON, _ := json.Marshal(driverTrie)
+	expect(t, "JSON of a PrimitiveTrie", string(driverJSON), string(mgoJSON))
+	fromMgo = NewPrimitiveTrie()
+	if err := json.Unmarshal(mgoJSON, fromMgo); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "JSON of a Trie loaded as a PrimitiveTrie", fromMgo.ToMap(), want)
+
+	// gob, where both ids encode as their hex text
+	var buf bytes.Buffer
+	if err := driverTrie.EncodeGob(&buf); err != nil {
+		t.Fatal(err)
+	}
+	gobbed, err := DecodeGob(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "gob of a PrimitiveTrie loaded as a Trie", gobbed.ToMap(), wantMgo)
+
+	// BSON chunks
+	fromMgo, err = FromBSONChunksGeneric[primitive.ObjectID](mgoTrie.ToBSONChunks(1 << 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "BSON chunks of a Trie loaded as a PrimitiveTrie", fromMgo.ToMap(), want)
+}
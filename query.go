@@ -0,0 +1,338 @@
+package indexes
+
+import (
+	"sort"
+	"strings"
+)
+
+// LongestPrefixMatch returns the longest stored key that is a prefix of s, along with its ids.
+// s is normalized the same way Add normalizes keys, and the returned key is in the form it was last added in.
+// ok is false if no stored key is a prefix of s.
+func (t *GenericTrie[V]) LongestPrefixMatch(s string) (key string, ids []V, ok bool) {
+	runes := []rune(t.normalize(s))
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	var best *GenericNode[V]
+	length := 0
+	curr := t.root
+	var state clusterState
+	for i, r := range runes {
+		curr = curr.GetLink(r)
+		if curr == nil {
+			break
+		}
+		state = state.push(r)
+		if t.cfg.graphemes && i+1 < len(runes) && state.joins(runes[i+1]) {
+			// The key would end partway through one of s's grapheme clusters
+			continue
+		}
+		if curr.hasLive(now) {
+			best, length = curr, i+1
+		}
+	}
+	if best == nil {
+		return "", []V{}, false
+	}
+	return best.displayKey(string(runes[:length])), best.liveVals(now), true
+}
+
+// GetContaining returns up to n ids stored under keys containing substr anywhere, deduplicated like GetMany. Keys are
+// visited in lexicographic order of the suffix the match starts at. It requires WithInfixIndex and returns an empty
+// result otherwise.
+func (t *GenericTrie[V]) GetContaining(substr string, n int) []V {
+	substr = t.normalize(substr)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return t.idsOfKeys(t.infix, []rune(substr), n)
+}
+
+// GetBySuffix returns up to n ids stored under keys ending with suffix, deduplicated like GetMany. Keys are visited
+// in lexicographic order of their reversal. It requires WithSuffixIndex and returns an empty result otherwise.
+func (t *GenericTrie[V]) GetBySuffix(suffix string, n int) []V {
+	suffix = t.normalize(suffix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return t.idsOfKeys(t.suffix, reverseRunes(suffix), n)
+}
+
+// idsOfKeys collects up to n distinct ids from the keys filed in the auxiliary index kt under prefix.
+// The caller must hold the read lock.
+func (t *GenericTrie[V]) idsOfKeys(kt *keyTrie, prefix []rune, n int) []V {
+	ids := []V{}
+	if kt == nil || n <= 0 {
+		return ids
+	}
+	res := NewSet[V]()
+	now := t.cutoff()
+	kt.collect(prefix, func(key string) bool {
+		node := findTip(key, t.root)
+		if node == nil {
+			return true
+		}
+		for _, id := range node.liveVals(now) {
+			if res.Size() >= n {
+				return false
+			}
+			if !res.ContainsVal(id) {
+				res.SaveVal(id)
+				ids = append(ids, id)
+			}
+		}
+		return res.Size() < n
+	})
+	return ids
+}
+
+// defaultVisitBudget is the number of nodes a pattern search may visit when no WithVisitBudget option is given
+const defaultVisitBudget = 1 << 20
+
+// visitBudget returns the number of nodes a pattern search may visit
+func (t *GenericTrie[V]) visitBudget() int {
+	if t.cfg.visitBudget > 0 {
+		return t.cfg.visitBudget
+	}
+	return defaultVisitBudget
+}
+
+// Kinds of token in a parsed Match pattern
+const (
+	tokenLiteral = iota
+	tokenAny     // '?' matches exactly one rune
+	tokenStar    // '*' matches any run of runes, including none
+)
+
+type patternToken struct {
+	kind int
+	r    rune
+}
+
+/*
+parsePattern splits a Match pattern into tokens. A backslash makes the following rune literal, so stored '?', '*' and
+'\' can be matched. The pattern is normalized as a whole, the way keys are, with each wildcard standing in as a
+placeholder rune, so that steps such as WithTrimSpace and WithCollapseSpace see the whitespace around a wildcard as
+internal to the pattern. A normalizer that drops or changes the placeholders falls back to normalizing each literal run
+on its own. With WithBinaryKeys the pattern is scanned byte by byte.
+*/
+func (t *GenericTrie[V]) parsePattern(pattern string) []patternToken {
+	if t.cfg.binaryKeys {
+		return scanPattern([]rune(byteRunes(pattern)), func(s string) string { return s })
+	}
+	runes := []rune(pattern)
+	anyRune, starRune := placeholders(runes, t.cfg.ignoredRunes)
+	text := make([]rune, 0, len(runes))
+	wildcards := 0
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			text = append(text, runes[i])
+		case r == '?':
+			text = append(text, anyRune)
+			wildcards++
+		case r == '*':
+			text = append(text, starRune)
+			wildcards++
+		default:
+			text = append(text, r)
+		}
+	}
+	var tokens []patternToken
+	for _, r := range t.normalize(string(text)) {
+		switch r {
+		case anyRune:
+			tokens = append(tokens, patternToken{kind: tokenAny})
+			wildcards--
+		case starRune:
+			tokens = append(tokens, patternToken{kind: tokenStar})
+			wildcards--
+		default:
+			tokens = append(tokens, patternToken{tokenLiteral, r})
+		}
+	}
+	if wildcards != 0 {
+		return scanPattern(runes, t.normalize)
+	}
+	return tokens
+}
+
+// placeholders returns two runes of the private use area, which no built-in normalizing step changes, that are
+// neither in runes nor in ignored, to stand for '?' and '*' while a pattern is normalized
+func placeholders(runes []rune, ignored string) (anyRune, starRune rune) {
+	used := make(map[rune]bool, len(runes))
+	for _, r := range runes {
+		used[r] = true
+	}
+	free := make([]rune, 0, 2)
+	for r := rune(0xE000); len(free) < 2; r++ {
+		if !used[r] && !strings.ContainsRune(ignored, r) {
+			free = append(free, r)
+		}
+	}
+	return free[0], free[1]
+}
+
+// scanPattern splits the runes of a Match pattern into tokens, normalizing each literal run on its own with normalize
+func scanPattern(runes []rune, normalize func(string) string) []patternToken {
+	var tokens []patternToken
+	var literal []rune
+	flush := func() {
+		for _, r := range normalize(string(literal)) {
+			tokens = append(tokens, patternToken{tokenLiteral, r})
+		}
+		literal = literal[:0]
+	}
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			literal = append(literal, runes[i])
+		case r == '?':
+			flush()
+			tokens = append(tokens, patternToken{kind: tokenAny})
+		case r == '*':
+			flush()
+			tokens = append(tokens, patternToken{kind: tokenStar})
+		default:
+			literal = append(literal, r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// closePositions adds to positions every position reachable by letting a '*' match nothing, returning the sorted set
+func closePositions(tokens []patternToken, positions []int) []int {
+	seen := make(map[int]bool, len(positions))
+	var closed []int
+	for len(positions) > 0 {
+		p := positions[len(positions)-1]
+		positions = positions[:len(positions)-1]
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		closed = append(closed, p)
+		if p < len(tokens) && tokens[p].kind == tokenStar {
+			positions = append(positions, p+1)
+		}
+	}
+	sort.Ints(closed)
+	return closed
+}
+
+/*
+stepPositions returns the closed set of pattern positions reached by consuming r from each of positions. joins is set
+when r continues the grapheme cluster of the rune before it with WithGraphemeClusters: a '?' then cannot consume r on
+its own, and a position just past a '?' stays put, so that the '?' takes in the whole cluster.
+*/
+func stepPositions(tokens []patternToken, positions []int, r rune, joins bool) []int {
+	var next []int
+	for _, p := range positions {
+		if joins && p > 0 && tokens[p-1].kind == tokenAny {
+			next = append(next, p)
+		}
+		if p == len(tokens) {
+			continue
+		}
+		switch tok := tokens[p]; tok.kind {
+		case tokenStar:
+			next = append(next, p)
+		case tokenAny:
+			if !joins {
+				next = append(next, p+1)
+			}
+		default:
+			if tok.r == r {
+				next = append(next, p+1)
+			}
+		}
+	}
+	return closePositions(tokens, next)
+}
+
+/*
+Match returns up to n ids stored under keys matching the wildcard pattern, where '?' matches exactly one rune, or one
+grapheme cluster with WithGraphemeClusters, and '*' matches any run of runes, including none. A backslash escapes the
+following rune so that literal '?', '*' and '\' in stored keys can be matched. The pattern is normalized like a key,
+as a whole, so whitespace next to a wildcard is kept where WithTrimSpace or WithCollapseSpace would keep it inside a
+key. Results come back deduplicated in lexicographic key order like GetMany.
+
+The trie is walked once while tracking the set of pattern positions each node can be reached in, so a branch is
+abandoned as soon as no position survives, and at positions that can only be followed by literals just those children
+are visited. The walk stops after visiting the configured visit budget of nodes (see WithVisitBudget), returning the
+results found so far, to protect against pathological patterns on large tries.
+*/
+func (t *GenericTrie[V]) Match(pattern string, n int) []V {
+	tokens := t.parsePattern(pattern)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	res := NewSet[V]()
+	ids := []V{}
+	budget := t.visitBudget()
+
+	type frame struct {
+		node      *GenericNode[V]
+		positions []int
+		state     clusterState
+	}
+	stack := []frame{{t.root, closePositions(tokens, []int{0}), clusterState{}}}
+	for len(stack) > 0 && res.Size() < n && budget > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		budget--
+		if f.positions[len(f.positions)-1] == len(tokens) {
+			for _, id := range f.node.liveVals(now) {
+				if res.Size() < n && !res.ContainsVal(id) {
+					res.SaveVal(id)
+					ids = append(ids, id)
+				}
+			}
+		}
+		runes := f.node.GetAllRunes()
+		// A '?' taking in a grapheme cluster may consume runes besides the literals
+		absorbing := t.cfg.graphemes && afterAny(tokens, f.positions)
+		if literals := literalRunes(tokens, f.positions); literals != nil && !absorbing {
+			runes = literals
+		}
+		// Push the children in reverse so they are popped in ascending rune order
+		for i := len(runes) - 1; i >= 0; i-- {
+			child := f.node.GetLink(runes[i])
+			if child == nil {
+				continue
+			}
+			joins := t.cfg.graphemes && f.state.joins(runes[i])
+			if next := stepPositions(tokens, f.positions, runes[i], joins); len(next) != 0 {
+				stack = append(stack, frame{child, next, f.state.push(runes[i])})
+			}
+		}
+	}
+	return ids
+}
+
+// afterAny reports whether any of positions directly follows a '?'
+func afterAny(tokens []patternToken, positions []int) bool {
+	for _, p := range positions {
+		if p > 0 && tokens[p-1].kind == tokenAny {
+			return true
+		}
+	}
+	return false
+}
+
+// literalRunes returns the sorted literal runes expected at positions, or nil if any position is a wildcard
+func literalRunes(tokens []patternToken, positions []int) []rune {
+	runes := []rune{}
+	for _, p := range positions {
+		if p == len(tokens) {
+			continue
+		}
+		if tokens[p].kind != tokenLiteral {
+			return nil
+		}
+		runes = append(runes, tokens[p].r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes
+}
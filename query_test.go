@@ -0,0 +1,218 @@
+package indexes
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"unicode"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestLongestPrefixMatch(t *testing.T) {
+	tr := NewTrie()
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("a", a)
+	tr.Add("ABC", b)
+	tr.Add("abcdef", c)
+	for _, q := range []struct {
+		s   string
+		key string
+		ids []bson.ObjectId
+		ok  bool
+	}{
+		{"a", "a", []bson.ObjectId{a}, true},
+		{"ab", "a", []bson.ObjectId{a}, true},
+		{"abc", "ABC", []bson.ObjectId{b}, true},
+		{"abcde", "ABC", []bson.ObjectId{b}, true},
+		{"abcdef", "abcdef", []bson.ObjectId{c}, true},
+		{"abcdefgh", "abcdef", []bson.ObjectId{c}, true},
+		{"b", "", []bson.ObjectId{}, false},
+		{"", "", []bson.ObjectId{}, false},
+	} {
+		key, ids, ok := tr.LongestPrefixMatch(q.s)
+		expect(t, fmt.Sprintf("LongestPrefixMatch(%q)", q.s), []interface{}{key, ids, ok}, []interface{}{q.key, q.ids, q.ok})
+	}
+}
+
+// TestMatchMultibyte checks wildcards consuming and surrounding multi-byte runes
+func TestMatchMultibyte(t *testing.T) {
+	tr := NewTrie()
+	keys := []string{"café", "cafe", "caffè", "東京", "東京都", "京都", "naïve", "a*b", "👍🏽ok"}
+	for i, key := range keys {
+		tr.Add(key, objectID(i))
+	}
+	for _, c := range []struct {
+		pattern string
+		want    []int
+	}{
+		{"caf?", []int{1, 0}},
+		{"caf*", []int{1, 2, 0}},
+		{"caf??", []int{2}},
+		{"東?", []int{3}},
+		{"東*", []int{3, 4}},
+		{"*都", []int{5, 4}},
+		{"?京*", []int{3, 4}},
+		{"na?ve", []int{6}},
+		{"*ï*", []int{6}},
+		{"??ok", []int{8}},
+		{`a\*b`, []int{7}},
+		{"*", []int{7, 1, 2, 0, 6, 5, 3, 4, 8}},
+		{"東??", []int{4}},
+		{"?", []int{}},
+	} {
+		want := []bson.ObjectId{}
+		for _, i := range c.want {
+			want = append(want, objectID(i))
+		}
+		expect(t, fmt.Sprintf("Match(%q)", c.pattern), tr.Match(c.pattern, 100), want)
+	}
+}
+
+// TestMatchNormalizedPattern checks that a pattern is normalized as a whole, keeping the whitespace next to its
+// wildcards as WithTrimSpace and WithCollapseSpace keep it inside keys
+func TestMatchNormalizedPattern(t *testing.T) {
+	tr := NewTrie(WithTrimSpace(), WithCollapseSpace())
+	for i, key := range []string{"de la", "dela", "de  xa", "dexa", " la paz", "lapaz"} {
+		tr.Add(key, objectID(i))
+	}
+	stripped := NewTrie(WithNormalizer(func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, s)
+	}))
+	stripped.Add("De-la", objectID(6))
+	bin := NewTrie(WithBinaryKeys())
+	bin.Add("\xff\x01a", objectID(7))
+	bin.Add("\xffa", objectID(8))
+	for _, c := range []struct {
+		tr      *Trie
+		pattern string
+		want    []int
+	}{
+		{tr, "de ?a", []int{0, 2}},
+		{tr, "de?a", []int{1, 3}},
+		{tr, "  de   *  ", []int{0, 2}},
+		{tr, "* paz", []int{4}},
+		{tr, "*paz", []int{4, 5}},
+		{tr, "de\\ ?a", []int{0, 2}},
+		// The normalizer drops the placeholders along with every other non-letter, so each run is normalized alone
+		{stripped, "D?LA", []int{6}},
+		{stripped, "*-la", []int{6}},
+		{bin, "\xff?a", []int{7}},
+		{bin, "\xff*", []int{7, 8}},
+	} {
+		want := []bson.ObjectId{}
+		for _, i := range c.want {
+			want = append(want, objectID(i))
+		}
+		expect(t, fmt.Sprintf("Match(%q)", c.pattern), c.tr.Match(c.pattern, 100), want)
+	}
+}
+
+// naiveIDs returns the sorted distinct ids of the keys of tr satisfying match, found by filtering ToMap
+func naiveIDs(tr *Trie, match func(key string) bool) []bson.ObjectId {
+	seen := map[bson.ObjectId]bool{}
+	ids := []bson.ObjectId{}
+	for key, vals := range tr.ToMap() {
+		if !match(key) {
+			continue
+		}
+		for _, id := range vals {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// sortedIDs returns a sorted copy of ids, for comparing results whose order is not under test
+func sortedIDs(ids []bson.ObjectId) []bson.ObjectId {
+	ids = append([]bson.ObjectId{}, ids...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// TestGetContainingInSync checks that GetContaining follows the primary keys through every method adding or removing them
+func TestGetContainingInSync(t *testing.T) {
+	tr := NewTrie(WithInfixIndex())
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	check := func(what string, substrs ...string) {
+		t.Helper()
+		for _, s := range substrs {
+			got := sortedIDs(tr.GetContaining(s, 100))
+			want := naiveIDs(tr, func(key string) bool { return strings.Contains(key, s) })
+			expect(t, fmt.Sprintf("GetContaining(%q) %s", s, what), got, want)
+		}
+	}
+	substrs := []string{"son", "anna", "a", "", "sonya", "x"}
+	tr.Add("Anderson", a)
+	tr.Add("sonya", b)
+	tr.Add("Hanna", c)
+	tr.Add("Johnson", c)
+	check("after Add", substrs...)
+	expect(t, "GetContaining in the middle of a key", tr.GetContaining("DERS", 10), []bson.ObjectId{a})
+	expect(t, "GetContaining of a whole key", tr.GetContaining("sonya", 10), []bson.ObjectId{b})
+
+	tr.Remove("johnson", c)
+	check("after Remove", substrs...)
+	expect(t, "GetContaining of a removed key", tr.GetContaining("hns", 10), []bson.ObjectId{})
+	if err := tr.Rename("sonya", "tanya"); err != nil {
+		t.Fatal(err)
+	}
+	check("after Rename", append(substrs, "tan", "nya")...)
+	expect(t, "GetContaining of the old name", tr.GetContaining("sony", 10), []bson.ObjectId{})
+	tr.Add("Annabel", a)
+	tr.RemoveID(a)
+	check("after RemoveID", substrs...)
+	tr.Add("bananas", b)
+	tr.DeleteSubtree("ban")
+	check("after DeleteSubtree", append(substrs, "nas")...)
+	tr.Clear()
+	check("after Clear", substrs...)
+	expect(t, "GetContaining without the option", NewTrie().GetContaining("", 10), []bson.ObjectId{})
+}
+
+// TestSuffixIndexRandom checks GetBySuffix and GetContaining against the primary keys through a random sequence of adds
+// and removes, with multi-byte runes so a byte-wise reversal would go wrong
+func TestSuffixIndexRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	letters := []rune("abé日")
+	tr := NewTrie(WithSuffixIndex(), WithInfixIndex())
+	for i := 0; i < 3000; i++ {
+		key, id := randomKey(rng, letters), objectID(rng.Intn(20))
+		switch rng.Intn(6) {
+		case 0, 1:
+			tr.Remove(key, id)
+		case 2:
+			tr.Rename(key, randomKey(rng, letters))
+		case 3:
+			tr.RemoveID(id)
+		default:
+			tr.Add(key, id)
+		}
+		if i%50 != 0 {
+			continue
+		}
+		q := string([]rune(randomKey(rng, letters))[:1+rng.Intn(2)])
+		expect(t, fmt.Sprintf("GetBySuffix(%q) after %d operations", q, i), sortedIDs(tr.GetBySuffix(q, 100)),
+			naiveIDs(tr, func(key string) bool { return strings.HasSuffix(key, q) }))
+		expect(t, fmt.Sprintf("GetContaining(%q) after %d operations", q, i), sortedIDs(tr.GetContaining(q, 100)),
+			naiveIDs(tr, func(key string) bool { return strings.Contains(key, q) }))
+	}
+	tr = NewTrie(WithSuffixIndex())
+	tr.Add("user@example.com", objectID(1))
+	tr.Add("other@example.org", objectID(2))
+	tr.Add("café", objectID(3))
+	expect(t, "GetBySuffix of a domain", tr.GetBySuffix("@example.com", 10), []bson.ObjectId{objectID(1)})
+	expect(t, "GetBySuffix of a multi-byte rune", tr.GetBySuffix("fé", 10), []bson.ObjectId{objectID(3)})
+	expect(t, "GetBySuffix without the option", NewTrie().GetBySuffix("", 10), []bson.ObjectId{})
+}
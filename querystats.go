@@ -0,0 +1,98 @@
+package indexes
+
+import (
+	"sort"
+	"sync"
+)
+
+// QueryStat reports how often a prefix was looked up and how many ids the lookups returned on average
+type QueryStat struct {
+	Prefix     string
+	Count      int
+	AvgResults float64
+}
+
+/*
+queryStats counts lookups per prefix in at most capacity entries using the space-saving scheme: once full, a new prefix
+replaces the least counted one and inherits its count, so a prefix's count may be overestimated by the count it
+inherited but a frequent prefix is not pushed out by a stream of rare ones. The capacity is a multiple of the number
+of prefixes asked for to leave room for that churn. It has its own lock so recording never touches the Trie's.
+*/
+type queryStats struct {
+	mx       sync.Mutex
+	capacity int
+	entries  map[string]*queryCount
+}
+
+type queryCount struct {
+	count   int // lookups including those inherited from the entry it replaced
+	lookups int // lookups recorded for this prefix itself
+	results int // total ids returned over those lookups
+}
+
+// queryStatsSlack is how many entries queryStats keeps per prefix asked for with WithQueryStats
+const queryStatsSlack = 4
+
+func newQueryStats(topK int) *queryStats {
+	capacity := topK * queryStatsSlack
+	return &queryStats{capacity: capacity, entries: make(map[string]*queryCount, capacity)}
+}
+
+// record counts one lookup of prefix returning results ids. It does nothing on a nil queryStats.
+func (q *queryStats) record(prefix string, results int) {
+	if q == nil {
+		return
+	}
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	e := q.entries[prefix]
+	if e == nil {
+		if len(q.entries) >= q.capacity {
+			e = q.evict()
+		} else {
+			e = &queryCount{}
+		}
+		q.entries[prefix] = e
+	}
+	e.count++
+	e.lookups++
+	e.results += results
+}
+
+// evict removes the least counted entry and returns a fresh entry inheriting its count
+func (q *queryStats) evict() *queryCount {
+	var minKey string
+	var min *queryCount
+	for k, e := range q.entries {
+		if min == nil || e.count < min.count || (e.count == min.count && k < minKey) {
+			minKey, min = k, e
+		}
+	}
+	delete(q.entries, minKey)
+	return &queryCount{count: min.count}
+}
+
+// TopQueries returns up to n of the most looked up prefixes recorded since WithQueryStats was enabled, the most
+// frequent first and ties in prefix order. It returns nil if the Trie was created without WithQueryStats.
+func (t *GenericTrie[V]) TopQueries(n int) []QueryStat {
+	q := t.queries
+	if q == nil {
+		return nil
+	}
+	q.mx.Lock()
+	stats := make([]QueryStat, 0, len(q.entries))
+	for k, e := range q.entries {
+		stats = append(stats, QueryStat{Prefix: k, Count: e.count, AvgResults: float64(e.results) / float64(e.lookups)})
+	}
+	q.mx.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Prefix < stats[j].Prefix
+	})
+	if n >= 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
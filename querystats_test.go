@@ -0,0 +1,48 @@
+package indexes
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopQueries(t *testing.T) {
+	tr := NewTrie(WithQueryStats(2))
+	tr.Add("alice", objectID(1))
+	tr.Add("alina", objectID(2))
+	tr.Add("bob", objectID(3))
+	for i := 0; i < 3; i++ {
+		tr.GetMany("Al", 10)
+	}
+	tr.GetMany("al", 1)
+	tr.Get("bob")
+	tr.Get("BOB")
+	tr.GetMany("zed", 10)
+	expect(t, "TopQueries", tr.TopQueries(2), []QueryStat{
+		{Prefix: "al", Count: 4, AvgResults: 7.0 / 4},
+		{Prefix: "bob", Count: 2, AvgResults: 1},
+	})
+	expect(t, "TopQueries of everything", tr.TopQueries(-1)[2], QueryStat{Prefix: "zed", Count: 1, AvgResults: 0})
+	expect(t, "TopQueries without the option", NewTrie().TopQueries(5), []QueryStat(nil))
+}
+
+// TestTopQueriesBounded checks that a stream of distinct rare prefixes neither grows the stats past their capacity
+// nor pushes out a frequent prefix
+func TestTopQueriesBounded(t *testing.T) {
+	tr := NewTrie(WithQueryStats(3))
+	for i := 0; i < 10000; i++ {
+		tr.GetMany(fmt.Sprintf("rare %d", i), 1)
+		if i%10 == 0 {
+			tr.GetMany("frequent", 1)
+		}
+	}
+	if got := len(tr.queries.entries); got > 3*queryStatsSlack {
+		t.Fatalf("query stats hold %d entries, want at most %d", got, 3*queryStatsSlack)
+	}
+	top := tr.TopQueries(1)[0]
+	expect(t, "most frequent prefix", top.Prefix, "frequent")
+	// Its count may include what it inherited from the entry it replaced, but never less than its own lookups
+	if top.Count < 1000 {
+		t.Fatalf("frequent prefix counted %d times, want at least 1000", top.Count)
+	}
+	expect(t, "number of TopQueries", len(tr.TopQueries(100)), 3*queryStatsSlack)
+}
@@ -0,0 +1,68 @@
+package indexes
+
+import (
+	"strings"
+)
+
+/*
+GetRange returns the stored keys in the half-open interval [lo, hi) with their ids, in sorted key order, until n ids
+have been collected in total, the last key's ids being cut short if needed. An empty lo starts from the first key
+and an empty hi runs to the last. Both bounds are normalized like keys. Only branches whose keys can fall inside the
+interval are visited: a branch is skipped if all its keys sort before lo, and the walk ends at the first key >= hi.
+*/
+func (t *GenericTrie[V]) GetRange(lo, hi string, n int) []GenericKeyMatch[V] {
+	lo, hi = t.normalize(lo), t.normalize(hi)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	matches := []GenericKeyMatch[V]{}
+	if n <= 0 {
+		return matches
+	}
+	total := 0
+	walkFrom(t.root, "", lo, func(key string, node *GenericNode[V]) bool {
+		if hi != "" && key >= hi {
+			// Every key still to be visited sorts after this one
+			return false
+		}
+		if node.hasLive(now) {
+			ids := node.liveVals(now)
+			if len(ids) > n-total {
+				ids = ids[:n-total]
+			}
+			matches = append(matches, GenericKeyMatch[V]{Key: node.displayKey(key), IDs: ids})
+			total += len(ids)
+		}
+		return total < n
+	})
+	return matches
+}
+
+// walkFrom visits, in lexicographic key order, every node below curr whose key is >= lo, skipping the branches whose
+// keys all sort before lo. base is the key of curr. The walk stops as soon as visit returns false.
+func walkFrom[V comparable](curr *GenericNode[V], base string, lo string, visit func(key string, node *GenericNode[V]) bool) {
+	if curr == nil {
+		return
+	}
+	type frame struct {
+		node *GenericNode[V]
+		key  string
+	}
+	stack := []frame{{curr, base}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.key < lo && !strings.HasPrefix(lo, f.key) {
+			// Every key in this branch sorts before lo
+			continue
+		}
+		if f.key >= lo && !visit(f.key, f.node) {
+			return
+		}
+		runes := f.node.GetAllRunes()
+		// Push the children in reverse so they are popped in ascending rune order
+		for i := len(runes) - 1; i >= 0; i-- {
+			stack = append(stack, frame{f.node.GetLink(runes[i]), f.key + string(runes[i])})
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package indexes
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// naiveRange filters m down to the keys in [lo, hi) in sorted order, cutting the ids short after n in total
+func naiveRange(m map[string][]bson.ObjectId, lo, hi string, n int) []KeyMatch {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if key >= lo && (hi == "" || key < hi) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	matches := []KeyMatch{}
+	for _, key := range keys {
+		if n <= 0 {
+			break
+		}
+		ids := m[key]
+		if len(ids) > n {
+			ids = ids[:n]
+		}
+		matches = append(matches, KeyMatch{Key: key, IDs: ids})
+		n -= len(ids)
+	}
+	return matches
+}
+
+func TestGetRangePrefixBounds(t *testing.T) {
+	tr := NewTrie()
+	for i, key := range []string{"a", "ab", "aba", "abb", "abc", "abca", "abd", "b"} {
+		tr.Add(key, objectID(i))
+	}
+	for _, q := range []struct {
+		lo, hi string
+		want   []string
+	}{
+		{"ab", "abc", []string{"ab", "aba", "abb"}},
+		{"abc", "ab", []string{}},
+		{"abc", "abd", []string{"abc", "abca"}},
+		{"ab", "ab", []string{}},
+		{"", "ab", []string{"a"}},
+		{"abca", "", []string{"abca", "abd", "b"}},
+		{"", "", []string{"a", "ab", "aba", "abb", "abc", "abca", "abd", "b"}},
+		{"aa", "abaa", []string{"ab", "aba"}},
+	} {
+		var got []string
+		for _, m := range tr.GetRange(q.lo, q.hi, 100) {
+			got = append(got, m.Key)
+		}
+		if got == nil {
+			got = []string{}
+		}
+		expect(t, fmt.Sprintf("GetRange(%q, %q)", q.lo, q.hi), got, q.want)
+	}
+}
+
+// TestGetRangeRandom checks GetRange against a naive filter over ToMap for random keys, bounds and limits
+func TestGetRangeRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	letters := []rune("abcé")
+	tr := NewTrie()
+	for i := 0; i < 500; i++ {
+		tr.Add(randomKey(rng, letters), objectID(rng.Intn(50)))
+	}
+	m := tr.ToMap()
+	bound := func() string {
+		if rng.Intn(5) == 0 {
+			return ""
+		}
+		return randomKey(rng, letters)
+	}
+	for i := 0; i < 1000; i++ {
+		lo, hi, n := bound(), bound(), rng.Intn(200)
+		expect(t, fmt.Sprintf("GetRange(%q, %q, %d)", lo, hi, n), tr.GetRange(lo, hi, n), naiveRange(m, lo, hi, n))
+	}
+}
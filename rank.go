@@ -0,0 +1,326 @@
+package indexes
+
+import (
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AddWeighted is Add storing weight alongside the id, for GetManyRanked. Adding a pair that is already stored updates
+// its weight; the returned bool still reports only whether the pair was newly stored.
+func (t *GenericTrie[V]) AddWeighted(key string, id V, weight float64) (bool, error) {
+	stored, err := t.storedKey(key)
+	if err != nil {
+		return false, err
+	}
+	t.mx.Lock()
+	defer t.unlock()
+	node, inserted := t.insert(stored, key, id)
+	node.putMeta(id).weight = weight
+	return inserted, nil
+}
+
+// SetWeight changes the weight of an id already stored at the exact key. Returns ErrKeyNotFound if the key holds no
+// values and ErrIDNotFound if the id is not stored at it.
+func (t *GenericTrie[V]) SetWeight(key string, id V, weight float64) error {
+	key = t.normalize(key)
+	t.mx.Lock()
+	defer t.unlock()
+	curr := findTip(key, t.root)
+	if curr == nil || curr.IDSet.Size() == 0 {
+		return ErrKeyNotFound
+	}
+	if !curr.ContainsVal(id) {
+		return ErrIDNotFound
+	}
+	curr.putMeta(id).weight = weight
+	t.wal.touch(key, id)
+	return nil
+}
+
+// RecordHit counts one hit for the id at the exact key, such as a user picking it from a completion list.
+// Recording a hit for a pair that is not stored does nothing.
+func (t *GenericTrie[V]) RecordHit(key string, id V) {
+	key = t.normalize(key)
+	now := t.now()
+	t.mx.Lock()
+	defer t.unlock()
+	if curr := findTip(key, t.root); curr != nil && curr.ContainsVal(id) {
+		m := curr.putMeta(id)
+		m.hits = t.decayed(m.hits, m.hitAt, now) + 1
+		m.hitAt = now
+		t.wal.touch(key, id)
+	}
+}
+
+// ResetHits sets every recorded hit count back to zero
+func (t *GenericTrie[V]) ResetHits() {
+	t.mx.Lock()
+	defer t.unlock()
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		for id, m := range node.meta {
+			if m.hits != 0 || !m.hitAt.IsZero() {
+				m.hits, m.hitAt = 0, time.Time{}
+				t.wal.touch(string(key), id)
+			}
+		}
+		return true
+	})
+}
+
+/*
+DecayNow applies the WithHitHalfLife decay to every hit count up to the current time. Counts are otherwise decayed
+lazily, when a hit is recorded and when they are ranked, so this is only needed to bring stored counts up to date,
+for instance before exporting them. It does nothing without WithHitHalfLife.
+*/
+func (t *GenericTrie[V]) DecayNow() {
+	if t.cfg.halfLife <= 0 {
+		return
+	}
+	now := t.now()
+	t.mx.Lock()
+	defer t.unlock()
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		for id, m := range node.meta {
+			if m.hits != 0 {
+				m.hits, m.hitAt = t.decayed(m.hits, m.hitAt, now), now
+				t.wal.touch(string(key), id)
+			}
+		}
+		return true
+	})
+}
+
+// decayed returns a hit count last updated at the given time as it stands at now, halving once per WithHitHalfLife
+// period. Without WithHitHalfLife counts never decay.
+func (t *GenericTrie[V]) decayed(hits float64, at, now time.Time) float64 {
+	if t.cfg.halfLife <= 0 || hits == 0 || !now.After(at) {
+		return hits
+	}
+	return hits * math.Exp2(-float64(now.Sub(at))/float64(t.cfg.halfLife))
+}
+
+// now returns the current time from the WithClock clock, or the system clock by default
+func (t *GenericTrie[V]) now() time.Time {
+	if t.cfg.clock != nil {
+		return t.cfg.clock()
+	}
+	return time.Now()
+}
+
+/*
+GetManyRanked returns the n distinct ids under keys starting with prefix with the highest weight, highest first,
+ranking ids of equal weight by their hit count, decayed to the current time with WithHitHalfLife. Ids added with plain Add weigh 0, so with no weights set the ranking is
+by hits alone, and ids tied on both keep GetMany order. An id stored under several matching keys ranks by its best
+(weight, hits) there, placed among its ties where that best was first met. Every matching node is visited, but only the best n ids are held while walking.
+*/
+func (t *GenericTrie[V]) GetManyRanked(prefix string, n int) []V {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	if n <= 0 {
+		return []V{}
+	}
+	top := newTopK(n, byWeight[V], true)
+	top.tie = valueOrder[V]()
+	now, cutoff := t.now(), t.cutoff()
+	walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		top.nextNode()
+		// The ids are ranked where they are stored rather than copied and sorted, so memory does not grow with the matches
+		for _, id := range node.IDSet.vals {
+			if node.expired(id, cutoff) {
+				continue
+			}
+			hits, at := node.hits(id)
+			top.offer(candidate[V]{id: id, weight: node.weight(id), hits: t.decayed(hits, at, now)})
+		}
+		return true
+	})
+	ids := []V{}
+	for _, c := range top.drain() {
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+// byWeight ranks candidates by weight, then by hits
+func byWeight[V comparable](a, b *candidate[V]) bool {
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	return a.hits < b.hits
+}
+
+// coverageScore is the default GetManyScored scorer: the fraction of the key's runes the query covers, so an exact
+// match scores 1 and shorter completions score above longer ones
+func coverageScore(query, key string) float64 {
+	return float64(utf8.RuneCountInString(query)) / float64(utf8.RuneCountInString(key))
+}
+
+/*
+GetManyScored returns the keys starting with prefix together with their ids, best scoring key first, until n ids have
+been collected in total, the last key's ids being cut short if needed. Keys are scored by the WithScorer function, by
+default the share of the key the query covers: the exact key comes first, then the shortest completions. Keys with
+equal scores come back in lexicographic order.
+*/
+func (t *GenericTrie[V]) GetManyScored(prefix string, n int) []GenericKeyMatch[V] {
+	prefix = t.normalize(prefix)
+	score := t.cfg.scorer
+	if score == nil {
+		score = coverageScore
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	matches := []GenericKeyMatch[V]{}
+	if n <= 0 {
+		return matches
+	}
+	// Every key holds at least one id, so the best n keys always cover the best n ids
+	top := newTopK(n, func(a, b *candidate[V]) bool { return a.score < b.score }, false)
+	walk(t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		if node.hasLive(now) {
+			k := string(key)
+			top.offer(candidate[V]{key: k, node: node, score: score(prefix, k)})
+		}
+		return true
+	})
+	total := 0
+	for _, k := range top.drain() {
+		ids := k.node.liveVals(now)
+		if len(ids) > n-total {
+			ids = ids[:n-total]
+		}
+		matches = append(matches, GenericKeyMatch[V]{Key: k.node.displayKey(k.key), IDs: ids})
+		if total += len(ids); total == n {
+			break
+		}
+	}
+	return matches
+}
+
+// GetManyByTime returns the n distinct ids under keys starting with prefix with the newest creation time embedded
+// in the ObjectId, newest first, or the oldest n, oldest first, if newestFirst is false. Ids created in the same
+// second are ordered by their bytes in the same direction. Values other than ObjectIds carry no time and are ordered
+// by their natural order alone. Only the n best ids are held while walking.
+func (t *GenericTrie[V]) GetManyByTime(prefix string, n int, newestFirst bool) []V {
+	prefix = t.normalize(prefix)
+	order := valueOrder[V]()
+	less := func(a, b *candidate[V]) bool {
+		at, bt := valueTime(a.id), valueTime(b.id)
+		if !at.Equal(bt) {
+			return at.Before(bt) == newestFirst
+		}
+		return order != nil && order(a.id, b.id) == newestFirst
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	top := newTopK(n, less, true)
+	walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		// less orders every pair of ids, so the ids need no sorting first
+		for _, id := range node.IDSet.vals {
+			if !node.expired(id, now) {
+				top.offer(candidate[V]{id: id})
+			}
+		}
+		return true
+	})
+	ids := []V{}
+	for _, c := range top.drain() {
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+// GenericIDCount pairs an id with the number of distinct matching keys it is stored under
+type GenericIDCount[V comparable] struct {
+	ID      V
+	Matches int
+}
+
+// IDCount is the GenericIDCount of a Trie
+type IDCount = GenericIDCount[bson.ObjectId]
+
+// GetManyCounted returns the n ids stored under the most distinct keys starting with prefix, with those counts,
+// most matches first. Ids with equal counts keep GetMany order. Unlike GetMany the whole subtree is tallied before
+// any id is returned, since an id's count is only known once every key has been seen.
+func (t *GenericTrie[V]) GetManyCounted(prefix string, n int) []GenericIDCount[V] {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	counts := make(map[V]int)
+	var order []V
+	walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			if counts[id] == 0 {
+				order = append(order, id)
+			}
+			counts[id]++
+		}
+		return true
+	})
+	top := newTopK(n, func(a, b *candidate[V]) bool { return a.score < b.score }, false)
+	for _, id := range order {
+		top.offer(candidate[V]{id: id, score: float64(counts[id])})
+	}
+	res := []GenericIDCount[V]{}
+	for _, c := range top.drain() {
+		res = append(res, GenericIDCount[V]{ID: c.id, Matches: counts[c.id]})
+	}
+	return res
+}
+
+// GenericMatch is one (key, id) pair offered to a GetManyOrdered comparator, with what is stored alongside it
+type GenericMatch[V comparable] struct {
+	Key    string
+	ID     V
+	Weight float64
+	Hits   float64 // decayed to the current time with WithHitHalfLife
+}
+
+// Match is the GenericMatch of a Trie
+type Match = GenericMatch[bson.ObjectId]
+
+/*
+GetManyOrdered returns the first n (key, id) pairs under keys starting with prefix in the order defined by less, which
+reports whether a sorts before b. Pairs less leaves tied keep GetManyWithKeys order, which is also the order given a
+nil less. An id stored under several matching keys is offered once per key. Only the first n pairs are held while
+walking; less runs under the read lock, so it must not call back into the Trie.
+*/
+func (t *GenericTrie[V]) GetManyOrdered(prefix string, n int, less func(a, b GenericMatch[V]) bool) []GenericMatch[V] {
+	prefix = t.normalize(prefix)
+	rank := func(a, b *candidate[V]) bool { return false }
+	if less != nil {
+		// topK wants to know whether a ranks below b, which is whether b sorts first
+		rank = func(a, b *candidate[V]) bool { return less(b.match(), a.match()) }
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	top := newTopK(n, rank, false)
+	now, cutoff := t.now(), t.cutoff()
+	walk(t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		if !node.hasLive(cutoff) {
+			return true
+		}
+		k := string(key)
+		for _, id := range node.liveVals(cutoff) {
+			hits, at := node.hits(id)
+			top.offer(candidate[V]{key: node.displayKey(k), id: id, weight: node.weight(id), hits: t.decayed(hits, at, now)})
+		}
+		return true
+	})
+	matches := []GenericMatch[V]{}
+	for _, c := range top.drain() {
+		matches = append(matches, c.match())
+	}
+	return matches
+}
+
+// match returns the candidate as a Match
+func (c *candidate[V]) match() GenericMatch[V] {
+	return GenericMatch[V]{Key: c.key, ID: c.id, Weight: c.weight, Hits: c.hits}
+}
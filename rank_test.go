@@ -0,0 +1,263 @@
+package indexes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestGetManyRankedDeep checks that high weights deep in a large subtree still win, without changing GetMany
+func TestGetManyRankedDeep(t *testing.T) {
+	tr := largeTrie(t, 5000)
+	heavy, heavier := objectID(5000), objectID(5001)
+	tr.AddWeighted("azzzzzzzzzzz", heavy, 10)
+	tr.AddWeighted("aaaaaazzzzzzzz", heavier, 20)
+	tr.AddWeighted("aaaaab", objectID(1), 5)
+	tr.AddWeighted("aaaaac", objectID(2), -1)
+	expect(t, "GetManyRanked", tr.GetManyRanked("a", 3), []bson.ObjectId{heavier, heavy, objectID(1)})
+	expect(t, "GetManyRanked of part of the subtree", tr.GetManyRanked("aaaaa", 2), []bson.ObjectId{heavier, objectID(1)})
+	// Unweighted ids tie at 0 and keep GetMany order, after the positive weights and before the negative ones
+	ranked := tr.GetManyRanked("a", 5003)
+	expect(t, "GetManyRanked of everything", ranked[:5], []bson.ObjectId{heavier, heavy, objectID(1), objectID(0), objectID(3)})
+	expect(t, "GetManyRanked last", ranked[len(ranked)-1], objectID(2))
+
+	expect(t, "GetMany ignoring weights", tr.GetMany("aaaaa", 3), []bson.ObjectId{objectID(0), heavier, objectID(1)})
+	if _, err := tr.AddWeighted("aaaaaa", objectID(0), 30); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "GetManyRanked after reweighting", tr.GetManyRanked("a", 1), []bson.ObjectId{objectID(0)})
+	if err := tr.SetWeight("AZZZZZZZZZZZ", heavy, 40); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "GetManyRanked after SetWeight", tr.GetManyRanked("a", 1), []bson.ObjectId{heavy})
+	expect(t, "SetWeight of a missing key", tr.SetWeight("b", heavy, 1), ErrKeyNotFound)
+	expect(t, "SetWeight of a missing id", tr.SetWeight("aaaaaa", heavy, 1), ErrIDNotFound)
+	for _, n := range []int{0, -1} {
+		expect(t, fmt.Sprintf("GetManyRanked(%d)", n), tr.GetManyRanked("a", n), []bson.ObjectId{})
+	}
+}
+
+// TestRecordHit checks that hits overtake GetMany order, survive Clone and serialization, and that recording a hit
+// for a pair that is not stored changes nothing
+func TestRecordHit(t *testing.T) {
+	tr := NewTrie()
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("pasta", a)
+	tr.Add("pizza", b)
+	tr.Add("pie", c)
+	expect(t, "GetManyRanked with no hits", tr.GetManyRanked("p", 3), []bson.ObjectId{a, c, b})
+	for i := 0; i < 3; i++ {
+		tr.RecordHit("Pizza", b)
+	}
+	tr.RecordHit("pie", c)
+	expect(t, "GetManyRanked after hits", tr.GetManyRanked("p", 3), []bson.ObjectId{b, c, a})
+	// A weight still outranks any number of hits
+	tr.SetWeight("pasta", a, 1)
+	expect(t, "GetManyRanked with a weight", tr.GetManyRanked("p", 3), []bson.ObjectId{a, b, c})
+	tr.SetWeight("pasta", a, 0)
+
+	before := marshalBinary(t, tr)
+	generation := tr.Generation()
+	tr.RecordHit("pizza", a)
+	tr.RecordHit("pi", b)
+	tr.RecordHit("missing", c)
+	expect(t, "contents after RecordHit of missing pairs", marshalBinary(t, tr), before)
+	expect(t, "Generation after RecordHit of missing pairs", tr.Generation(), generation)
+	expect(t, "Get after RecordHit of missing pairs", tr.Get("pizza"), []bson.ObjectId{b})
+
+	clone := tr.Clone()
+	copied := decodeState(t, marshalBinary(t, tr))
+	for i := 0; i < 5; i++ {
+		tr.RecordHit("pasta", a)
+	}
+	expect(t, "GetManyRanked of the clone", clone.GetManyRanked("p", 3), []bson.ObjectId{b, c, a})
+	expect(t, "GetManyRanked after decoding", copied.GetManyRanked("p", 3), []bson.ObjectId{b, c, a})
+	expect(t, "GetManyRanked of the original", tr.GetManyRanked("p", 3), []bson.ObjectId{a, b, c})
+
+	tr.ResetHits()
+	expect(t, "GetManyRanked after ResetHits", tr.GetManyRanked("p", 3), []bson.ObjectId{a, c, b})
+	expect(t, "GetManyRanked of the clone after ResetHits", clone.GetManyRanked("p", 3), []bson.ObjectId{b, c, a})
+}
+
+// keysOf returns the keys of matches in order
+func keysOf(matches []KeyMatch) []string {
+	keys := []string{}
+	for _, m := range matches {
+		keys = append(keys, m.Key)
+	}
+	return keys
+}
+
+// TestGetManyScoredExactFirst checks that the exact key comes first, then shorter completions, with ties in key order
+func TestGetManyScoredExactFirst(t *testing.T) {
+	tr := NewTrie()
+	for i, key := range []string{"carpet", "car", "cartel", "cart", "carb", "carbonara", "card", "cars", "cat"} {
+		tr.Add(key, objectID(i))
+	}
+	expect(t, "GetManyScored", keysOf(tr.GetManyScored("car", 20)),
+		[]string{"car", "carb", "card", "cars", "cart", "carpet", "cartel", "carbonara"})
+	expect(t, "GetManyScored of a longer key", keysOf(tr.GetManyScored("cart", 20)), []string{"cart", "cartel"})
+	expect(t, "GetManyScored without an exact key", keysOf(tr.GetManyScored("ca", 20)),
+		[]string{"car", "cat", "carb", "card", "cars", "cart", "carpet", "cartel", "carbonara"})
+	expect(t, "GetManyScored stopping at n", keysOf(tr.GetManyScored("car", 3)), []string{"car", "carb", "card"})
+	tr.Add("car", objectID(20))
+	expect(t, "GetManyScored cutting the last key short", tr.GetManyScored("car", 3), []KeyMatch{
+		{Key: "car", IDs: []bson.ObjectId{objectID(1), objectID(20)}},
+		{Key: "carb", IDs: []bson.ObjectId{objectID(4)}},
+	})
+
+	// A scorer preferring longer keys reverses the order, keeping ties in key order
+	tr = NewTrie(WithScorer(func(query, key string) float64 { return float64(len(key)) }))
+	for i, key := range []string{"car", "cart", "card", "carpet"} {
+		tr.Add(key, objectID(i))
+	}
+	expect(t, "GetManyScored with a scorer", keysOf(tr.GetManyScored("car", 20)), []string{"carpet", "card", "cart", "car"})
+}
+
+// timedID returns an ObjectId created at the given second, its remaining bytes i
+func timedID(sec int64, i int) bson.ObjectId {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b, uint32(sec))
+	binary.BigEndian.PutUint64(b[4:], uint64(i))
+	return bson.ObjectId(b)
+}
+
+func TestGetManyByTime(t *testing.T) {
+	tr := NewTrie()
+	oldest, old, tieLow, tieHigh, newest := timedID(1000, 9), timedID(2000, 1), timedID(3000, 1), timedID(3000, 2), timedID(4000, 0)
+	tr.Add("news/a", tieHigh)
+	tr.Add("news/b", oldest)
+	tr.Add("news/c", newest)
+	tr.Add("news/c/d", old)
+	tr.Add("news/e", tieLow)
+	tr.Add("news/f", newest)
+	tr.Add("other", timedID(5000, 0))
+	expect(t, "GetManyByTime newest first", tr.GetManyByTime("news", 10, true), []bson.ObjectId{newest, tieHigh, tieLow, old, oldest})
+	expect(t, "GetManyByTime oldest first", tr.GetManyByTime("news", 10, false), []bson.ObjectId{oldest, old, tieLow, tieHigh, newest})
+	expect(t, "GetManyByTime newest n", tr.GetManyByTime("news", 2, true), []bson.ObjectId{newest, tieHigh})
+	expect(t, "GetManyByTime oldest n", tr.GetManyByTime("news", 3, false), []bson.ObjectId{oldest, old, tieLow})
+	expect(t, "GetManyByTime of a sub-prefix", tr.GetManyByTime("news/c", 10, true), []bson.ObjectId{newest, old})
+	expect(t, "GetManyByTime of nothing", tr.GetManyByTime("news", 0, true), []bson.ObjectId{})
+	expect(t, "GetManyByTime of a missing prefix", tr.GetManyByTime("x", 5, false), []bson.ObjectId{})
+}
+
+// TestGetManyCounted checks that an id stored at three matching keys outranks ids stored at one
+func TestGetManyCounted(t *testing.T) {
+	tr := NewTrie()
+	a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+	tr.Add("sam", a)
+	tr.Add("sam", b)
+	tr.Add("samantha", c)
+	tr.Add("samuel", d)
+	tr.Add("samuel", c)
+	tr.Add("samwise", c)
+	tr.Add("samwise", d)
+	tr.Add("bob", a)
+	tr.Add("bob", b)
+	expect(t, "GetManyCounted", tr.GetManyCounted("sam", 10), []IDCount{{ID: c, Matches: 3}, {ID: d, Matches: 2}, {ID: a, Matches: 1}, {ID: b, Matches: 1}})
+	expect(t, "GetManyCounted stopping at n", tr.GetManyCounted("sam", 2), []IDCount{{ID: c, Matches: 3}, {ID: d, Matches: 2}})
+	expect(t, "GetManyCounted of a narrower prefix", tr.GetManyCounted("samu", 10), []IDCount{{ID: c, Matches: 1}, {ID: d, Matches: 1}})
+	expect(t, "GetManyCounted of everything", tr.GetManyCounted("", 3), []IDCount{{ID: c, Matches: 3}, {ID: a, Matches: 2}, {ID: b, Matches: 2}})
+	expect(t, "GetManyCounted of a missing prefix", tr.GetManyCounted("x", 10), []IDCount{})
+}
+
+// TestGetManyFielded checks that a user matched through two fields ranks above users matched through one
+func TestGetManyFielded(t *testing.T) {
+	tr := NewTrie()
+	jordan, jo, joanna, plain := objectID(1), objectID(2), objectID(3), objectID(4)
+	tr.AddTagged("Jordan", jordan, "first")
+	tr.AddTagged("jordan99", jordan, "username")
+	tr.AddTagged("Jo", jo, "first")
+	tr.AddTagged("Smith", jo, "last")
+	tr.AddTagged("Joanna", joanna, "first")
+	tr.AddTagged("Joanna", joanna, "first")
+	tr.AddTagged("joanna", joanna, "nickname")
+	tr.Add("jonas", plain)
+	expect(t, "GetManyFielded", tr.GetManyFielded("jo", 10), []FieldedMatch{
+		{ID: joanna, Fields: []string{"first", "nickname"}},
+		{ID: jordan, Fields: []string{"first", "username"}},
+		{ID: jo, Fields: []string{"first"}},
+		{ID: plain, Fields: []string{}},
+	})
+	expect(t, "GetManyFielded stopping at n", tr.GetManyFielded("jo", 1), []FieldedMatch{{ID: joanna, Fields: []string{"first", "nickname"}}})
+	expect(t, "GetManyFielded of one field", tr.GetManyFielded("jord", 10), []FieldedMatch{{ID: jordan, Fields: []string{"first", "username"}}})
+	expect(t, "Get of a tagged key", tr.Get("jo"), []bson.ObjectId{jo})
+	inserted, err := tr.AddTagged("jo", jo, "last")
+	expect(t, "AddTagged of a stored pair", []interface{}{inserted, err}, []interface{}{false, nil})
+	expect(t, "GetManyFielded after tagging again", tr.GetManyFielded("jo", 3)[0], FieldedMatch{ID: jo, Fields: []string{"first", "last"}})
+}
+
+// TestHitHalfLife checks that an id hit often long ago falls below one hit recently, under an injected clock
+func TestHitHalfLife(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tr := NewTrie(WithHitHalfLife(time.Hour), WithClock(func() time.Time { return now }))
+	old, recent := objectID(1), objectID(2)
+	tr.Add("song one", old)
+	tr.Add("song two", recent)
+	for i := 0; i < 8; i++ {
+		tr.RecordHit("song one", old)
+	}
+	now = now.Add(2 * time.Hour)
+	tr.RecordHit("song two", recent)
+	tr.RecordHit("song two", recent)
+	// 8 hits two half-lives ago weigh as 2 now, tied with the 2 recent ones, so GetMany order decides
+	expect(t, "GetManyRanked at the tie", tr.GetManyRanked("song", 2), []bson.ObjectId{old, recent})
+	now = now.Add(time.Hour)
+	expect(t, "GetManyRanked an hour later", tr.GetManyRanked("song", 2), []bson.ObjectId{old, recent})
+	tr.RecordHit("song two", recent)
+	expect(t, "GetManyRanked after another recent hit", tr.GetManyRanked("song", 2), []bson.ObjectId{recent, old})
+
+	hits := func(key string, id bson.ObjectId) float64 {
+		h, _ := findTip(key, tr.root).hits(id)
+		return h
+	}
+	expect(t, "stored hits before DecayNow", hits("song one", old), 8.0)
+	tr.DecayNow()
+	expect(t, "stored hits after DecayNow", hits("song one", old), 1.0)
+	expect(t, "recent hits after DecayNow", hits("song two", recent), 2.0)
+	expect(t, "GetManyRanked after DecayNow", tr.GetManyRanked("song", 2), []bson.ObjectId{recent, old})
+
+	// Without the option hits never decay
+	tr = NewTrie(WithClock(func() time.Time { return now }))
+	tr.Add("a", old)
+	tr.RecordHit("a", old)
+	now = now.Add(100 * time.Hour)
+	tr.DecayNow()
+	expect(t, "hits without a half-life", hits("a", old), 1.0)
+}
+
+// TestGetManyOrdered checks two comparators against sorting every pair, for limits below and above the number of pairs
+func TestGetManyOrdered(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr := NewTrie()
+	for i := 0; i < 500; i++ {
+		tr.AddWeighted(randomKey(rng, []rune("abc")), objectID(rng.Intn(200)), float64(rng.Intn(10)))
+	}
+	all := tr.GetManyOrdered("", 10000, nil)
+	var pairs []Match
+	for _, m := range tr.GetManyWithKeys("", 10000) {
+		for _, id := range m.IDs {
+			pairs = append(pairs, Match{Key: m.Key, ID: id})
+		}
+	}
+	expect(t, "number of pairs", len(all), len(pairs))
+	for i, m := range all {
+		expect(t, fmt.Sprintf("pair %d in key order", i), Match{Key: m.Key, ID: m.ID}, pairs[i])
+	}
+	for name, less := range map[string]func(a, b Match) bool{
+		"heaviest first":     func(a, b Match) bool { return a.Weight > b.Weight },
+		"shortest key first": func(a, b Match) bool { return len(a.Key) < len(b.Key) },
+	} {
+		want := append([]Match{}, all...)
+		sort.SliceStable(want, func(i, j int) bool { return less(want[i], want[j]) })
+		for _, n := range []int{1, 3, 50, len(all), len(all) + 10} {
+			expect(t, fmt.Sprintf("GetManyOrdered %s, n = %d", name, n), tr.GetManyOrdered("", n, less), want[:minInt(n, len(want))])
+		}
+	}
+	expect(t, "GetManyOrdered of nothing", tr.GetManyOrdered("", 0, nil), []Match{})
+}
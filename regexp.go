@@ -0,0 +1,67 @@
+package indexes
+
+import (
+	"regexp"
+	"regexp/syntax"
+)
+
+/*
+MatchRegexp returns the stored keys matching re together with their ids, in lexicographic key order, until n ids have
+been collected in total, the last key's ids being cut short if needed. Keys are matched in their stored (normalized)
+form and returned in their display form. When re is anchored at the start of the text and its literal prefix is
+already in stored form, only the branch under that prefix is walked, so patterns like `^ab\d+$` do not visit the whole
+trie; a prefix normalization would change, such as `^Ab` or a non-ASCII prefix with WithBinaryKeys, prunes nothing.
+The walk stops after the configured visit budget of nodes (see WithVisitBudget); truncated reports that it stopped
+with nodes left unvisited before n ids were found, so the result may be missing matches.
+*/
+func (t *GenericTrie[V]) MatchRegexp(re *regexp.Regexp, n int) (matches []GenericKeyMatch[V], truncated bool) {
+	prefix := ""
+	if anchoredStart(re) {
+		if lit, _ := re.LiteralPrefix(); t.normalize(lit) == lit {
+			prefix = lit
+		}
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	now := t.cutoff()
+	matches = []GenericKeyMatch[V]{}
+	if n <= 0 {
+		return matches, false
+	}
+	total := 0
+	budget := t.visitBudget()
+	walk(findTip(prefix, t.root), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		if budget == 0 {
+			truncated = true
+			return false
+		}
+		budget--
+		if node.hasLive(now) {
+			if k := string(key); re.MatchString(k) {
+				ids := node.liveVals(now)
+				if len(ids) > n-total {
+					ids = ids[:n-total]
+				}
+				matches = append(matches, GenericKeyMatch[V]{Key: node.displayKey(k), IDs: ids})
+				total += len(ids)
+			}
+		}
+		return total < n
+	})
+	return matches, truncated
+}
+
+// anchoredStart reports whether every match of re must begin at the start of the text
+func anchoredStart(re *regexp.Regexp) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	for parsed.Op == syntax.OpConcat || parsed.Op == syntax.OpCapture {
+		if len(parsed.Sub) == 0 {
+			return false
+		}
+		parsed = parsed.Sub[0]
+	}
+	return parsed.Op == syntax.OpBeginText
+}
@@ -0,0 +1,74 @@
+package indexes
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestMatchRegexpPruning counts the nodes an anchored pattern visits through the visit budget: the branch under "ab"
+// holds the nodes ab, ab1, ab2, ab22, ab3 and abc, while the keys under "aa" before it are only reached by a walk
+// from the root
+func TestMatchRegexpPruning(t *testing.T) {
+	build := func(budget int) *Trie {
+		tr := NewTrie(WithVisitBudget(budget))
+		for i := 0; i < 100; i++ {
+			tr.Add(fmt.Sprintf("aa%03d", i), objectID(100+i))
+		}
+		tr.Add("ab1", objectID(1))
+		tr.Add("ab22", objectID(2))
+		tr.Add("Ab3", objectID(3))
+		tr.Add("abc", objectID(4))
+		return tr
+	}
+	want := []KeyMatch{{"ab1", []bson.ObjectId{objectID(1)}}, {"ab22", []bson.ObjectId{objectID(2)}}, {"Ab3", []bson.ObjectId{objectID(3)}}}
+	for _, c := range []struct {
+		pattern   string
+		budget    int
+		want      []KeyMatch
+		truncated bool
+	}{
+		{`^ab\d+$`, 6, want, false},
+		{`^ab\d+$`, 5, want, true},
+		{`^ab\d+$`, 4, want[:2], true},
+		{`ab\d+$`, 6, []KeyMatch{}, true},
+		// Stored keys are folded, so "Ab" matches none of them and cannot prune
+		{`^Ab\d+$`, 6, []KeyMatch{}, true},
+		{`^Ab\d+$`, 1000, []KeyMatch{}, false},
+		{`(?i)^Ab\d+$`, 1000, want, false},
+	} {
+		got, truncated := build(c.budget).MatchRegexp(regexp.MustCompile(c.pattern), 10)
+		expect(t, fmt.Sprintf("MatchRegexp(%s) with a budget of %d", c.pattern, c.budget), got, c.want)
+		expect(t, fmt.Sprintf("truncated MatchRegexp(%s) with a budget of %d", c.pattern, c.budget), truncated, c.truncated)
+	}
+
+	tr := build(1000)
+	got, truncated := tr.MatchRegexp(regexp.MustCompile(`^ab`), 3)
+	expect(t, "MatchRegexp cut at n ids", got, []KeyMatch{{"ab1", []bson.ObjectId{objectID(1)}}, {"ab22", []bson.ObjectId{objectID(2)}}, {"Ab3", []bson.ObjectId{objectID(3)}}})
+	expect(t, "truncated MatchRegexp cut at n ids", truncated, false)
+	tr.Add("ab1", objectID(5))
+	got, _ = tr.MatchRegexp(regexp.MustCompile(`^ab`), 2)
+	expect(t, "MatchRegexp cutting a key's ids", got, []KeyMatch{{"ab1", []bson.ObjectId{objectID(1), objectID(5)}}})
+	got, _ = tr.MatchRegexp(regexp.MustCompile(`^ab`), 0)
+	expect(t, "MatchRegexp of no ids", got, []KeyMatch{})
+}
+
+// TestMatchRegexpNormalizedPrefix checks that a literal prefix whose stored form differs is not used to prune
+func TestMatchRegexpNormalizedPrefix(t *testing.T) {
+	bin := NewTrie(WithBinaryKeys())
+	bin.Add("\xffa1", objectID(1))
+	bin.Add("\xffb", objectID(2))
+	bin.Add("\xc3\xbfa", objectID(3))
+	got, _ := bin.MatchRegexp(regexp.MustCompile(`^\x{ff}a`), 10)
+	expect(t, "MatchRegexp of a binary prefix", got, []KeyMatch{{"\xffa1", []bson.ObjectId{objectID(1)}}})
+
+	spaced := NewTrie(WithCollapseSpace())
+	spaced.Add("a  b", objectID(1))
+	spaced.Add("ab", objectID(2))
+	got, _ = spaced.MatchRegexp(regexp.MustCompile(`^a  b`), 10)
+	expect(t, "MatchRegexp of an uncollapsed prefix", got, []KeyMatch{})
+	got, _ = spaced.MatchRegexp(regexp.MustCompile(`^a b`), 10)
+	expect(t, "MatchRegexp of a collapsed prefix", got, []KeyMatch{{"a  b", []bson.ObjectId{objectID(1)}}})
+}
@@ -0,0 +1,47 @@
+package indexes
+
+import (
+	"bufio"
+	"io"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+/*
+Save streams the Trie to w in the binary snapshot format of MarshalBinary, one key record at a time through a
+buffered writer, so that beyond the buffer no more than one record is held in memory however large the Trie. It holds
+the read lock for the whole write, so writers wait until Save returns; to keep them waiting only while the Trie is
+copied, Save a Clone instead.
+*/
+func (t *GenericTrie[V]) Save(w io.Writer) error {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	bw := bufio.NewWriter(w)
+	e := &binaryEncoder[V]{w: bw, codec: codecOf[V]()}
+	e.header(t.keys)
+	if err := t.snapshot(e.key); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Load builds a Trie from a snapshot written by Save or MarshalBinary, adding each key as its record arrives so that
+// the encoded snapshot is never held in memory. It must be given the options of the Trie that was saved. Errors are
+// those of UnmarshalBinary; with WithPartialLoad, a corrupt snapshot returns the keys before the failed record along
+// with the error. Since r is read through a buffer, Load may consume data past the end of the snapshot.
+func Load(r io.Reader, opts ...Option) (*Trie, error) {
+	return LoadGeneric[bson.ObjectId](r, opts...)
+}
+
+// LoadGeneric is Load for a GenericTrie, such as a StringTrie
+func LoadGeneric[V comparable](r io.Reader, opts ...Option) (*GenericTrie[V], error) {
+	sr, ok := r.(snapshotReader)
+	if !ok {
+		sr = bufio.NewReader(r)
+	}
+	t, err := decodeBinary[V](sr, newConfig(opts))
+	if t != nil {
+		t.startWAL()
+	}
+	return t, err
+}
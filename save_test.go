@@ -0,0 +1,58 @@
+package indexes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// TestSaveLoadPipe streams Save straight into Load through io.Pipe, so neither side ever holds the whole snapshot
+func TestSaveLoadPipe(t *testing.T) {
+	tr, data := snapshotFixture(t, 5000)
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(tr.Save(w))
+	}()
+	loaded, err := Load(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshalBinary(t, loaded), data) {
+		t.Fatal("Trie loaded through a pipe differs from the original")
+	}
+	expect(t, "GetManyWithKeys after loading", loaded.GetManyWithKeys("key 01", 50), tr.GetManyWithKeys("key 01", 50))
+
+	st := NewStringTrie()
+	st.Add("Ada", "user:1")
+	st.Add("Adams", "user:2")
+	r, w = io.Pipe()
+	go func() {
+		w.CloseWithError(st.Save(w))
+	}()
+	loadedStrings, err := LoadGeneric[string](r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "StringTrie loaded through a pipe", loadedStrings.ToMap(), st.ToMap())
+}
+
+// TestSaveLoadPipeBroken checks that a stream cut off partway surfaces as an error on both ends
+func TestSaveLoadPipeBroken(t *testing.T) {
+	tr, data := snapshotFixture(t, 5000)
+	cut := errors.New("connection reset")
+	r, w := io.Pipe()
+	saved := make(chan error, 1)
+	go func() {
+		saved <- tr.Save(w)
+	}()
+	// Read half the snapshot, then fail the stream
+	_, err := Load(io.LimitReader(r, int64(len(data)/2)))
+	if !errors.Is(err, ErrTruncatedSnapshot) {
+		t.Fatalf("Load of half a stream = %v, want ErrTruncatedSnapshot", err)
+	}
+	r.CloseWithError(cut)
+	if err := <-saved; !errors.Is(err, cut) {
+		t.Fatalf("Save to a closed pipe = %v, want %v", err, cut)
+	}
+}
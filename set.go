@@ -0,0 +1,70 @@
+package indexes
+
+import "gopkg.in/mgo.v2/bson"
+
+// Set holds the distinct values stored at a node. It does no locking of its own; the Trie holding it guards it.
+type Set[V comparable] struct {
+	index map[V]int // position of each value in vals
+	vals  []V
+}
+
+// IDSet is the Set of ObjectIds held by the nodes of a Trie
+type IDSet = Set[bson.ObjectId]
+
+// NewSet returns an empty Set
+func NewSet[V comparable]() *Set[V] {
+	return &Set[V]{index: make(map[V]int)}
+}
+
+// NewIDSet returns an empty IDSet
+func NewIDSet() *IDSet {
+	return NewSet[bson.ObjectId]()
+}
+
+// SaveVal stores v in the set, returning false if it was already there
+func (s *Set[V]) SaveVal(v V) bool {
+	if _, ok := s.index[v]; ok {
+		return false
+	}
+	s.index[v] = len(s.vals)
+	s.vals = append(s.vals, v)
+	return true
+}
+
+// Remove deletes v from the set, returning false if it was not there. The last value takes v's place, so removing is
+// O(1) whatever the size of the set.
+func (s *Set[V]) Remove(v V) bool {
+	i, ok := s.index[v]
+	if !ok {
+		return false
+	}
+	delete(s.index, v)
+	last := len(s.vals) - 1
+	if i != last {
+		s.vals[i] = s.vals[last]
+		s.index[s.vals[i]] = i
+	}
+	var zero V
+	s.vals[last] = zero
+	s.vals = s.vals[:last]
+	return true
+}
+
+// ContainsVal returns true if v is in the set
+func (s *Set[V]) ContainsVal(v V) bool {
+	_, ok := s.index[v]
+	return ok
+}
+
+// Size returns the number of values in the set
+func (s *Set[V]) Size() int {
+	return len(s.vals)
+}
+
+// GetVals returns the values as a freshly allocated slice the caller may modify. They come in the order they were
+// added in, except that a removal moves the last value into the freed position.
+func (s *Set[V]) GetVals() []V {
+	vals := make([]V, len(s.vals))
+	copy(vals, s.vals)
+	return vals
+}
@@ -0,0 +1,90 @@
+package indexes
+
+import (
+	"errors"
+	"time"
+)
+
+// errSnapshotEmptyKey is returned when decoding a snapshot that stores values under the empty key, which Add never does
+var errSnapshotEmptyKey = errors.New("indexes: snapshot stores values under the empty key")
+
+// snapshotKey is one stored key with everything held at its node, the unit the serialization formats write a Trie in.
+// Keys are flattened this way so that encoding never recurses into the nodes, however deep the Trie.
+type snapshotKey[V comparable] struct {
+	Key     string // the key in its stored, normalized form
+	Display string // the form the key was last added in, "" if it is the stored form
+	Pairs   []snapshotPair[V]
+}
+
+// snapshotPair is one id stored at a key along with its metadata
+type snapshotPair[V comparable] struct {
+	ID      V
+	Weight  float64
+	Hits    float64
+	HitAt   time.Time
+	Fields  []string
+	Payload interface{}
+	AddedAt time.Time
+	Expires time.Time
+}
+
+// snapshotKeyOf returns the snapshot of the already normalized key stored at node, which must hold values
+func snapshotKeyOf[V comparable](key string, node *GenericNode[V]) snapshotKey[V] {
+	ids := node.GetVals()
+	k := snapshotKey[V]{Key: key, Display: node.display, Pairs: make([]snapshotPair[V], len(ids))}
+	for i, id := range ids {
+		k.Pairs[i] = snapshotPairOf(node, id)
+	}
+	return k
+}
+
+// snapshotPairOf returns the snapshot of id, which must be stored at node
+func snapshotPairOf[V comparable](node *GenericNode[V], id V) snapshotPair[V] {
+	p := snapshotPair[V]{ID: id}
+	if m := node.getMeta(id); m != nil {
+		p.Weight, p.Hits, p.HitAt, p.Fields = m.weight, m.hits, m.hitAt, m.fields
+		p.Payload, p.AddedAt, p.Expires = m.payload, m.addedAt, m.expires
+	}
+	return p
+}
+
+// snapshot calls yield with the snapshot of every stored key in lexicographic order, stopping at the first error,
+// which it returns. The caller must hold the read lock.
+func (t *GenericTrie[V]) snapshot(yield func(snapshotKey[V]) error) error {
+	var err error
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		if node.IDSet.Size() != 0 {
+			err = yield(snapshotKeyOf(string(key), node))
+		}
+		return err == nil
+	})
+	return err
+}
+
+// restore stores a key read from a snapshot, pairs and metadata included, without normalizing it again. The caller
+// must hold the write lock or otherwise own t exclusively.
+func (t *GenericTrie[V]) restore(k snapshotKey[V]) error {
+	if k.Key == "" {
+		return errSnapshotEmptyKey
+	}
+	display := k.Display
+	if display == "" {
+		display = k.Key
+	}
+	for _, p := range k.Pairs {
+		node, _ := t.insert(k.Key, display, p.ID)
+		*node.putMeta(p.ID) = entryMeta{
+			weight:  p.Weight,
+			hits:    p.Hits,
+			hitAt:   p.HitAt,
+			fields:  p.Fields,
+			payload: p.Payload,
+			addedAt: p.AddedAt,
+			expires: p.Expires,
+		}
+		if !p.Expires.IsZero() {
+			t.expiring = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package indexes
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SnapshotTarget is where StartSnapshots writes snapshots, such as a file or an object store
+type SnapshotTarget interface {
+	// Open starts a new snapshot. It becomes the current one only once Close on the returned writer returns nil. If
+	// writing fails and the writer has an Abort() error method, Abort is called instead of Close to discard it.
+	Open() (io.WriteCloser, error)
+}
+
+// SnapshotConfig configures StartSnapshots. At least one of Interval and Mutations should be set.
+type SnapshotConfig struct {
+	Interval   time.Duration   // snapshot this often while the Trie changes, 0 for no time trigger
+	Mutations  uint64          // snapshot once this many changes have accumulated, 0 for no mutation trigger
+	CheckEvery time.Duration   // how often Mutations is checked, time.Second if 0
+	Target     SnapshotTarget  // where snapshots are written
+	OnError    func(err error) // called with the error of every failed snapshot, nil to ignore them
+}
+
+/*
+StartSnapshots saves the Trie to cfg.Target in the background with Save, once cfg.Interval has passed since the last
+snapshot or cfg.Mutations changes have accumulated, as counted by Generation, whichever comes first. Nothing is written
+while the Trie is unchanged, and only changes made after StartSnapshots count, so Save the Trie first if the target does
+not hold it yet. Each snapshot saves a Clone, so writers are only held up while the Trie is copied, never while it is
+written out. The returned stop function ends the background goroutine, waiting for a snapshot in progress, then writes
+a last snapshot if anything changed since the previous one and returns its error.
+*/
+func (t *GenericTrie[V]) StartSnapshots(cfg SnapshotConfig) (stop func() error) {
+	check := cfg.CheckEvery
+	if check <= 0 {
+		check = time.Second
+	}
+	if cfg.Interval > 0 && cfg.Interval < check {
+		check = cfg.Interval
+	}
+	saved := t.Generation()
+	last := time.Now()
+	snapshot := func() error {
+		view := t.Clone()
+		if err := writeSnapshot(view, cfg.Target); err != nil {
+			return err
+		}
+		saved, last = view.Generation(), time.Now()
+		return nil
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(check)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			changes := t.Generation() - saved
+			due := cfg.Interval > 0 && time.Since(last) >= cfg.Interval
+			if changes == 0 || !(due || cfg.Mutations > 0 && changes >= cfg.Mutations) {
+				continue
+			}
+			if err := snapshot(); err != nil && cfg.OnError != nil {
+				cfg.OnError(err)
+			}
+		}
+	}()
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			if t.Generation() != saved {
+				err = snapshot()
+			}
+		})
+		return err
+	}
+}
+
+// writeSnapshot saves t to a new snapshot opened on target, discarding it if the save fails
+func writeSnapshot[V comparable](t *GenericTrie[V], target SnapshotTarget) error {
+	w, err := target.Open()
+	if err != nil {
+		return err
+	}
+	if err := t.Save(w); err != nil {
+		if a, ok := w.(interface{ Abort() error }); ok {
+			a.Abort()
+		} else {
+			w.Close()
+		}
+		return err
+	}
+	return w.Close()
+}
+
+// FileTarget is a SnapshotTarget writing snapshots to the file at Path. Each snapshot is written to a temporary file
+// in the same directory, synced to disk and renamed over Path, so Path always holds a complete snapshot.
+type FileTarget struct {
+	Path string
+}
+
+// Open creates the temporary file the next snapshot is written to
+func (ft FileTarget) Open() (io.WriteCloser, error) {
+	f, err := os.CreateTemp(filepath.Dir(ft.Path), filepath.Base(ft.Path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	return &fileSnapshot{f: f, path: ft.Path}, nil
+}
+
+// fileSnapshot is a snapshot being written by a FileTarget
+type fileSnapshot struct {
+	f    *os.File
+	path string
+}
+
+func (s *fileSnapshot) Write(p []byte) (int, error) {
+	return s.f.Write(p)
+}
+
+// Close syncs the temporary file and renames it over the target path, then syncs the directory so the rename
+// survives a crash
+func (s *fileSnapshot) Close() error {
+	if err := s.f.Sync(); err != nil {
+		s.Abort()
+		return err
+	}
+	if err := s.f.Close(); err != nil {
+		os.Remove(s.f.Name())
+		return err
+	}
+	if err := os.Rename(s.f.Name(), s.path); err != nil {
+		os.Remove(s.f.Name())
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Abort discards the temporary file
+func (s *fileSnapshot) Abort() error {
+	s.f.Close()
+	return os.Remove(s.f.Name())
+}
@@ -0,0 +1,228 @@
+package indexes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// memTarget is a SnapshotTarget keeping snapshots in memory, sending each one on saved once it is closed
+type memTarget struct {
+	saved   chan []byte
+	openErr error
+}
+
+func newMemTarget() *memTarget {
+	return &memTarget{saved: make(chan []byte, 100)}
+}
+
+func (m *memTarget) Open() (io.WriteCloser, error) {
+	if m.openErr != nil {
+		return nil, m.openErr
+	}
+	return &memSnapshot{target: m}, nil
+}
+
+// memSnapshot is a snapshot being written by a memTarget
+type memSnapshot struct {
+	target *memTarget
+	buf    bytes.Buffer
+}
+
+func (s *memSnapshot) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func (s *memSnapshot) Close() error {
+	s.target.saved <- s.buf.Bytes()
+	return nil
+}
+
+// nextSnapshot waits for the next snapshot written to m and loads it
+func nextSnapshot(t *testing.T, m *memTarget) *Trie {
+	t.Helper()
+	select {
+	case data := <-m.saved:
+		tr, err := Load(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr
+	case <-time.After(10 * time.Second):
+		t.Fatal("no snapshot written")
+	}
+	return nil
+}
+
+// noSnapshot fails if a snapshot is written to m within d
+func noSnapshot(t *testing.T, m *memTarget, d time.Duration) {
+	t.Helper()
+	select {
+	case <-m.saved:
+		t.Fatal("unexpected snapshot")
+	case <-time.After(d):
+	}
+}
+
+func TestStartSnapshotsMutations(t *testing.T) {
+	tr := NewTrie()
+	m := newMemTarget()
+	stop := tr.StartSnapshots(SnapshotConfig{Mutations: 3, CheckEvery: time.Millisecond, Target: m})
+	tr.Add("a", objectID(1))
+	tr.Add("b", objectID(2))
+	// Adding a stored pair again changes nothing, so it does not count
+	tr.Add("b", objectID(2))
+	noSnapshot(t, m, 50*time.Millisecond)
+	tr.Add("c", objectID(3))
+	expect(t, "snapshot after the threshold", nextSnapshot(t, m).ToMap(), tr.ToMap())
+	tr.Add("d", objectID(4))
+	noSnapshot(t, m, 50*time.Millisecond)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "snapshot on stop", nextSnapshot(t, m).ToMap(), tr.ToMap())
+}
+
+func TestStartSnapshotsInterval(t *testing.T) {
+	tr := NewTrie()
+	m := newMemTarget()
+	stop := tr.StartSnapshots(SnapshotConfig{Interval: 10 * time.Millisecond, Target: m})
+	noSnapshot(t, m, 50*time.Millisecond)
+	tr.Add("a", objectID(1))
+	expect(t, "snapshot after the interval", nextSnapshot(t, m).ToMap(), tr.ToMap())
+	noSnapshot(t, m, 50*time.Millisecond)
+	tr.Add("b", objectID(2))
+	expect(t, "snapshot after the next interval", nextSnapshot(t, m).ToMap(), tr.ToMap())
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing changed since the last snapshot, so stop writes none
+	noSnapshot(t, m, 0)
+}
+
+// TestStartSnapshotsStop checks that stop writes the changes not yet saved, only once, and that nothing is written
+// after it returns
+func TestStartSnapshotsStop(t *testing.T) {
+	tr := NewTrie()
+	m := newMemTarget()
+	stop := tr.StartSnapshots(SnapshotConfig{Interval: time.Hour, Mutations: 1000, CheckEvery: time.Millisecond, Target: m})
+	tr.Add("a", objectID(1))
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "snapshot on stop", nextSnapshot(t, m).ToMap(), tr.ToMap())
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		tr.Add("b", objectID(i))
+	}
+	noSnapshot(t, m, 50*time.Millisecond)
+
+	stop = NewTrie().StartSnapshots(SnapshotConfig{Interval: time.Millisecond, Target: m})
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	noSnapshot(t, m, 0)
+}
+
+func TestStartSnapshotsErrors(t *testing.T) {
+	tr := NewTrie()
+	m := newMemTarget()
+	m.openErr = errors.New("target unavailable")
+	errs := make(chan error, 100)
+	stop := tr.StartSnapshots(SnapshotConfig{Mutations: 1, CheckEvery: time.Millisecond, Target: m, OnError: func(err error) { errs <- err }})
+	tr.Add("a", objectID(1))
+	select {
+	case err := <-errs:
+		if err != m.openErr {
+			t.Fatalf("OnError(%v), want %v", err, m.openErr)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("OnError not called")
+	}
+	// A failed snapshot saves nothing, so stop tries again
+	if err := stop(); err != m.openErr {
+		t.Fatalf("stop = %v, want %v", err, m.openErr)
+	}
+
+	m.openErr = nil
+	broken := &failingSnapshot{}
+	if err := writeSnapshot(tr, openerFunc(func() (io.WriteCloser, error) { return broken, nil })); err == nil {
+		t.Fatal("writeSnapshot to a failing writer succeeded")
+	}
+	expect(t, "Abort and Close of a failed snapshot", []bool{broken.aborted, broken.closed}, []bool{true, false})
+}
+
+// openerFunc is a SnapshotTarget calling itself
+type openerFunc func() (io.WriteCloser, error)
+
+func (f openerFunc) Open() (io.WriteCloser, error) { return f() }
+
+// failingSnapshot fails every write, recording whether it was aborted or closed
+type failingSnapshot struct {
+	failingWriter
+	aborted, closed bool
+}
+
+func (w *failingSnapshot) Close() error {
+	w.closed = true
+	return nil
+}
+
+func (w *failingSnapshot) Abort() error {
+	w.aborted = true
+	return nil
+}
+
+// TestFileTarget checks that a FileTarget replaces the file with each snapshot, leaving it alone and no temporary
+// files behind when a snapshot fails
+func TestFileTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := FileTarget{Path: filepath.Join(dir, "trie.snap")}
+	tr := NewTrie()
+	for i, key := range []string{"a", "b"} {
+		tr.Add(key, objectID(i))
+		if err := writeSnapshot(tr, target); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(target.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "snapshot file", loaded.ToMap(), tr.ToMap())
+	}
+	before, err := os.ReadFile(target.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := target.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("half a snapshot"))
+	if err := w.(interface{ Abort() error }).Abort(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(target.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, before) {
+		t.Fatal("an aborted snapshot changed the file")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "files left", len(entries), 1)
+}
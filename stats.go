@@ -0,0 +1,62 @@
+package indexes
+
+// Rough per-structure heap costs used by Stats to estimate the footprint of a Trie.
+// They approximate the 64-bit Go runtime and are meant for capacity planning, not accounting.
+const (
+	nodeBytes = 16 + 48 + 48 // TrieNode struct, link map header, IDSet
+	edgeBytes = 4 + 8 + 4    // rune key, *TrieNode value, map bucket overhead
+	idBytes   = 16 + 12 + 16 // string header, ObjectId bytes, set entry overhead
+	metaBytes = 16 + 8 + 112 // meta map key and entry, entryMeta struct
+)
+
+// TrieStats describes the shape and approximate size of a Trie
+type TrieStats struct {
+	NodeCount      int     // number of nodes, including the root
+	MaxDepth       int     // length in runes of the longest path from the root
+	KeyCount       int     // number of nodes holding at least one value
+	ValueCount     int     // number of (key, id) pairs
+	AvgBranching   float64 // average number of children of the nodes that have any
+	EstimatedBytes int64   // estimated heap footprint of the nodes, links, ids and their metadata
+}
+
+// Stats walks the whole Trie under the read lock and reports its shape. It is O(n) in the number of nodes.
+func (t *GenericTrie[V]) Stats() TrieStats {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	type frame struct {
+		node  *GenericNode[V]
+		depth int
+	}
+	var stats TrieStats
+	edges, parents := 0, 0
+	stack := []frame{{t.root, 0}}
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		stats.NodeCount++
+		if curr.depth > stats.MaxDepth {
+			stats.MaxDepth = curr.depth
+		}
+		if size := curr.node.IDSet.Size(); size != 0 {
+			stats.KeyCount++
+			stats.ValueCount += size
+		}
+		children := 0
+		for _, link := range curr.node.link {
+			if link != nil {
+				children++
+				stack = append(stack, frame{link, curr.depth + 1})
+			}
+		}
+		if children != 0 {
+			edges += children
+			parents++
+		}
+	}
+	if parents != 0 {
+		stats.AvgBranching = float64(edges) / float64(parents)
+	}
+	stats.EstimatedBytes = int64(stats.NodeCount)*nodeBytes + int64(edges)*edgeBytes + int64(stats.ValueCount)*(idBytes+metaBytes)
+	return stats
+}
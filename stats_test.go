@@ -0,0 +1,33 @@
+package indexes
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	tr.Add("ab", a)
+	tr.Add("ab", b)
+	tr.Add("abcd", a)
+	tr.Add("ax", a)
+	stats := tr.Stats()
+	// The root, a, ab, abc, abcd and ax
+	expect(t, "NodeCount", stats.NodeCount, 6)
+	expect(t, "MaxDepth", stats.MaxDepth, 4)
+	expect(t, "KeyCount", stats.KeyCount, 3)
+	expect(t, "ValueCount", stats.ValueCount, 4)
+	// The root, ab and abc have one child each and a has two
+	expect(t, "AvgBranching", stats.AvgBranching, 5.0/4)
+	if stats.EstimatedBytes <= 0 {
+		t.Fatalf("EstimatedBytes = %d, want a positive estimate", stats.EstimatedBytes)
+	}
+	expect(t, "Stats of an empty Trie", NewTrie().Stats().NodeCount, 1)
+}
+
+// BenchmarkStats measures Stats over a million keys, as an admin endpoint would call it
+func BenchmarkStats(b *testing.B) {
+	tr := largeTrie(b, 1000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Stats()
+	}
+}
@@ -0,0 +1,47 @@
+package indexes
+
+import (
+	"context"
+)
+
+// streamPage is the number of ids GetManyStream reads under a single read lock
+const streamPage = 256
+
+/*
+GetManyStream sends every distinct id under keys starting with prefix on the returned channel, in GetMany order, and
+closes it when the ids are exhausted or ctx is done. The subtree is read a page at a time with the cursor used by
+GetManyCursor, and the read lock is released between pages, so a slow consumer never blocks writers for longer than
+one page takes to collect. In exchange the stream is not a point-in-time snapshot: keys added or removed ahead of the
+cursor while streaming may or may not be seen. A consumer that stops reading before the channel is closed must
+cancel ctx, otherwise the sending goroutine stays blocked.
+*/
+func (t *GenericTrie[V]) GetManyStream(ctx context.Context, prefix string) <-chan V {
+	out := make(chan V)
+	go func() {
+		defer close(out)
+		seen := NewSet[V]()
+		cursor := ""
+		for {
+			ids, next, err := t.GetManyCursor(prefix, streamPage, cursor)
+			if err != nil {
+				return
+			}
+			for _, id := range ids {
+				if seen.ContainsVal(id) {
+					continue
+				}
+				seen.SaveVal(id)
+				select {
+				case out <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if next == "" || ctx.Err() != nil {
+				return
+			}
+			cursor = next
+		}
+	}()
+	return out
+}
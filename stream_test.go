@@ -0,0 +1,81 @@
+package indexes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestGetManyStream(t *testing.T) {
+	tr := largeTrie(t, 3*streamPage+10)
+	tr.Add("b", objectID(0))
+	var got []bson.ObjectId
+	for id := range tr.GetManyStream(context.Background(), "") {
+		got = append(got, id)
+	}
+	expect(t, "streamed ids", got, tr.GetMany("", 10000))
+}
+
+// TestGetManyStreamCancel cancels the context partway through and expects the channel to be closed
+func TestGetManyStreamCancel(t *testing.T) {
+	tr := largeTrie(t, 3*streamPage)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := tr.GetManyStream(ctx, "a")
+	for i := 0; i < 10; i++ {
+		<-ch
+	}
+	cancel()
+	received := 10
+	timeout := time.After(5 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-ch:
+			if open {
+				received++
+			}
+		case <-timeout:
+			t.Fatal("stream not closed after cancelling")
+		}
+	}
+	// At most the send already racing with the cancellation gets through
+	if received > 11 {
+		t.Fatalf("received %d ids after cancelling at 10", received)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	received = 0
+	for range tr.GetManyStream(ctx, "a") {
+		received++
+	}
+	if received > 1 {
+		t.Fatalf("received %d ids from a cancelled context", received)
+	}
+}
+
+// TestGetManyStreamWriters checks that a consumer that stops reading holds no lock, so writers are not blocked
+func TestGetManyStreamWriters(t *testing.T) {
+	tr := largeTrie(t, 3*streamPage)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := tr.GetManyStream(ctx, "a")
+	<-ch
+	done := make(chan struct{})
+	go func() {
+		tr.Add("b", objectID(1))
+		tr.Remove("aaaaaa", objectID(0))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writers blocked by a stalled stream")
+	}
+	received := 1
+	for range ch {
+		received++
+	}
+	expect(t, "ids streamed", received, 3*streamPage)
+}
@@ -0,0 +1,97 @@
+package indexes
+
+import (
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ChangeOp identifies the kind of change a ChangeEvent describes
+type ChangeOp int
+
+// The kinds of document change Sync applies to the Trie
+const (
+	ChangeInsert ChangeOp = iota
+	ChangeUpdate
+	ChangeDelete
+)
+
+// GenericChangeEvent describes a change to one document: its id and the values of its indexed fields before and after.
+// Old is ignored for inserts and New for deletes.
+type GenericChangeEvent[V comparable] struct {
+	Op  ChangeOp
+	ID  V
+	Old []string
+	New []string
+	// Version orders the changes of one document, such as a per-document counter or the change's cluster time. Sync
+	// drops an event whose Version is not greater than that of the last event it applied for the id; 0 is always applied.
+	Version uint64
+}
+
+// ChangeEvent is the GenericChangeEvent of a Trie
+type ChangeEvent = GenericChangeEvent[bson.ObjectId]
+
+/*
+Sync applies the change events received on events to the Trie in a background goroutine until events is closed or
+the returned stop function is called; stop waits for the goroutine to exit and may be called more than once.
+Inserts add the new values, updates atomically remove the old values and add the new ones, and deletes remove the id
+from every key via RemoveID. Values that are empty once normalized are skipped. Events carrying a Version are applied
+only if newer than the last one applied for their id, so duplicated and reordered events are dropped, including an
+insert that arrives after its document's delete; the last version of every id seen is kept for as long as Sync runs.
+Each event is also idempotent, so duplicates without a Version are harmless too. onError, if not nil, is called from the
+background goroutine with each event that failed to apply and its error. The channel keeps the package independent of
+any database driver.
+*/
+func (t *GenericTrie[V]) Sync(events <-chan GenericChangeEvent[V], onError func(ev GenericChangeEvent[V], err error)) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		versions := make(map[V]uint64)
+		for {
+			select {
+			case <-done:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := t.applyChange(ev, versions); err != nil && onError != nil {
+					onError(ev, err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+// applyChange applies a single change event to the Trie, unless versions holds a version of its id at least as new,
+// and records the event's version there
+func (t *GenericTrie[V]) applyChange(ev GenericChangeEvent[V], versions map[V]uint64) error {
+	if ev.Version != 0 {
+		if last, ok := versions[ev.ID]; ok && ev.Version <= last {
+			return nil
+		}
+		versions[ev.ID] = ev.Version
+	}
+	if ev.Op == ChangeDelete {
+		t.RemoveID(ev.ID)
+		return nil
+	}
+	var batch GenericBatch[V]
+	if ev.Op == ChangeUpdate {
+		for _, key := range ev.Old {
+			batch.Remove(key, ev.ID)
+		}
+	}
+	for _, key := range ev.New {
+		if _, err := t.cfg.storedKey(key); err == nil {
+			batch.Add(key, ev.ID)
+		}
+	}
+	return t.Apply(batch)
+}
@@ -0,0 +1,73 @@
+package indexes
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// syncEvents feeds events to a fresh Trie through Sync and returns the Trie once every event has been applied
+func syncEvents(t *testing.T, events []ChangeEvent) *Trie {
+	t.Helper()
+	tr := NewTrie()
+	ch := make(chan ChangeEvent)
+	stop := tr.Sync(ch, func(ev ChangeEvent, err error) {
+		t.Errorf("event %+v failed: %v", ev, err)
+	})
+	for _, ev := range events {
+		ch <- ev
+	}
+	close(ch)
+	stop()
+	return tr
+}
+
+func TestSync(t *testing.T) {
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr := syncEvents(t, []ChangeEvent{
+		{Op: ChangeInsert, ID: a, New: []string{"Ada", "Lovelace"}, Version: 1},
+		{Op: ChangeInsert, ID: b, New: []string{"Bob", "  ", ""}, Version: 1},
+		// A duplicate of an applied event
+		{Op: ChangeInsert, ID: a, New: []string{"Ada", "Lovelace"}, Version: 1},
+		{Op: ChangeUpdate, ID: a, Old: []string{"Ada", "Lovelace"}, New: []string{"Augusta", "Lovelace"}, Version: 2},
+		// A stale update arriving after a newer one
+		{Op: ChangeUpdate, ID: a, Old: []string{"Ada"}, New: []string{"Countess"}, Version: 1},
+		// An update arriving before its insert, which must then be dropped
+		{Op: ChangeUpdate, ID: c, Old: []string{"Carol"}, New: []string{"Caroline"}, Version: 2},
+		{Op: ChangeInsert, ID: c, New: []string{"Carol"}, Version: 1},
+		{Op: ChangeDelete, ID: b, Version: 2},
+		// An insert replayed after its document was deleted
+		{Op: ChangeInsert, ID: b, New: []string{"Bob"}, Version: 1},
+		{Op: ChangeDelete, ID: b, Version: 2},
+	})
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{
+		"augusta":  {a},
+		"lovelace": {a},
+		"caroline": {c},
+	})
+}
+
+func TestSyncUnversioned(t *testing.T) {
+	a := objectID(1)
+	tr := syncEvents(t, []ChangeEvent{
+		{Op: ChangeInsert, ID: a, New: []string{"Ada"}},
+		{Op: ChangeInsert, ID: a, New: []string{"Ada"}},
+		{Op: ChangeUpdate, ID: a, Old: []string{"Ada"}, New: []string{"Augusta"}},
+		{Op: ChangeUpdate, ID: a, Old: []string{"Ada"}, New: []string{"Augusta"}},
+		{Op: ChangeDelete, ID: objectID(2)},
+	})
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{"augusta": {a}})
+}
+
+func TestSyncStop(t *testing.T) {
+	tr := NewTrie()
+	ch := make(chan ChangeEvent, 2)
+	stop := tr.Sync(ch, nil)
+	ch <- ChangeEvent{Op: ChangeInsert, ID: objectID(1), New: []string{"x"}}
+	stop()
+	stop()
+	ch <- ChangeEvent{Op: ChangeInsert, ID: objectID(2), New: []string{"y"}}
+	if tr.Has("y") {
+		t.Fatal("an event sent after stop was applied")
+	}
+}
@@ -0,0 +1,54 @@
+package indexes
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitFields splits value into its non-empty tokens, separated by runes of the WithFieldSeparators set or, by
+// default, by whitespace
+func (t *GenericTrie[V]) splitFields(value string) []string {
+	sep := unicode.IsSpace
+	if t.cfg.separators != "" {
+		sep = func(r rune) bool { return strings.ContainsRune(t.cfg.separators, r) }
+	}
+	return strings.FieldsFunc(value, sep)
+}
+
+/*
+AddFields splits a multi-word value such as "mary jane watson" into tokens and adds each of them with the id under a
+single write lock, so the id can be found by any word of the value. It returns the tokens indexed, in order and without
+repeats; tokens that normalize to nothing are skipped. RemoveFields with the same value undoes it.
+*/
+func (t *GenericTrie[V]) AddFields(value string, id V) []string {
+	tokens := t.splitFields(value)
+	t.mx.Lock()
+	defer t.unlock()
+	indexed := []string{}
+	seen := make(map[string]bool)
+	for _, token := range tokens {
+		key, err := t.storedKey(token)
+		if err != nil || seen[key] {
+			continue
+		}
+		seen[key] = true
+		t.insert(key, token, id)
+		indexed = append(indexed, token)
+	}
+	return indexed
+}
+
+// RemoveFields removes the id from every token AddFields would index for value, under a single write lock, and
+// returns the number of (key, id) pairs removed
+func (t *GenericTrie[V]) RemoveFields(value string, id V) int {
+	tokens := t.splitFields(value)
+	t.mx.Lock()
+	defer t.unlock()
+	removed := 0
+	for _, token := range tokens {
+		if t.removePair(t.normalize(token), id) {
+			removed++
+		}
+	}
+	return removed
+}
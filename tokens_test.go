@@ -0,0 +1,32 @@
+package indexes
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestAddFields(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	expect(t, "AddFields with repeated spaces", tr.AddFields("mary   jane \t watson", a), []string{"mary", "jane", "watson"})
+	expect(t, "AddFields with leading and trailing spaces", tr.AddFields("  Jane Doe  ", b), []string{"Jane", "Doe"})
+	expect(t, "AddFields of a single token", tr.AddFields("cher", b), []string{"cher"})
+	expect(t, "AddFields of a repeated token", tr.AddFields("Jo jo JO", a), []string{"Jo"})
+	expect(t, "AddFields of nothing", tr.AddFields(" \t ", a), []string{})
+	expect(t, "GetMany of a middle word", tr.GetMany("jan", 10), []bson.ObjectId{a, b})
+	expect(t, "GetMany of a last word", tr.GetMany("wat", 10), []bson.ObjectId{a})
+	expect(t, "KeyCount", tr.KeyCount(), 6)
+
+	expect(t, "RemoveFields", tr.RemoveFields("mary   jane \t watson", a), 3)
+	expect(t, "RemoveFields again", tr.RemoveFields("mary jane watson", a), 0)
+	expect(t, "GetMany after RemoveFields", tr.GetMany("jan", 10), []bson.ObjectId{b})
+	expect(t, "RemoveFields of a single token", tr.RemoveFields(" cher ", b), 1)
+	expect(t, "Keys after RemoveFields", tr.Keys("", 10), []string{"Doe", "Jane", "Jo"})
+
+	sep := NewTrie(WithFieldSeparators(",;"))
+	expect(t, "AddFields with separators", sep.AddFields(";;smith, john;;", a), []string{"smith", " john"})
+	expect(t, "AddFields with a trailing separator", sep.AddFields("solo,", b), []string{"solo"})
+	expect(t, "RemoveFields with separators", sep.RemoveFields("smith, john", a), 2)
+	expect(t, "Keys after RemoveFields with separators", sep.Keys("", 10), []string{"solo"})
+}
@@ -0,0 +1,134 @@
+package indexes
+
+import (
+	"container/heap"
+)
+
+// candidate is a possible result of a ranked query, carrying whatever the ranking looks at
+type candidate[V comparable] struct {
+	key    string
+	node   *GenericNode[V]
+	id     V
+	weight float64
+	hits   float64
+	score  float64
+	seq    int // order the candidate was first offered in, breaking ties in favour of the earliest
+}
+
+/*
+topK selects the best n of the candidates offered to it while holding only n of them, the worst on top of a min-heap,
+so a ranked query uses O(n) memory however many keys match. less reports whether a ranks below b; ties it leaves
+undecided go to the candidate offered first. With mergeIDs, an id offered again while held keeps its best ranking
+in a single slot, tracked through pos, and ties go to the offer that first reached its best ranking. An id evicted
+earlier ranked below everything held at the time, and the worst held candidate only ever improves, so an evicted id can
+simply be offered again. With tie set, candidates offered between two calls to nextNode share their place in the
+offer order and tie's value order decides between them, so the ids of a node need not be sorted before being offered.
+*/
+type topK[V comparable] struct {
+	n     int
+	less  func(a, b *candidate[V]) bool
+	tie   func(a, b V) bool // order of the candidates offered for one node, nil to keep the order they are offered in
+	items []candidate[V]
+	pos   map[V]int // slot of each held id, nil unless merging ids
+	seq   int
+
+	offered candidate[V] // the candidate being offered
+}
+
+// newTopK returns a topK keeping the best n candidates as ranked by less
+func newTopK[V comparable](n int, less func(a, b *candidate[V]) bool, mergeIDs bool) *topK[V] {
+	h := &topK[V]{n: n, less: less}
+	if mergeIDs {
+		h.pos = make(map[V]int)
+	}
+	return h
+}
+
+// worse reports whether a ranks below b, the later offered losing ties
+func (h *topK[V]) worse(a, b *candidate[V]) bool {
+	if h.less(a, b) {
+		return true
+	}
+	if h.less(b, a) {
+		return false
+	}
+	if a.seq != b.seq || h.tie == nil {
+		return a.seq > b.seq
+	}
+	return h.tie(b.id, a.id)
+}
+
+func (h *topK[V]) Len() int           { return len(h.items) }
+func (h *topK[V]) Less(i, j int) bool { return h.worse(&h.items[i], &h.items[j]) }
+func (h *topK[V]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	if h.pos != nil {
+		h.pos[h.items[i].id] = i
+		h.pos[h.items[j].id] = j
+	}
+}
+func (h *topK[V]) Push(x interface{}) {
+	c := x.(candidate[V])
+	if h.pos != nil {
+		h.pos[c.id] = len(h.items)
+	}
+	h.items = append(h.items, c)
+}
+func (h *topK[V]) Pop() interface{} {
+	c := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	if h.pos != nil {
+		delete(h.pos, c.id)
+	}
+	return c
+}
+
+// offer considers c for the best n
+func (h *topK[V]) offer(c candidate[V]) {
+	if h.n <= 0 {
+		return
+	}
+	c.seq = h.seq
+	if h.tie == nil {
+		h.seq++
+	}
+	// The comparisons take c from a field, since a pointer to the argument passed to less would move every candidate
+	// offered to the heap
+	h.offered = c
+	if h.pos != nil {
+		if i, ok := h.pos[c.id]; ok {
+			// A better ranking moves the id to where it was met, as it would if the id had been evicted in between
+			if h.worse(&h.items[i], &h.offered) {
+				h.items[i] = c
+				heap.Fix(h, i)
+			}
+			return
+		}
+	}
+	if len(h.items) < h.n {
+		heap.Push(h, c)
+		return
+	}
+	if h.worse(&h.items[0], &h.offered) {
+		if h.pos != nil {
+			delete(h.pos, h.items[0].id)
+			h.pos[c.id] = 0
+		}
+		h.items[0] = c
+		heap.Fix(h, 0)
+	}
+}
+
+// nextNode starts the candidates of another node, which lose ties to those offered before
+func (h *topK[V]) nextNode() {
+	h.seq++
+}
+
+// drain empties the heap, returning the held candidates best first
+func (h *topK[V]) drain() []candidate[V] {
+	best := make([]candidate[V], h.Len())
+	for i := len(best) - 1; i >= 0; i-- {
+		best[i] = heap.Pop(h).(candidate[V])
+	}
+	return best
+}
@@ -0,0 +1,121 @@
+package indexes
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// collectRanked is GetManyRanked the naive way: every matching pair is collected and each id given its best (weight,
+// hits), met first at the position seq, then all of them are sorted, ties in seq order, and cut to n
+func collectRanked(tr *Trie, prefix string, n int) []bson.ObjectId {
+	tr.mx.RLock()
+	defer tr.mx.RUnlock()
+	best := map[bson.ObjectId]*candidate[bson.ObjectId]{}
+	var ids []bson.ObjectId
+	seq := 0
+	walk(tr.prefixTip(tr.normalize(prefix)), nil, func(_ []rune, node *TrieNode) bool {
+		for _, id := range node.liveVals(time.Time{}) {
+			hits, _ := node.hits(id)
+			c := &candidate[bson.ObjectId]{id: id, weight: node.weight(id), hits: hits, seq: seq}
+			seq++
+			if old, ok := best[id]; !ok {
+				ids = append(ids, id)
+				best[id] = c
+			} else if byWeight(old, c) {
+				best[id] = c
+			}
+		}
+		return true
+	})
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := best[ids[i]], best[ids[j]]
+		if byWeight(a, b) != byWeight(b, a) {
+			return byWeight(b, a)
+		}
+		return a.seq < b.seq
+	})
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return append([]bson.ObjectId{}, ids...)
+}
+
+// weightedTrie returns a Trie of n six-letter keys with random weights and hits, a tenth of the ids also stored a
+// second time under another key
+func weightedTrie(tb testing.TB, n int) *Trie {
+	tb.Helper()
+	rng := rand.New(rand.NewSource(1))
+	tr := NewTrie()
+	key := func(i int) string {
+		k := []byte("aaaaaa")
+		for j, v := len(k)-1, i; j >= 0; j, v = j-1, v/26 {
+			k[j] = byte('a' + v%26)
+		}
+		return string(k)
+	}
+	for i := 0; i < n; i++ {
+		tr.AddWeighted(key(i), objectID(i), float64(rng.Intn(50)))
+		if rng.Intn(10) == 0 {
+			tr.AddWeighted(key(rng.Intn(n)), objectID(i), float64(rng.Intn(50)))
+		}
+		if rng.Intn(20) == 0 {
+			tr.RecordHit(key(i), objectID(i))
+		}
+	}
+	return tr
+}
+
+// TestTopKMatchesSort checks that selecting with the bounded heap gives exactly what collecting and sorting gives
+func TestTopKMatchesSort(t *testing.T) {
+	tr := weightedTrie(t, 10000)
+	for _, prefix := range []string{"", "a", "aab", "aabc", "aabcd"} {
+		for _, n := range []int{1, 5, 20, 100, 1000, 20000} {
+			expect(t, fmt.Sprintf("GetManyRanked(%q, %d)", prefix, n), tr.GetManyRanked(prefix, n), collectRanked(tr, prefix, n))
+		}
+	}
+}
+
+// TestTopKAllocs checks that GetManyRanked and GetManyByTime allocate no more for a prefix matching every key than for
+// one matching a few hundred
+func TestTopKAllocs(t *testing.T) {
+	tr := weightedTrie(t, 20000)
+	for name, query := range map[string]func(prefix string){
+		"GetManyRanked": func(prefix string) { tr.GetManyRanked(prefix, 20) },
+		"GetManyByTime": func(prefix string) { tr.GetManyByTime(prefix, 20, true) },
+	} {
+		few := testing.AllocsPerRun(10, func() { query("aaab") })
+		all := testing.AllocsPerRun(10, func() { query("") })
+		// The walk's stack grows with the depth and fan-out of the subtree, not with the number of matches
+		if all > few+10 {
+			t.Fatalf("%s allocates %v times for 20000 matching keys, %v for 676", name, all, few)
+		}
+	}
+}
+
+// BenchmarkTopK compares the bounded heap with collecting and sorting, n = 20, on prefixes matching 17576, 456976 and
+// 500k keys: the heap's bytes and allocations per query stay the same however many keys match.
+func BenchmarkTopK(b *testing.B) {
+	tr := weightedTrie(b, 500000)
+	if got, want := tr.GetManyRanked("a", 20), collectRanked(tr, "a", 20); fmt.Sprint(got) != fmt.Sprint(want) {
+		b.Fatalf("GetManyRanked = %v, collecting and sorting = %v", got, want)
+	}
+	for _, prefix := range []string{"aaa", "aa", "a"} {
+		b.Run("heap/"+prefix, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tr.GetManyRanked(prefix, 20)
+			}
+		})
+		b.Run("sort/"+prefix, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				collectRanked(tr, prefix, 20)
+			}
+		})
+	}
+}
@@ -1,23 +1,184 @@
 package indexes
 
 import (
-	"strings"
+	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/mgo.v2/bson"
 )
 
-// Trie defines a TrieIndex
-type Trie struct {
-	root *TrieNode
+// ErrEmptyKey is returned by Add when the key is empty or consists only of whitespace
+var ErrEmptyKey = errors.New("indexes: key must not be empty")
+
+// ErrKeyNotFound is returned when an operation requires a key that holds no values in the Trie
+var ErrKeyNotFound = errors.New("indexes: key holds no values")
+
+// ErrIDNotFound is returned when an operation requires an id that is not stored at the given key
+var ErrIDNotFound = errors.New("indexes: id not stored at key")
+
+/*
+GenericTrie is a prefix index from string keys to values of any comparable type V. Trie, which stores bson.ObjectId
+values, is the GenericTrie this package is built around; StringTrie and PrimitiveTrie store strings and mongo-driver
+ObjectIDs, and other types such as int64 ids work the same way. Every method is available whatever V is. A node's values
+come back in their natural order where V has one, that of ObjectIds, strings and integers, and otherwise in the order
+the node's Set keeps them. A GenericTrie is safe for concurrent use by multiple goroutines: Add and Remove take the
+write lock, while Get and GetMany take the read lock.
+*/
+type GenericTrie[V comparable] struct {
+	gen   uint64 // number of mutations, first so that it is 64-bit aligned for the atomic operations Generation uses
+	epoch uint64 // generation at which the current root was installed
+
+	root *GenericNode[V]
+	keys int          // number of nodes holding at least one value
+	vals int          // number of (key, id) pairs stored across all nodes
 	mx   sync.RWMutex //RWMutex to protect the map
+
+	cfg     config         // settings chosen by the options passed to NewTrie
+	reverse map[V][]string // keys each id is stored under, nil unless WithReverseIndex is used
+	infix   *keyTrie       // every key filed under each of its suffixes, nil unless WithInfixIndex is used
+	suffix  *keyTrie       // every key filed under its reversal, nil unless WithSuffixIndex is used
+	queries *queryStats    // prefixes looked up by Get and GetMany, nil unless WithQueryStats is used
+
+	expiring bool       // whether AddWithTTL has been used since the Trie was created or cleared
+	wal      *walLog[V] // log of mutations, nil unless WithWAL is used
 }
 
-// NewTrie creates a new Trie object
-func NewTrie() *Trie {
-	return &Trie{
-		root: NewTrieNode(),
+// Trie defines a TrieIndex holding bson.ObjectId values
+type Trie = GenericTrie[bson.ObjectId]
+
+// NewTrie creates a new Trie object configured by the given options
+func NewTrie(opts ...Option) *Trie {
+	return NewGenericTrie[bson.ObjectId](opts...)
+}
+
+// NewGenericTrie creates an empty GenericTrie configured by the given options
+func NewGenericTrie[V comparable](opts ...Option) *GenericTrie[V] {
+	t := newTrie[V](newConfig(opts))
+	t.startWAL()
+	return t
+}
+
+// newConfig returns the configuration chosen by opts
+func newConfig(opts []Option) config {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
 	}
+	return cfg
+}
+
+// newTrie creates an empty Trie with the given configuration
+func newTrie[V comparable](cfg config) *GenericTrie[V] {
+	if cfg.binaryKeys {
+		// Grapheme clusters are meaningless on bytes
+		cfg.graphemes = false
+	}
+	t := &GenericTrie[V]{
+		root: NewGenericNode[V](),
+		cfg:  cfg,
+	}
+	if cfg.reverseIndex {
+		t.reverse = make(map[V][]string)
+	}
+	if cfg.infixIndex {
+		t.infix = newKeyTrie()
+	}
+	if cfg.suffixIndex {
+		t.suffix = newKeyTrie()
+	}
+	if cfg.queryStats > 0 {
+		t.queries = newQueryStats(cfg.queryStats)
+	}
+	return t
+}
+
+// Clear empties the Trie in place by installing a fresh root and resetting the counters.
+// Existing holders of the *Trie see an empty index once Clear returns.
+func (t *GenericTrie[V]) Clear() {
+	t.mx.Lock()
+	defer t.unlock()
+	t.install(newTrie[V](t.cfg))
+	t.wal.clear()
+}
+
+/*
+Swap atomically replaces the contents of t with those of other, which is left empty. This lets a fresh index be built
+off to the side and cut over with only a brief write lock on t: queries already running finish against the old
+contents and every later query sees the new ones. other should have been created with the same options as t.
+*/
+func (t *GenericTrie[V]) Swap(other *GenericTrie[V]) {
+	if other == t {
+		return
+	}
+	other.mx.Lock()
+	fresh := newTrie[V](other.cfg)
+	fresh.install(other)
+	other.install(newTrie[V](other.cfg))
+	other.wal.clear()
+	other.unlock()
+
+	if !fresh.cfg.sameIndexes(t.cfg) {
+		// Rebuild the auxiliary indexes so they match t's own configuration
+		fresh.cfg = t.cfg
+		fresh.rebuildAux()
+	}
+	t.replace(fresh)
+}
+
+// install replaces the contents of t with those of other, which must not be used afterwards. The caller must hold the write lock.
+func (t *GenericTrie[V]) install(other *GenericTrie[V]) {
+	// Stay ahead of every generation stamped on other's nodes, so no prefix generation repeats
+	gen := atomic.LoadUint64(&t.gen)
+	if g := atomic.LoadUint64(&other.gen); g > gen {
+		gen = g
+	}
+	atomic.StoreUint64(&t.gen, gen+1)
+	t.epoch = gen + 1
+	t.root = other.root
+	t.keys = other.keys
+	t.vals = other.vals
+	t.reverse = other.reverse
+	t.infix = other.infix
+	t.suffix = other.suffix
+	t.expiring = other.expiring
+}
+
+// Clone returns a deep copy of the Trie taken under the read lock. Every TrieNode and IDSet is copied,
+// so later mutations of the clone do not affect the original and vice versa.
+func (t *GenericTrie[V]) Clone() *GenericTrie[V] {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	clone := newTrie[V](t.cfg)
+	type pair struct {
+		src, dst *GenericNode[V]
+	}
+	stack := []pair{{t.root, clone.root}}
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		curr.dst.display = curr.src.display
+		curr.dst.gen = curr.src.gen
+		for _, id := range curr.src.IDSet.GetVals() {
+			curr.dst.SaveVal(id)
+			if m := curr.src.getMeta(id); m != nil {
+				*curr.dst.putMeta(id) = m.clone()
+			}
+		}
+		for r, link := range curr.src.link {
+			if link != nil {
+				node := NewGenericNode[V]()
+				curr.dst.PutLink(r, node)
+				stack = append(stack, pair{link, node})
+			}
+		}
+	}
+	clone.rebuildAux()
+	clone.expiring = t.expiring
+	clone.gen, clone.epoch = atomic.LoadUint64(&t.gen), t.epoch
+	return clone
 }
 
 /*
@@ -29,38 +190,108 @@ find the child node of current node associated with that letter
 if there is no child node associated with that letter, create a new node and add it to current node as a child associated with the letter
 set current node = child node
 add value to current node
+
+Keys are walked one rune at a time, so multi-byte UTF-8 characters such as "ü" or "張" each occupy a single node.
+Empty and whitespace-only keys, and keys left blank by normalizing, are rejected with ErrEmptyKey, so the root node
+never holds values.
+Add reports whether the call changed the index: true only if the id was not already stored at the key.
+Matching ignores case, but the key is remembered as given so that Keys and the other key-returning methods can show
+it as entered, such as "McDonald". When the same key is added in several casings the most recent one wins, and the
+remembered form is dropped once the key holds no values.
 */
-func (t *Trie) Add(s string, id bson.ObjectId) *TrieNode {
-	s = strings.ToLower(s)
+func (t *GenericTrie[V]) Add(s string, id V) (bool, error) {
+	key, err := t.storedKey(s)
+	if err != nil {
+		return false, err
+	}
 	t.mx.Lock()
+	_, inserted := t.insert(key, s, id)
+	t.unlock()
+	return inserted, nil
+}
+
+// insert stores id under the already normalized key, creating nodes as needed and keeping the counters and
+// auxiliary indexes up to date, records original as the form the key is displayed in and timestamps a newly stored
+// pair. It returns the key's node and whether the id was newly stored. The caller must hold the write lock.
+func (t *GenericTrie[V]) insert(s, original string, id V) (*GenericNode[V], bool) {
+	t.wal.touch(s, id)
 	curr := t.root
-	for i := 0; i < len(s); i++ {
-		r := rune(s[i])
+	for _, r := range s {
 		link := curr.GetLink(r)
 		if link != nil {
 			// If it contains an entry for our rune, we advance our search
 			curr = curr.GetLink(r)
 		} else {
 			// It does not, so we need to create a new TrieNode there
-			newNode := NewTrieNode()
+			newNode := NewGenericNode[V]()
 			curr.PutLink(r, newNode)
 			curr = newNode
 		}
 	}
+	// The latest casing wins, so a corrected display form replaces an earlier one
+	curr.setDisplay(original, s)
 	// We make sure that there isn't a duplicate id stored as a value already
-	if !curr.ContainsVal(id) {
-		curr.SaveVal(id)
+	if curr.ContainsVal(id) {
+		if t.expiring && curr.expired(id, t.now()) {
+			// Readers no longer see the pair, so to them it is stored afresh
+			*curr.getMeta(id) = entryMeta{addedAt: t.now()}
+			t.touch(s)
+			return curr, true
+		}
+		if t.cfg.refreshAddedAt {
+			curr.putMeta(id).addedAt = t.now()
+		}
+		return curr, false
 	}
-	t.mx.Unlock()
-	return curr
+	if curr.IDSet.Size() == 0 {
+		t.keyAdded(s)
+	}
+	t.vals++
+	curr.SaveVal(id)
+	curr.putMeta(id).addedAt = t.now()
+	t.indexReverse(id, s)
+	t.touch(s)
+	return curr, true
+}
+
+// KeyCount returns the number of distinct keys that currently hold at least one value.
+// The count is maintained by Add and Remove, so reading it does not walk the Trie.
+func (t *GenericTrie[V]) KeyCount() int {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return t.keys
+}
+
+// ValueCount returns the total number of (key, id) pairs stored in the Trie; a key holding three ids counts three times.
+// Like KeyCount it is maintained by Add and Remove rather than computed by walking the Trie.
+func (t *GenericTrie[V]) ValueCount() int {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return t.vals
+}
+
+// Normalize returns the form s is stored and looked up under, letting callers predict how keys are indexed
+func (t *GenericTrie[V]) Normalize(s string) string {
+	return t.normalize(s)
+}
+
+// storedKey normalizes a key about to be added, returning ErrEmptyKey if it is blank before or after normalizing
+func (t *GenericTrie[V]) storedKey(s string) (string, error) {
+	return t.cfg.storedKey(s)
+}
+
+// normalize converts a key or prefix to the form it is stored under, as described at config.normalize.
+// Every public method funnels its input through normalize exactly once, so adds, lookups and removals can never
+// disagree about a key's stored form.
+func (t *GenericTrie[V]) normalize(s string) string {
+	return t.cfg.normalize(s)
 }
 
 /*
 findTip helper function takes in a prefix and the currentNode to start the search. It traverses the Trie Index and stops when it reaches the last letter of the prefix and returns that TrieNode. If the prefix does not exist in the Trie, then it returns nil
 */
-func findTip(prefix string, curr *TrieNode) *TrieNode {
-	for i := 0; i < len(prefix); i++ {
-		r := rune(prefix[i])
+func findTip[V comparable](prefix string, curr *GenericNode[V]) *GenericNode[V] {
+	for _, r := range prefix {
 		if curr.GetLink(r) != nil {
 			// If it contains an entry for our rune, we advance our search
 			curr = curr.GetLink(r)
@@ -73,91 +304,692 @@ func findTip(prefix string, curr *TrieNode) *TrieNode {
 
 /*
 Remove handles the removal of a specific prefix/id pair from the Trie
-Returns error if there is no prefix/id pair that exists in the Trie - nil otherwise
+Returns true if the pair existed and was removed - false if there is no such prefix/id pair in the Trie
+Since Add never stores values under an empty key, removing the empty key is a no-op
 */
-func (t *Trie) Remove(prefix string, id bson.ObjectId) {
-	removeHelper(t.root, prefix, id, 0)
+func (t *GenericTrie[V]) Remove(prefix string, id V) bool {
+	key := t.normalize(prefix)
+	t.mx.Lock()
+	defer t.unlock()
+	return t.removePair(key, id)
 }
 
-func removeHelper(curr *TrieNode, prefix string, id bson.ObjectId, index int) bool {
-	if index == len(prefix) {
-		if !curr.ContainsVal(id) {
-			return false
+// removePair removes id from the already normalized key, keeping the counters and auxiliary indexes up to date.
+// Returns true if the pair existed. The caller must hold the write lock.
+func (t *GenericTrie[V]) removePair(key string, id V) bool {
+	removed, emptied := removeHelper(t.root, []rune(key), id)
+	if removed {
+		t.vals--
+		t.unindexReverse(id, key)
+		t.wal.touch(key, id)
+	}
+	if emptied {
+		t.keyRemoved(key)
+	}
+	if removed {
+		t.touch(key)
+	}
+	return removed
+}
+
+/*
+RemoveFunc removes every id under keys starting with prefix for which pred returns true, pruning emptied branches,
+and returns the number of (key, id) pairs removed. The whole operation runs under the write lock, so pred must not
+call back into the Trie. pred is called on copies of each node's ids before anything is removed.
+*/
+func (t *GenericTrie[V]) RemoveFunc(prefix string, pred func(V) bool) int {
+	prefix = t.normalize(prefix)
+	t.mx.Lock()
+	defer t.unlock()
+	var matches []GenericKeyID[V]
+	walk(t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		if node.IDSet.Size() == 0 {
+			return true
+		}
+		k := string(key)
+		for _, id := range node.GetVals() {
+			if pred(id) {
+				matches = append(matches, GenericKeyID[V]{Key: k, ID: id})
+			}
+		}
+		return true
+	})
+	removed := 0
+	for _, m := range matches {
+		if t.removePair(m.Key, m.ID) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// RemoveAll removes every id stored at the exact key in a single locked operation, pruning the branch if the
+// node is left as a valueless leaf. Returns the number of ids removed, or 0 if the key was not present.
+func (t *GenericTrie[V]) RemoveAll(key string) int {
+	key = t.normalize(key)
+	t.mx.Lock()
+	defer t.unlock()
+	prefix := []rune(key)
+	path := findPath(t.root, prefix)
+	if path == nil {
+		return 0
+	}
+	curr := path[len(path)-1]
+	removed := curr.IDSet.Size()
+	if removed == 0 {
+		return 0
+	}
+	for _, id := range curr.IDSet.GetVals() {
+		t.unindexReverse(id, key)
+		t.wal.touch(key, id)
+	}
+	curr.ClearVals()
+	prunePath(path, prefix)
+	t.keyRemoved(key)
+	t.vals -= removed
+	t.touch(key)
+	return removed
+}
+
+/*
+Rename moves every id stored at oldKey to newKey under a single write lock, merging them with any ids newKey already holds,
+and prunes the old branch. Readers never observe the ids missing from both keys. Returns ErrKeyNotFound if oldKey holds
+no values and ErrEmptyKey if newKey is empty; renaming a key to itself (after normalizing) only changes the form it is displayed in.
+*/
+func (t *GenericTrie[V]) Rename(oldKey, newKey string) error {
+	original := newKey
+	newKey, err := t.storedKey(newKey)
+	if err != nil {
+		return err
+	}
+	oldKey = t.normalize(oldKey)
+	t.mx.Lock()
+	defer t.unlock()
+	prefix := []rune(oldKey)
+	path := findPath(t.root, prefix)
+	if path == nil || path[len(path)-1].IDSet.Size() == 0 {
+		return ErrKeyNotFound
+	}
+	curr := path[len(path)-1]
+	ids := curr.IDSet.GetVals()
+	if oldKey == newKey {
+		curr.setDisplay(original, newKey)
+		// Logging any one pair of the key logs its new display form
+		t.wal.touch(oldKey, ids[0])
+		return nil
+	}
+	// Add to the new key before pruning the old branch, since one key may be a prefix of the other
+	for _, id := range ids {
+		t.wal.touch(oldKey, id)
+		node, inserted := t.insert(newKey, original, id)
+		if m := curr.getMeta(id); m != nil && inserted {
+			*node.putMeta(id) = m.clone()
 		}
-		curr.RemoveVal(id)
-		if (len(curr.GetVals())) == 0 && curr.IsLeafNode() {
+		t.unindexReverse(id, oldKey)
+	}
+	curr.ClearVals()
+	prunePath(path, prefix)
+	t.keyRemoved(oldKey)
+	t.vals -= len(ids)
+	t.touch(oldKey)
+	return nil
+}
+
+/*
+ReplaceVal swaps oldID for newID at the exact key in one critical section, so readers see exactly one of the two ids.
+If newID is already stored there, oldID is simply dropped. Returns ErrKeyNotFound if the key holds no values and
+ErrIDNotFound if oldID is not stored at it, leaving the Trie unmodified in both cases.
+*/
+func (t *GenericTrie[V]) ReplaceVal(key string, oldID, newID V) error {
+	key = t.normalize(key)
+	t.mx.Lock()
+	defer t.unlock()
+	curr := findTip(key, t.root)
+	if curr == nil || curr.IDSet.Size() == 0 {
+		return ErrKeyNotFound
+	}
+	if !curr.ContainsVal(oldID) {
+		return ErrIDNotFound
+	}
+	if oldID == newID {
+		return nil
+	}
+	t.wal.touch(key, oldID)
+	t.wal.touch(key, newID)
+	curr.RemoveVal(oldID)
+	t.unindexReverse(oldID, key)
+	t.touch(key)
+	if curr.ContainsVal(newID) {
+		t.vals--
+		return nil
+	}
+	curr.SaveVal(newID)
+	curr.putMeta(newID).addedAt = t.now()
+	t.indexReverse(newID, key)
+	return nil
+}
+
+// DeleteSubtree removes the prefix and every key starting with it, pruning any ancestors left empty, and returns
+// the number of keys removed. Deleting the empty prefix is equivalent to Clear.
+func (t *GenericTrie[V]) DeleteSubtree(prefix string) int {
+	prefix = t.normalize(prefix)
+	t.mx.Lock()
+	defer t.unlock()
+	runes := []rune(prefix)
+	path := findPath(t.root, runes)
+	if path == nil {
+		return 0
+	}
+	if view := t.prefixTip(prefix); view != path[len(path)-1] {
+		// Some keys below continue the prefix's last grapheme cluster and must stay, so remove the others one by one
+		var pairs []GenericKeyID[V]
+		keys := 0
+		walk(view, runes, func(key []rune, node *GenericNode[V]) bool {
+			if node.IDSet.Size() != 0 {
+				keys++
+				for _, id := range node.IDSet.GetVals() {
+					pairs = append(pairs, GenericKeyID[V]{Key: string(key), ID: id})
+				}
+			}
 			return true
+		})
+		for _, p := range pairs {
+			t.removePair(p.Key, p.ID)
 		}
-		return false
+		return keys
 	}
-	r := rune(prefix[index])
-	node := curr.GetLink(r)
-	if node == nil {
-		return false
+	keys, vals := 0, 0
+	walk(path[len(path)-1], runes, func(key []rune, node *GenericNode[V]) bool {
+		if size := node.IDSet.Size(); size != 0 {
+			keys++
+			vals += size
+			k := string(key)
+			for _, id := range node.IDSet.GetVals() {
+				t.unindexReverse(id, k)
+				t.wal.touch(k, id)
+			}
+			t.keyRemoved(k)
+		}
+		return true
+	})
+	if len(runes) == 0 {
+		t.root = NewGenericNode[V]()
+	} else {
+		path[len(path)-2].RemoveLink(runes[len(runes)-1])
+		prunePath(path[:len(path)-1], runes[:len(runes)-1])
 	}
-	shouldDelete := removeHelper(node, prefix, id, (index + 1))
-	if shouldDelete {
-		curr.RemoveLink(r)
-		return curr.IsLeafNode()
+	t.vals -= vals
+	if vals != 0 {
+		t.touch(prefix)
 	}
-	return false
+	return keys
+}
+
+/*
+removeHelper walks the prefix from curr, recording the path of nodes it passes through, and removes the id from the tip.
+It then walks back up the recorded path, pruning every node left with neither values nor children, so deep keys do
+not grow the goroutine stack. Reports whether the id was found and removed, and whether that left the tip without values.
+*/
+func removeHelper[V comparable](curr *GenericNode[V], prefix []rune, id V) (removed, emptied bool) {
+	path := findPath(curr, prefix)
+	if path == nil {
+		return false, false
+	}
+	curr = path[len(path)-1]
+	if !curr.ContainsVal(id) {
+		return false, false
+	}
+	curr.RemoveVal(id)
+	prunePath(path, prefix)
+	return true, curr.IDSet.Size() == 0
+}
+
+// findPath returns the nodes passed through walking prefix from curr, starting with curr itself, or nil if the prefix does not exist
+func findPath[V comparable](curr *GenericNode[V], prefix []rune) []*GenericNode[V] {
+	path := make([]*GenericNode[V], 0, len(prefix)+1)
+	path = append(path, curr)
+	for _, r := range prefix {
+		curr = curr.GetLink(r)
+		if curr == nil {
+			return nil
+		}
+		path = append(path, curr)
+	}
+	return path
 }
 
-// Get returns value if exists in the Trie index, otherwise nil
-func (t *Trie) Get(prefix string) []bson.ObjectId {
-	prefix = strings.ToLower(prefix)
+// prunePath unlinks the empty leaves at the bottom of path, where path[i+1] is the child of path[i] along prefix[i]
+func prunePath[V comparable](path []*GenericNode[V], prefix []rune) {
+	for i := len(path) - 1; i > 0; i-- {
+		node := path[i]
+		if node.IDSet.Size() != 0 || !node.IsLeafNode() {
+			return
+		}
+		path[i-1].RemoveLink(prefix[i-1])
+	}
+}
+
+// Get returns value if exists in the Trie index, otherwise nil.
+// Get("") always returns an empty result because Add rejects empty keys.
+func (t *GenericTrie[V]) Get(prefix string) []V {
+	prefix = t.normalize(prefix)
 	t.mx.RLock()
 	defer t.mx.RUnlock()
 	curr := findTip(prefix, t.root)
+	vals := []V{} //Empty
 	if curr != nil {
-		vals := curr.GetVals()
-		if len(vals) != 0 {
-			return vals
+		vals = curr.liveVals(t.cutoff())
+	}
+	t.queries.record(prefix, len(vals))
+	return vals
+}
+
+// GetOK returns the values stored at the exact key along with whether the key's path exists in the Trie.
+// An interior node with no values of its own returns an empty slice and true; a missing path returns false, as does a
+// path left only to expired pairs.
+func (t *GenericTrie[V]) GetOK(prefix string) ([]V, bool) {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	curr := findTip(prefix, t.root)
+	now := t.cutoff()
+	if curr == nil || (!now.IsZero() && !hasValues(curr, now)) {
+		return []V{}, false
+	}
+	return curr.liveVals(now), true
+}
+
+// Has returns true if the exact key was added to the Trie and still holds at least one value
+func (t *GenericTrie[V]) Has(key string) bool {
+	key = t.normalize(key)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	curr := findTip(key, t.root)
+	return curr != nil && curr.hasLive(t.cutoff())
+}
+
+// HasPrefix returns true if any key stored in the Trie starts with the prefix.
+// It stops at the first node holding values and never materializes an id list.
+func (t *GenericTrie[V]) HasPrefix(prefix string) bool {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return hasValues(t.prefixTip(prefix), t.cutoff())
+}
+
+// hasValues returns true if curr or any of its descendants holds at least one value not expired at now
+func hasValues[V comparable](curr *GenericNode[V], now time.Time) bool {
+	if curr == nil {
+		return false
+	}
+	stack := []*GenericNode[V]{curr}
+	for len(stack) > 0 {
+		curr = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if curr.hasLive(now) {
+			return true
+		}
+		for _, link := range curr.link {
+			if link != nil {
+				stack = append(stack, link)
+			}
 		}
 	}
-	return []bson.ObjectId{} //Empty
+	return false
 }
 
 /*
 GetMany gets the specified set of users
 let current node = root node
 for each letter in the prefix
+
 	find the child node of current node associated with that letter
 	if there is no child associated with that letter, no keys start with the prefix, so return and empty list
 	set current node = child node
+
 child node now points to the branch containing all keys that start with the prefix; recurse down the branch, gathering the keys and values, and return them
 */
-func (t *Trie) GetMany(prefix string, n int) []bson.ObjectId {
-	prefix = strings.ToLower(prefix)
+func (t *GenericTrie[V]) GetMany(prefix string, n int) []V {
+	prefix = t.normalize(prefix)
 	t.mx.RLock()
 	defer t.mx.RUnlock()
-	curr := findTip(prefix, t.root)
-	res := NewIDSet()
+	curr := t.prefixTip(prefix)
+	res := NewSet[V]()
+	ids := []V{}
 	if curr != nil {
-		depthFirst(curr, n, res)
-		return res.GetVals()
+		depthFirst(curr, n, res, &ids, t.cutoff())
 	}
-	return res.GetVals()
+	t.queries.record(prefix, len(ids))
+	return ids
 }
 
-func depthFirst(curr *TrieNode, max int, res *IDSet) {
+// Keys returns up to n of the stored keys starting with prefix, in lexicographic order.
+// Only keys holding at least one id are returned, in the form they were last added in.
+func (t *GenericTrie[V]) Keys(prefix string, n int) []string {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	keys := []string{}
+	if n <= 0 {
+		return keys
+	}
+	now := t.cutoff()
+	walk(t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		if node.hasLive(now) {
+			keys = append(keys, node.displayKey(string(key)))
+		}
+		return len(keys) < n
+	})
+	return keys
+}
+
+// AutocompleteKeys returns up to n complete keys starting with prefix for display in a typeahead, in lexicographic order.
+// The prefix itself comes first when it is a complete key. It shares the traversal used by GetMany and is equivalent to Keys.
+func (t *GenericTrie[V]) AutocompleteKeys(prefix string, n int) []string {
+	return t.Keys(prefix, n)
+}
+
+// GenericKeyID is a single (key, id) pair stored in the Trie
+type GenericKeyID[V comparable] struct {
+	Key string
+	ID  V
+}
+
+// KeyID is the GenericKeyID of a Trie
+type KeyID = GenericKeyID[bson.ObjectId]
+
+// GenericKeyMatch pairs a stored key with the ids found under it
+type GenericKeyMatch[V comparable] struct {
+	Key string
+	IDs []V
+}
+
+// KeyMatch is the GenericKeyMatch of a Trie
+type KeyMatch = GenericKeyMatch[bson.ObjectId]
+
+// GetManyWithKeys returns the keys starting with prefix together with their ids, in lexicographic key order,
+// until n ids have been collected in total. The limit may cut the last key's id list short. Unlike GetMany,
+// an id stored under several matching keys is reported under each of them.
+func (t *GenericTrie[V]) GetManyWithKeys(prefix string, n int) []GenericKeyMatch[V] {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	matches := []GenericKeyMatch[V]{}
+	if n <= 0 {
+		return matches
+	}
+	total := 0
+	now := t.cutoff()
+	walk(t.prefixTip(prefix), []rune(prefix), func(key []rune, node *GenericNode[V]) bool {
+		ids := node.liveVals(now)
+		if len(ids) == 0 {
+			return true
+		}
+		if len(ids) > n-total {
+			ids = ids[:n-total]
+		}
+		matches = append(matches, GenericKeyMatch[V]{Key: node.displayKey(string(key)), IDs: ids})
+		total += len(ids)
+		return total < n
+	})
+	return matches
+}
+
+// Count returns the number of distinct ids stored under keys starting with prefix, which is the length
+// GetMany would return given an unlimited n. An id stored under several matching keys is counted once.
+// Count walks the subtree and tracks the ids it has seen, but never builds or sorts a result list.
+func (t *GenericTrie[V]) Count(prefix string) int {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return countIDs(t.prefixTip(prefix), t.cutoff())
+}
+
+// countIDs returns the number of distinct ids stored at curr and below it, leaving out the pairs expired at now. A
+// zero now leaves out none.
+func countIDs[V comparable](curr *GenericNode[V], now time.Time) int {
+	seen := make(map[V]struct{})
+	walk(curr, nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			seen[id] = struct{}{}
+		}
+		return true
+	})
+	return len(seen)
+}
+
+// RuneCount pairs a possible next rune with the number of ids found below it
+type RuneCount struct {
+	Rune    rune
+	Count   int
+	Cluster string // the whole grapheme cluster Rune starts with WithGraphemeClusters, otherwise just Rune
+}
+
+// NextCharacters lists the runes that can follow prefix in a stored key, in ascending order, each with the number of
+// distinct ids stored under prefix+rune, for drill-down browsing. Ids stored at prefix itself are not counted under any rune.
+// With WithGraphemeClusters the entries are the whole grapheme clusters that can follow prefix instead; see Cluster.
+func (t *GenericTrie[V]) NextCharacters(prefix string) []RuneCount {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	counts := []RuneCount{}
+	curr := t.prefixTip(prefix)
 	if curr == nil {
-		return
+		return counts
+	}
+	now := t.cutoff()
+	if t.cfg.graphemes {
+		return nextClusters(curr, []rune(prefix), now)
 	}
-	runes := curr.GetAllRunes()
-	idList := curr.GetVals()
+	for _, r := range curr.GetAllRunes() {
+		if count := countIDs(curr.GetLink(r), now); count != 0 {
+			counts = append(counts, RuneCount{Rune: r, Count: count, Cluster: string(r)})
+		}
+	}
+	return counts
+}
 
-	if len(idList) > 0 { // There is a value(s) here
-		for i := 0; i < len(idList); i++ {
-			if res.Size() < max {
-				res.SaveVal(idList[i])
+// GetManyFilter is GetMany returning only the ids for which keep returns true, applying keep during the traversal so
+// that n counts kept ids and exactly n are returned whenever enough survivors exist. keep runs while the read lock is
+// held, so it must be fast, must not block and must not call back into the Trie.
+func (t *GenericTrie[V]) GetManyFilter(prefix string, n int, keep func(V) bool) []V {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	ids := []V{}
+	if curr := t.prefixTip(prefix); curr != nil {
+		depthFirstFilter(curr, n, NewSet[V](), &ids, keep, t.cutoff())
+	}
+	return ids
+}
+
+/*
+GetManyPage returns the ids GetMany would return at positions [offset, offset+limit) for the prefix, so successive
+pages concatenate to one large GetMany with no gaps or duplicates while the Trie is not modified in between. The
+skipped results are counted past rather than returned; only the set used to recognise ids already seen at another
+key is kept for them.
+*/
+func (t *GenericTrie[V]) GetManyPage(prefix string, offset, limit int) []V {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	ids := []V{}
+	if limit <= 0 {
+		return ids
+	}
+	seen := NewSet[V]()
+	now := t.cutoff()
+	walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			if seen.ContainsVal(id) {
+				continue
+			}
+			seen.SaveVal(id)
+			if seen.Size() > offset {
+				ids = append(ids, id)
+				if len(ids) == limit {
+					return false
+				}
 			}
 		}
-		if curr.IsLeafNode() {
-			return
+		return true
+	})
+	return ids
+}
+
+// GetManyBudget is GetMany visiting at most maxNodes nodes of the subtree under prefix. truncated reports that the
+// budget ran out with nodes left unvisited before n ids were found, so the result may be missing matches.
+func (t *GenericTrie[V]) GetManyBudget(prefix string, n, maxNodes int) (ids []V, truncated bool) {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	ids = []V{}
+	if n <= 0 {
+		return ids, false
+	}
+	res := NewSet[V]()
+	visited := 0
+	now := t.cutoff()
+	walk(t.prefixTip(prefix), nil, func(_ []rune, node *GenericNode[V]) bool {
+		if visited >= maxNodes {
+			truncated = true
+			return false
+		}
+		visited++
+		for _, id := range node.liveVals(now) {
+			if res.Size() >= n {
+				return false
+			}
+			if !res.ContainsVal(id) {
+				res.SaveVal(id)
+				ids = append(ids, id)
+			}
 		}
+		return res.Size() < n
+	})
+	return ids, truncated
+}
+
+/*
+GetManyBFS is GetMany walking the subtree under prefix level by level, so ids stored at shorter keys come back before
+those at longer ones; keys of the same length come back in lexicographic order. The frontier holds one level of the
+subtree plus the part of the next level discovered so far, so memory is bounded by the widest level under the prefix.
+*/
+func (t *GenericTrie[V]) GetManyBFS(prefix string, n int) []V {
+	prefix = t.normalize(prefix)
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	ids := []V{}
+	curr := t.prefixTip(prefix)
+	if curr == nil || n <= 0 {
+		return ids
 	}
-	for _, currentRune := range runes {
-		depthFirst(curr.GetLink(currentRune), max, res)
+	res := NewSet[V]()
+	now := t.cutoff()
+	level := []*GenericNode[V]{curr}
+	for len(level) > 0 {
+		var next []*GenericNode[V]
+		for _, node := range level {
+			for _, id := range node.liveVals(now) {
+				if !res.ContainsVal(id) {
+					res.SaveVal(id)
+					ids = append(ids, id)
+					if len(ids) == n {
+						return ids
+					}
+				}
+			}
+			// Parents are taken in key order and children in rune order, so the next level stays in key order
+			for _, r := range node.GetAllRunes() {
+				next = append(next, node.GetLink(r))
+			}
+		}
+		level = next
+	}
+	return ids
+}
+
+/*
+depthFirst collects up to max ids below curr into ids, using res to skip ids already collected at another key and
+skipping the pairs expired at now, none if now is zero. Children are visited in rune order and each node's ids in
+ObjectId order, so the results come back in lexicographic key order and are identical between calls on an unchanged
+trie.
+*/
+func depthFirst[V comparable](curr *GenericNode[V], max int, res *Set[V], ids *[]V, now time.Time) {
+	depthFirstFilter(curr, max, res, ids, nil, now)
+}
+
+// depthFirstFilter is depthFirst collecting only the ids for which keep returns true, so that max counts kept ids.
+// A nil keep keeps every id.
+func depthFirstFilter[V comparable](curr *GenericNode[V], max int, res *Set[V], ids *[]V, keep func(V) bool, now time.Time) {
+	if res.Size() >= max {
+		return
+	}
+	walk(curr, nil, func(_ []rune, node *GenericNode[V]) bool {
+		for _, id := range node.liveVals(now) {
+			if res.Size() >= max {
+				// The result set is full, so there is no reason to walk the rest of the subtree
+				return false
+			}
+			if !res.ContainsVal(id) && (keep == nil || keep(id)) {
+				res.SaveVal(id)
+				*ids = append(*ids, id)
+			}
+		}
+		return res.Size() < max
+	})
+}
+
+/*
+walk visits curr and every node below it depth first, a node before its children and children in ascending rune order,
+so nodes are visited in lexicographic key order. visit receives each node with its full key, built by extending
+prefix with the runes along the path; the key slice is reused between calls and is only valid during the call.
+The walk stops as soon as visit returns false. It uses an explicit stack rather than recursion, so very long keys
+do not grow the goroutine stack.
+*/
+func walk[V comparable](curr *GenericNode[V], prefix []rune, visit func(key []rune, node *GenericNode[V]) bool) {
+	if curr == nil {
+		return
+	}
+	key := append([]rune(nil), prefix...)
+	base := len(key)
+	stack := []walkFrame[V]{{curr, base, 0}}
+	children := &walkChildren[V]{}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.depth > base {
+			key = append(key[:f.depth-1], f.r)
+		}
+		if !visit(key, f.node) {
+			return
+		}
+		start := len(stack)
+		for r, link := range f.node.link {
+			if link != nil {
+				stack = append(stack, walkFrame[V]{link, f.depth + 1, r})
+			}
+		}
+		// Sort the children in place, in descending rune order so they are popped in ascending order, so the walk
+		// allocates nothing per node
+		if children.frames = stack[start:]; len(children.frames) > 1 {
+			sort.Sort(children)
+		}
 	}
 }
+
+// walkFrame is a node waiting to be visited by walk, at the given depth below the key's first rune, reached by r
+type walkFrame[V comparable] struct {
+	node  *GenericNode[V]
+	depth int
+	r     rune
+}
+
+// walkChildren sorts the frames of the children of one node in descending rune order
+type walkChildren[V comparable] struct {
+	frames []walkFrame[V]
+}
+
+func (c *walkChildren[V]) Len() int           { return len(c.frames) }
+func (c *walkChildren[V]) Less(i, j int) bool { return c.frames[i].r > c.frames[j].r }
+func (c *walkChildren[V]) Swap(i, j int)      { c.frames[i], c.frames[j] = c.frames[j], c.frames[i] }
@@ -0,0 +1,1053 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// objectID returns the i-th of a sequence of ObjectIds in ascending order
+func objectID(i int) bson.ObjectId {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b, 0x5f000000)
+	binary.BigEndian.PutUint64(b[4:], uint64(i))
+	return bson.ObjectId(b)
+}
+
+// stringValue returns the i-th of a sequence of strings in ascending order
+func stringValue(i int) string {
+	return fmt.Sprintf("v%06d", i)
+}
+
+// bothValueTypes runs a test of the generic core as subtests holding ObjectIds and strings
+func bothValueTypes(t *testing.T, ids func(*testing.T, func(int) bson.ObjectId), strs func(*testing.T, func(int) string)) {
+	t.Run("ObjectId", func(t *testing.T) { ids(t, objectID) })
+	t.Run("string", func(t *testing.T) { strs(t, stringValue) })
+}
+
+// vals returns the values of val numbered by is
+func vals[V comparable](val func(int) V, is ...int) []V {
+	res := []V{}
+	for _, i := range is {
+		res = append(res, val(i))
+	}
+	return res
+}
+
+// expect fails the test if got differs from want
+func expect(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func TestAddGet(t *testing.T) { bothValueTypes(t, testAddGet[bson.ObjectId], testAddGet[string]) }
+
+func testAddGet[V comparable](t *testing.T, val func(int) V) {
+	tr := NewGenericTrie[V]()
+	added, err := tr.Add("Apple", val(2))
+	expect(t, "first Add", added, true)
+	expect(t, "Add error", err, nil)
+	added, _ = tr.Add("apple", val(2))
+	expect(t, "duplicate Add", added, false)
+	tr.Add("APPLE", val(1))
+	tr.Add("apples", val(3))
+	if _, err := tr.Add("  ", val(4)); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Add of a blank key = %v, want ErrEmptyKey", err)
+	}
+	expect(t, "Get", tr.Get("aPPle"), vals(val, 1, 2))
+	expect(t, "Get of an interior key", tr.Get("app"), vals(val))
+	expect(t, "Get of the empty key", tr.Get(""), vals(val))
+	got, ok := tr.GetOK("app")
+	expect(t, "GetOK of an interior key", ok, true)
+	expect(t, "GetOK values", got, vals(val))
+	_, ok = tr.GetOK("banana")
+	expect(t, "GetOK of a missing key", ok, false)
+	expect(t, "Has", tr.Has("apples"), true)
+	expect(t, "Has of an interior key", tr.Has("app"), false)
+	expect(t, "HasPrefix", tr.HasPrefix("app"), true)
+	expect(t, "HasPrefix of a missing prefix", tr.HasPrefix("b"), false)
+	expect(t, "KeyCount", tr.KeyCount(), 2)
+	expect(t, "ValueCount", tr.ValueCount(), 3)
+}
+
+func TestGetMany(t *testing.T) { bothValueTypes(t, testGetMany[bson.ObjectId], testGetMany[string]) }
+
+func testGetMany[V comparable](t *testing.T, val func(int) V) {
+	tr := NewGenericTrie[V]()
+	for _, p := range []struct {
+		key string
+		i   int
+	}{{"ab", 5}, {"aa", 4}, {"abc", 1}, {"b", 9}, {"ac", 3}, {"a", 7}, {"abc", 5}, {"ab", 2}} {
+		tr.Add(p.key, val(p.i))
+	}
+	// Lexicographic key order, each key's values in value order, each value once
+	expect(t, "GetMany", tr.GetMany("a", 100), vals(val, 7, 4, 2, 5, 1, 3))
+	expect(t, "GetMany limited", tr.GetMany("a", 3), vals(val, 7, 4, 2))
+	expect(t, "GetMany of a missing prefix", tr.GetMany("z", 3), vals(val))
+	expect(t, "Count", tr.Count("a"), 6)
+	expect(t, "Keys", tr.Keys("a", 10), []string{"a", "aa", "ab", "abc", "ac"})
+	expect(t, "GetManyPage", tr.GetManyPage("a", 2, 3), vals(val, 2, 5, 1))
+	expect(t, "GetManyBFS", tr.GetManyBFS("a", 100), vals(val, 7, 4, 2, 5, 3, 1))
+	expect(t, "GetManyFilter", tr.GetManyFilter("a", 2, func(v V) bool { return v != val(7) }), vals(val, 4, 2))
+	expect(t, "GetManyWithKeys", tr.GetManyWithKeys("ab", 3), []GenericKeyMatch[V]{
+		{Key: "ab", IDs: vals(val, 2, 5)}, {Key: "abc", IDs: vals(val, 1)},
+	})
+	expect(t, "GetManyUnion", tr.GetManyUnion([]string{"b", "ab"}, 10), vals(val, 9, 2, 5, 1))
+	expect(t, "GetManyIntersect", tr.GetManyIntersect([]string{"ab", "abc"}, 10), vals(val, 5, 1))
+	expect(t, "GetManyExcept", tr.GetManyExcept("a", []string{"ab"}, 10), vals(val, 7, 4, 3))
+
+	var paged []V
+	cursor := ""
+	for {
+		ids, next, err := tr.GetManyCursor("a", 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, ids...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	// The cursor reports an id once per key it is stored under
+	expect(t, "GetManyCursor pages", paged, vals(val, 7, 4, 2, 5, 1, 5, 3))
+}
+
+func TestRemove(t *testing.T) { bothValueTypes(t, testRemove[bson.ObjectId], testRemove[string]) }
+
+func testRemove[V comparable](t *testing.T, val func(int) V) {
+	tr := NewGenericTrie[V]()
+	tr.Add("abcdef", val(1))
+	tr.Add("abc", val(1))
+	tr.Add("abc", val(2))
+	expect(t, "Remove", tr.Remove("abcdef", val(1)), true)
+	expect(t, "Remove again", tr.Remove("abcdef", val(1)), false)
+	if tr.root.GetLink('a').GetLink('b').GetLink('c').IsLeafNode() != true {
+		t.Fatal("Remove left the emptied branch below abc")
+	}
+	expect(t, "RemoveAll", tr.RemoveAll("abc"), 2)
+	if !tr.root.IsLeafNode() {
+		t.Fatal("RemoveAll left the emptied branch")
+	}
+
+	tr.Add("x", val(1))
+	tr.Add("y", val(1))
+	tr.Add("y", val(2))
+	expect(t, "RemoveID", tr.RemoveID(val(1)), 2)
+	expect(t, "contents after RemoveID", tr.ToMap(), map[string][]V{"y": vals(val, 2)})
+	tr.Add("yy", val(3))
+	expect(t, "RemoveFunc", tr.RemoveFunc("y", func(v V) bool { return v == val(3) }), 1)
+	expect(t, "DeleteSubtree", tr.DeleteSubtree("y"), 1)
+	expect(t, "KeyCount after removing everything", tr.KeyCount(), 0)
+	expect(t, "ValueCount after removing everything", tr.ValueCount(), 0)
+
+	tr.AddMany([]GenericKeyID[V]{{"k1", val(1)}, {"k2", val(2)}, {"k1", val(1)}})
+	expect(t, "RemoveMany", tr.RemoveMany([]GenericKeyID[V]{{"k1", val(1)}, {"k2", val(9)}}), 1)
+	expect(t, "contents after RemoveMany", tr.ToMap(), map[string][]V{"k2": vals(val, 2)})
+}
+
+func TestModify(t *testing.T) { bothValueTypes(t, testModify[bson.ObjectId], testModify[string]) }
+
+func testModify[V comparable](t *testing.T, val func(int) V) {
+	tr := NewGenericTrie[V]()
+	tr.Add("old", val(1))
+	tr.Add("new", val(2))
+	if err := tr.Rename("old", "New"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "Get after Rename", tr.Get("new"), vals(val, 1, 2))
+	expect(t, "Keys after Rename", tr.Keys("", 10), []string{"New"})
+	if err := tr.Rename("old", "x"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Rename of a missing key = %v, want ErrKeyNotFound", err)
+	}
+	if err := tr.ReplaceVal("new", val(1), val(3)); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "Get after ReplaceVal", tr.Get("new"), vals(val, 2, 3))
+	if err := tr.ReplaceVal("new", val(1), val(3)); !errors.Is(err, ErrIDNotFound) {
+		t.Fatalf("ReplaceVal of a missing value = %v, want ErrIDNotFound", err)
+	}
+
+	var batch GenericBatch[V]
+	batch.Add("b", val(4))
+	batch.Remove("new", val(2))
+	batch.Add("", val(5))
+	if err := tr.Apply(batch); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("Apply of a batch with an empty key = %v, want ErrEmptyKey", err)
+	}
+	expect(t, "contents after a failed Apply", tr.ToMap(), map[string][]V{"new": vals(val, 2, 3)})
+	batch.Ops = batch.Ops[:2]
+	if err := tr.Apply(batch); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "contents after Apply", tr.ToMap(), map[string][]V{"new": vals(val, 3), "b": vals(val, 4)})
+
+	clone := tr.Clone()
+	clone.Add("c", val(5))
+	tr.Remove("b", val(4))
+	expect(t, "clone", clone.ToMap(), map[string][]V{"new": vals(val, 3), "b": vals(val, 4), "c": vals(val, 5)})
+	expect(t, "original", tr.ToMap(), map[string][]V{"new": vals(val, 3)})
+	tr.Swap(clone)
+	expect(t, "KeyCount after Swap", tr.KeyCount(), 3)
+	expect(t, "KeyCount of the swapped out Trie", clone.KeyCount(), 0)
+	tr.Clear()
+	expect(t, "KeyCount after Clear", tr.KeyCount(), 0)
+}
+
+func TestBuild(t *testing.T) { bothValueTypes(t, testBuild[bson.ObjectId], testBuild[string]) }
+
+func testBuild[V comparable](t *testing.T, val func(int) V) {
+	m := map[string][]V{}
+	entries := make(chan GenericKeyID[V], 1000)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("%c%d", 'a'+i%7, i%50)
+		m[key] = append(m[key], val(i))
+		entries <- GenericKeyID[V]{Key: key, ID: val(i)}
+	}
+	close(entries)
+	for _, ids := range m {
+		sortValues(ids)
+	}
+	built := BuildTrie(entries, 4)
+	expect(t, "BuildTrie", built.ToMap(), m)
+	expect(t, "NewTrieFromMap", NewTrieFromMap(m).ToMap(), m)
+
+	rebuilt := NewGenericTrie[V]()
+	err := rebuilt.Rebuild(context.Background(), func(yield func(GenericKeyID[V]) bool) {
+		for key, ids := range m {
+			for _, id := range ids {
+				yield(GenericKeyID[V]{Key: key, ID: id})
+			}
+		}
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "Rebuild", rebuilt.ToMap(), m)
+	expect(t, "ValueCount", rebuilt.ValueCount(), 1000)
+}
+
+func TestSerialize(t *testing.T) {
+	bothValueTypes(t, testSerialize[bson.ObjectId], testSerialize[string])
+}
+
+func testSerialize[V comparable](t *testing.T, val func(int) V) {
+	tr := NewGenericTrie[V]()
+	tr.Add("Alpha", val(1))
+	tr.Add("alphabet", val(2))
+	tr.Add("alphabet", val(3))
+	tr.Add("Zürich", val(1))
+	want := tr.ToMap()
+
+	data, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBinary := NewGenericTrie[V]()
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "binary round trip", fromBinary.ToMap(), want)
+	expect(t, "display forms after the binary round trip", fromBinary.Keys("", 10), []string{"Alpha", "alphabet", "Zürich"})
+
+	data, err = json.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON := NewGenericTrie[V]()
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "JSON round trip", fromJSON.ToMap(), want)
+
+	var buf bytes.Buffer
+	if err := tr.EncodeGob(&buf); err != nil {
+		t.Fatal(err)
+	}
+	fromGob, err := DecodeGobGeneric[V](&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "gob round trip", fromGob.ToMap(), want)
+
+	buf.Reset()
+	if err := tr.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGeneric[V](&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "Save and Load", loaded.ToMap(), want)
+
+	imported := NewGenericTrie[V]()
+	imported.Import(tr.Export(), true)
+	expect(t, "Export and Import", imported.ToMap(), want)
+
+	chunks := tr.ToBSONChunks(1 << 10)
+	fromChunks, err := FromBSONChunksGeneric[V](chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "BSON chunk round trip", fromChunks.ToMap(), want)
+}
+
+func TestSnapshotValueType(t *testing.T) {
+	strs := NewStringTrie()
+	strs.Add("key", "value")
+	data, err := strs.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewTrie().UnmarshalBinary(data); err == nil {
+		t.Fatal("a snapshot of strings loaded into a Trie of ObjectIds")
+	}
+}
+
+func TestSet(t *testing.T) {
+	s := NewSet[string]()
+	for _, v := range []string{"a", "b", "c", "b"} {
+		s.SaveVal(v)
+	}
+	expect(t, "Size", s.Size(), 3)
+	expect(t, "Remove", s.Remove("a"), true)
+	expect(t, "Remove of a missing value", s.Remove("a"), false)
+	expect(t, "GetVals after Remove", s.GetVals(), []string{"c", "b"})
+	expect(t, "ContainsVal", s.ContainsVal("c"), true)
+	vals := s.GetVals()
+	vals[0] = "x"
+	expect(t, "ContainsVal after modifying GetVals", s.ContainsVal("x"), false)
+}
+
+// TestMultibyteKeys checks that keys link one node per rune, whatever its encoded length, and that Remove prunes them
+func TestMultibyteKeys(t *testing.T) {
+	tr := NewTrie()
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	for key, id := range map[string]bson.ObjectId{"東京": a, "東京都": b, "café": c, "crème": a, "👍🏽": b, "👍": c} {
+		tr.Add(key, id)
+	}
+	expect(t, "Get of a CJK key", tr.Get("東京"), []bson.ObjectId{a})
+	expect(t, "GetMany of a one-rune CJK prefix", tr.GetMany("東", 10), []bson.ObjectId{a, b})
+	expect(t, "Get of an accented key", tr.Get("CAFÉ"), []bson.ObjectId{c})
+	expect(t, "GetMany of a prefix ending in an accent", tr.GetMany("crè", 10), []bson.ObjectId{a})
+	expect(t, "GetMany of an emoji", tr.GetMany("👍", 10), []bson.ObjectId{c, b})
+	expect(t, "KeyCount", tr.KeyCount(), 6)
+	if tr.root.GetLink('東') == nil || tr.root.GetLink('東').GetLink('京') == nil {
+		t.Fatal("東京 is not stored one node per rune")
+	}
+
+	tr.Remove("東京都", b)
+	expect(t, "東京 is a leaf after Remove", tr.root.GetLink('東').GetLink('京').IsLeafNode(), true)
+	tr.Remove("東京", a)
+	expect(t, "Get after Remove", tr.GetMany("東", 10), []bson.ObjectId{})
+	if tr.root.GetLink('東') != nil {
+		t.Fatal("Remove left the emptied CJK branch")
+	}
+	tr.Remove("👍🏽", b)
+	expect(t, "👍 is a leaf after Remove", tr.root.GetLink('👍').IsLeafNode(), true)
+	expect(t, "Get of the remaining emoji", tr.Get("👍"), []bson.ObjectId{c})
+}
+
+// TestConcurrentAccess runs Add, Get, GetMany and Remove from many goroutines; run it with -race
+func TestConcurrentAccess(t *testing.T) {
+	tr := NewTrie()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key%d-%d", g, i%20)
+				tr.Add(key, objectID(i))
+				tr.Get(key)
+				tr.GetMany("key", 10)
+				tr.Remove(key, objectID(i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	expect(t, "ValueCount", tr.ValueCount(), 0)
+	if !tr.root.IsLeafNode() {
+		t.Fatal("concurrent Removes left nodes behind")
+	}
+}
+
+// TestGetManyDeterministic checks that GetMany returns the same ids in lexicographic key order on every call
+func TestGetManyDeterministic(t *testing.T) {
+	tr := NewTrie()
+	for i, key := range []string{"zeta", "alpha", "mu", "beta", "alphabet", "omega", "ça", "a"} {
+		tr.Add(key, objectID(i))
+	}
+	want := []bson.ObjectId{objectID(7), objectID(1), objectID(4), objectID(3), objectID(2), objectID(5), objectID(0), objectID(6)}
+	for i := 0; i < 100; i++ {
+		expect(t, fmt.Sprintf("GetMany call %d", i), tr.GetMany("", 100), want)
+	}
+}
+
+// largeTrie returns a Trie of n keys of six lowercase letters, each holding its own id
+func largeTrie(tb testing.TB, n int) *Trie {
+	tb.Helper()
+	tr := NewTrie()
+	for i := 0; i < n; i++ {
+		key := []byte("aaaaaa")
+		for j, v := len(key)-1, i; j >= 0; j, v = j-1, v/26 {
+			key[j] = byte('a' + v%26)
+		}
+		tr.Add(string(key), objectID(i))
+	}
+	return tr
+}
+
+// TestGetManyLimit checks that stopping the walk at n results returns the first n ids of the unlimited walk
+func TestGetManyLimit(t *testing.T) {
+	tr := largeTrie(t, 5000)
+	all := tr.GetMany("", 5000)
+	expect(t, "unlimited GetMany", len(all), 5000)
+	for _, n := range []int{0, 1, 10, 999, 5000, 6000} {
+		want := all
+		if n < len(all) {
+			want = all[:n]
+		}
+		expect(t, fmt.Sprintf("GetMany(%d)", n), tr.GetMany("", n), want)
+	}
+}
+
+// BenchmarkGetManyLimit measures a small GetMany over a large Trie, which should stop once n ids are found
+func BenchmarkGetManyLimit(b *testing.B) {
+	tr := largeTrie(b, 200000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.GetMany("a", 10)
+	}
+}
+
+// TestEmptyKeys checks that empty and whitespace-only keys are rejected by Add and behave as absent everywhere else
+func TestEmptyKeys(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("a", objectID(1))
+	for _, key := range []string{"", " ", "\t\n", "  "} {
+		if added, err := tr.Add(key, objectID(2)); added || !errors.Is(err, ErrEmptyKey) {
+			t.Fatalf("Add(%q) = %v, %v, want ErrEmptyKey", key, added, err)
+		}
+		expect(t, fmt.Sprintf("Get(%q)", key), tr.Get(key), []bson.ObjectId{})
+		expect(t, fmt.Sprintf("Has(%q)", key), tr.Has(key), false)
+		expect(t, fmt.Sprintf("Remove(%q)", key), tr.Remove(key, objectID(2)), false)
+	}
+	expect(t, "values at the root", tr.root.IDSet.Size(), 0)
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{"a": {objectID(1)}})
+}
+
+// TestGetOK checks that GetOK tells an interior node, a complete key and a missing prefix apart
+func TestGetOK(t *testing.T) {
+	tr := NewTrie()
+	a := objectID(1)
+	tr.Add("apple", a)
+	for _, c := range []struct {
+		key  string
+		ids  []bson.ObjectId
+		path bool
+	}{
+		{"app", []bson.ObjectId{}, true},
+		{"apple", []bson.ObjectId{a}, true},
+		{"apples", []bson.ObjectId{}, false},
+		{"banana", []bson.ObjectId{}, false},
+	} {
+		ids, ok := tr.GetOK(c.key)
+		expect(t, fmt.Sprintf("GetOK(%q)", c.key), []interface{}{ids, ok}, []interface{}{c.ids, c.path})
+		expect(t, fmt.Sprintf("Get(%q)", c.key), tr.Get(c.key), c.ids)
+	}
+}
+
+// TestDeepKey checks that traversals of a 100k-rune key neither recurse nor lose their limits
+func TestDeepKey(t *testing.T) {
+	tr := NewTrie()
+	key := strings.Repeat("ab", 50000)
+	a, b := objectID(1), objectID(2)
+	tr.Add(key, a)
+	tr.Add(key[:50000], b)
+	expect(t, "GetMany", tr.GetMany("ab", 10), []bson.ObjectId{b, a})
+	expect(t, "GetMany limited", tr.GetMany("ab", 1), []bson.ObjectId{b})
+	expect(t, "Count", tr.Count(""), 2)
+	expect(t, "Remove", tr.Remove(key, a), true)
+	expect(t, "Remove of the shorter key", tr.Remove(key[:50000], b), true)
+	if !tr.root.IsLeafNode() {
+		t.Fatal("Remove left nodes of the deep key behind")
+	}
+}
+
+// TestHasPrefix checks that a chain of nodes with no values anywhere below it does not count as a prefix
+func TestHasPrefix(t *testing.T) {
+	tr := NewTrie()
+	a := objectID(1)
+	tr.Add("car", a)
+	tr.Add("cartoon", a)
+	tr.Remove("cartoon", a)
+	expect(t, "HasPrefix of a removed key", tr.HasPrefix("cart"), false)
+	expect(t, "HasPrefix of a stored key", tr.HasPrefix("car"), true)
+	expect(t, "HasPrefix of an interior prefix", tr.HasPrefix("ca"), true)
+	expect(t, "HasPrefix of the empty prefix", tr.HasPrefix(""), true)
+
+	// A chain left behind with no values, as nodes built by hand or before pruning would be
+	chain := NewTrieNode()
+	chain.PutLink('y', NewTrieNode())
+	tr.root.GetLink('c').PutLink('x', chain)
+	expect(t, "HasPrefix of a bare interior chain", tr.HasPrefix("cx"), false)
+	expect(t, "HasPrefix of the end of a bare chain", tr.HasPrefix("cxy"), false)
+	tr.Remove("car", a)
+	expect(t, "HasPrefix of an emptied Trie", tr.HasPrefix(""), false)
+}
+
+// recount walks the whole Trie and returns the number of keys holding values and of pairs, to check the counters
+// maintained by the mutators against
+func recount[V comparable](tr *GenericTrie[V]) (keys, values int) {
+	walk(tr.root, nil, func(_ []rune, node *GenericNode[V]) bool {
+		if size := node.IDSet.Size(); size != 0 {
+			keys++
+			values += size
+		}
+		return true
+	})
+	return keys, values
+}
+
+// TestKeyCount checks KeyCount against recount through every kind of mutation
+func TestKeyCount(t *testing.T) {
+	tr := NewTrie(WithReverseIndex())
+	a, b := objectID(1), objectID(2)
+	check := func(what string, want int) {
+		t.Helper()
+		keys, _ := recount(tr)
+		expect(t, "recount "+what, keys, want)
+		expect(t, "KeyCount "+what, tr.KeyCount(), want)
+	}
+	check("of an empty Trie", 0)
+	tr.Add("ab", a)
+	tr.Add("ab", b)
+	tr.Add("abc", a)
+	tr.Add("b", a)
+	check("after Add", 3)
+	tr.Remove("ab", a)
+	check("after removing one of two ids", 3)
+	tr.Remove("ab", b)
+	check("after removing the last id", 2)
+	tr.Rename("abc", "b")
+	check("after Rename into an existing key", 1)
+	tr.AddMany([]KeyID{{Key: "x", ID: a}, {Key: "y", ID: a}})
+	tr.RemoveID(a)
+	check("after RemoveID", 0)
+	tr.Add("z", b)
+	tr.Clear()
+	check("after Clear", 0)
+}
+
+// TestValueCount checks ValueCount against recount through duplicate Adds and removal down to zero
+func TestValueCount(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	check := func(what string, want int) {
+		t.Helper()
+		_, values := recount(tr)
+		expect(t, "recount "+what, values, want)
+		expect(t, "ValueCount "+what, tr.ValueCount(), want)
+	}
+	tr.Add("ab", a)
+	tr.Add("ab", b)
+	tr.Add("abc", a)
+	check("after Add", 3)
+	tr.Add("AB", a)
+	tr.Add("ab", b)
+	check("after duplicate Adds", 3)
+	tr.Remove("ab", objectID(3))
+	check("after removing a missing pair", 3)
+	tr.Remove("ab", a)
+	tr.Remove("ab", b)
+	tr.Remove("abc", a)
+	check("after removing every pair", 0)
+	tr.Remove("abc", a)
+	check("after removing a removed pair", 0)
+}
+
+// TestClear checks that every key is gone after Clear and that the Trie keeps working afterwards
+func TestClear(t *testing.T) {
+	tr := NewTrie(WithReverseIndex(), WithSuffixIndex())
+	keys := []string{"alpha", "alphabet", "beta"}
+	for i, key := range keys {
+		tr.Add(key, objectID(i))
+	}
+	tr.Clear()
+	for _, key := range keys {
+		expect(t, "Get after Clear of "+key, tr.Get(key), []bson.ObjectId{})
+		expect(t, "GetMany after Clear of "+key, tr.GetMany(key, 10), []bson.ObjectId{})
+	}
+	expect(t, "GetBySuffix after Clear", tr.GetBySuffix("a", 10), []bson.ObjectId{})
+	expect(t, "RemoveID after Clear", tr.RemoveID(objectID(0)), 0)
+	expect(t, "KeyCount after Clear", tr.KeyCount(), 0)
+	expect(t, "Add after Clear", mustAdd(t, tr, "alpha", objectID(0)), true)
+	expect(t, "GetMany after adding again", tr.GetMany("al", 10), []bson.ObjectId{objectID(0)})
+	expect(t, "GetBySuffix after adding again", tr.GetBySuffix("pha", 10), []bson.ObjectId{objectID(0)})
+}
+
+// TestClone checks that a Clone shares nothing with the original, metadata and indexes included
+func TestClone(t *testing.T) {
+	tr := NewTrie(WithReverseIndex(), WithInfixIndex())
+	a, b := objectID(1), objectID(2)
+	tr.AddWeighted("Alpha", a, 2)
+	tr.Add("alphabet", b)
+	want := marshalBinary(t, tr)
+	clone := tr.Clone()
+	expect(t, "the clone's contents", bytes.Equal(marshalBinary(t, clone), want), true)
+
+	clone.Add("ALPHA", b)
+	clone.SetWeight("alpha", a, 5)
+	clone.Remove("alphabet", b)
+	clone.RemoveID(a)
+	clone.Add("gamma", a)
+	if !bytes.Equal(marshalBinary(t, tr), want) {
+		t.Fatalf("modifying the clone changed the original to %v", tr.GetManyWithKeys("", 10))
+	}
+	expect(t, "the original's display form", tr.Keys("", 10), []string{"Alpha", "alphabet"})
+	expect(t, "the original's infix index", tr.GetContaining("bet", 10), []bson.ObjectId{b})
+	expect(t, "the original's reverse index", tr.RemoveID(a), 1)
+	expect(t, "the clone after the original changed", clone.ToMap(), map[string][]bson.ObjectId{"alpha": {b}, "gamma": {a}})
+}
+
+// BenchmarkClone measures cloning a Trie of 100k keys
+func BenchmarkClone(b *testing.B) {
+	tr := largeTrie(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Clone()
+	}
+}
+
+// TestGetManyWithKeys checks keys contributing several ids and a limit cutting a key's id list in half
+func TestGetManyWithKeys(t *testing.T) {
+	tr := NewTrie()
+	a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+	for _, id := range []bson.ObjectId{a, b, c, d} {
+		tr.Add("team", id)
+	}
+	tr.Add("Tea", a)
+	tr.Add("teams", b)
+	expect(t, "GetManyWithKeys", tr.GetManyWithKeys("tea", 10), []KeyMatch{
+		{Key: "Tea", IDs: []bson.ObjectId{a}},
+		{Key: "team", IDs: []bson.ObjectId{a, b, c, d}},
+		{Key: "teams", IDs: []bson.ObjectId{b}},
+	})
+	expect(t, "GetManyWithKeys cutting a key short", tr.GetManyWithKeys("tea", 3), []KeyMatch{
+		{Key: "Tea", IDs: []bson.ObjectId{a}},
+		{Key: "team", IDs: []bson.ObjectId{a, b}},
+	})
+	expect(t, "GetManyWithKeys ending on a key", tr.GetManyWithKeys("team", 4), []KeyMatch{
+		{Key: "team", IDs: []bson.ObjectId{a, b, c, d}},
+	})
+	expect(t, "GetManyWithKeys with no limit", tr.GetManyWithKeys("tea", 0), []KeyMatch{})
+}
+
+// TestCount checks that Count matches the length of an unlimited GetMany
+func TestCount(t *testing.T) {
+	tr := NewTrie()
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("ab", a)
+	tr.Add("abc", a)
+	tr.Add("abc", b)
+	tr.Add("b", c)
+	for _, prefix := range []string{"", "a", "ab", "abc", "abcd", "b", "z"} {
+		expect(t, fmt.Sprintf("Count(%q)", prefix), tr.Count(prefix), len(tr.GetMany(prefix, 100)))
+	}
+	expect(t, "Count of an id under two keys", tr.Count("a"), 2)
+}
+
+// BenchmarkCount measures counting every id below a prefix of a large Trie
+func BenchmarkCount(b *testing.B) {
+	tr := largeTrie(b, 200000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Count("a")
+	}
+}
+
+// TestRemoveAll checks that RemoveAll prunes a node left a valueless leaf and keeps one with children
+func TestRemoveAll(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	tr.Add("ab", a)
+	tr.Add("ab", b)
+	tr.Add("abcd", a)
+	tr.Add("x", b)
+	expect(t, "RemoveAll of a node with children", tr.RemoveAll("ab"), 2)
+	if tr.root.GetLink('a').GetLink('b') == nil {
+		t.Fatal("RemoveAll pruned a node with children")
+	}
+	expect(t, "Get of the cleared key", tr.Get("ab"), []bson.ObjectId{})
+	expect(t, "GetMany below the cleared key", tr.GetMany("ab", 10), []bson.ObjectId{a})
+	expect(t, "RemoveAll of a leaf", tr.RemoveAll("abcd"), 1)
+	if tr.root.GetLink('a') != nil {
+		t.Fatal("RemoveAll left the emptied branch")
+	}
+	expect(t, "RemoveAll of a missing key", tr.RemoveAll("abcd"), 0)
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{"x": {b}})
+	expect(t, "KeyCount", tr.KeyCount(), 1)
+}
+
+// TestRename checks renaming a key to itself, to a prefix of itself and onto a key already holding ids
+func TestRename(t *testing.T) {
+	tr := NewTrie(WithReverseIndex())
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("smith", a)
+	expect(t, "Rename to the same key in another casing", tr.Rename("smith", "Smith"), nil)
+	expect(t, "contents after renaming to itself", tr.ToMap(), map[string][]bson.ObjectId{"smith": {a}})
+	expect(t, "display form after renaming to itself", tr.Keys("", 10), []string{"Smith"})
+
+	tr.Add("smithson", b)
+	expect(t, "Rename to a prefix of the key", tr.Rename("smithson", "smiths"), nil)
+	expect(t, "contents after renaming to a prefix", tr.ToMap(), map[string][]bson.ObjectId{"smith": {a}, "smiths": {b}})
+	if tr.root.GetLink('s').GetLink('m').GetLink('i').GetLink('t').GetLink('h').GetLink('s').IsLeafNode() != true {
+		t.Fatal("Rename to a prefix left the old branch below it")
+	}
+	expect(t, "Rename to an extension of the key", tr.Rename("smiths", "smithsonian"), nil)
+	expect(t, "contents after renaming to an extension", tr.ToMap(), map[string][]bson.ObjectId{"smith": {a}, "smithsonian": {b}})
+
+	tr.Add("jones", b)
+	tr.Add("jones", c)
+	expect(t, "Rename onto a populated key", tr.Rename("smithsonian", "Jones"), nil)
+	expect(t, "contents after merging", tr.ToMap(), map[string][]bson.ObjectId{"smith": {a}, "jones": {b, c}})
+	expect(t, "display form after merging", tr.Keys("j", 10), []string{"Jones"})
+	expect(t, "KeyCount after merging", tr.KeyCount(), 2)
+	expect(t, "ValueCount after merging", tr.ValueCount(), 3)
+	expect(t, "RemoveID after merging", tr.RemoveID(b), 1)
+	expect(t, "Rename of a missing key", tr.Rename("smithsonian", "x"), ErrKeyNotFound)
+}
+
+// TestReplaceValConcurrent checks that readers running during a stream of ReplaceVal calls always see exactly one of
+// the two ids; run it with -race
+func TestReplaceValConcurrent(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	tr.Add("key", a)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if ids := tr.Get("key"); len(ids) != 1 || (ids[0] != a && ids[0] != b) {
+					t.Errorf("Get during ReplaceVal = %v, want exactly one of %v and %v", ids, a, b)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 2000; i++ {
+		from, to := a, b
+		if i%2 == 1 {
+			from, to = b, a
+		}
+		if err := tr.ReplaceVal("key", from, to); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	expect(t, "Get after the last ReplaceVal", tr.Get("key"), []bson.ObjectId{a})
+}
+
+// TestDeleteSubtree checks that DeleteSubtree reaches every descendant and leaves sibling branches untouched
+func TestDeleteSubtree(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	for _, key := range []string{"car", "card", "cards", "care", "cat", "ca"} {
+		tr.Add(key, a)
+	}
+	tr.Add("dog", b)
+	expect(t, "DeleteSubtree", tr.DeleteSubtree("car"), 4)
+	for _, key := range []string{"car", "card", "cards", "care"} {
+		expect(t, "Get of the removed "+key, tr.Get(key), []bson.ObjectId{})
+	}
+	expect(t, "Keys of the sibling branches", tr.Keys("", 10), []string{"ca", "cat", "dog"})
+	expect(t, "KeyCount", tr.KeyCount(), 3)
+	expect(t, "ValueCount", tr.ValueCount(), 3)
+	if tr.root.GetLink('c').GetLink('a').GetLink('r') != nil {
+		t.Fatal("DeleteSubtree left the removed branch")
+	}
+	expect(t, "DeleteSubtree of a missing prefix", tr.DeleteSubtree("cow"), 0)
+	expect(t, "DeleteSubtree of everything", tr.DeleteSubtree(""), 3)
+	expect(t, "KeyCount after deleting everything", tr.KeyCount(), 0)
+}
+
+// TestRemoveReport checks what Remove reports for a missing id, a missing key and a stored pair
+func TestRemoveReport(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	tr.Add("abc", a)
+	tr.Add("abcd", a)
+	expect(t, "Remove of an id not at an existing key", tr.Remove("abc", b), false)
+	expect(t, "Remove of a missing key", tr.Remove("xyz", a), false)
+	expect(t, "Remove of an interior key", tr.Remove("ab", a), false)
+	expect(t, "contents after failed Removes", tr.ValueCount(), 2)
+	expect(t, "Remove of a stored pair", tr.Remove("ABC", a), true)
+	expect(t, "Get after Remove", tr.Get("abc"), []bson.ObjectId{})
+	expect(t, "Remove of the longer key", tr.Remove("abcd", a), true)
+	if !tr.root.IsLeafNode() {
+		t.Fatal("Remove left the emptied branch")
+	}
+}
+
+// TestRemoveFunc checks predicates matching everything, nothing, and some ids, emptying some nodes but not others
+func TestRemoveFunc(t *testing.T) {
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	fill := func() *Trie {
+		tr := NewTrie()
+		tr.Add("ab", a)
+		tr.Add("ab", b)
+		tr.Add("abc", a)
+		tr.Add("abd", c)
+		tr.Add("x", a)
+		return tr
+	}
+	tr := fill()
+	expect(t, "RemoveFunc matching nothing", tr.RemoveFunc("", func(bson.ObjectId) bool { return false }), 0)
+	expect(t, "ValueCount after matching nothing", tr.ValueCount(), 5)
+
+	expect(t, "RemoveFunc matching some ids", tr.RemoveFunc("ab", func(id bson.ObjectId) bool { return id == a }), 2)
+	expect(t, "contents after matching some ids", tr.ToMap(), map[string][]bson.ObjectId{"ab": {b}, "abd": {c}, "x": {a}})
+	if tr.root.GetLink('a').GetLink('b').GetLink('c') != nil {
+		t.Fatal("RemoveFunc left the emptied abc")
+	}
+
+	tr = fill()
+	expect(t, "RemoveFunc matching everything", tr.RemoveFunc("a", func(bson.ObjectId) bool { return true }), 4)
+	expect(t, "contents after matching everything", tr.ToMap(), map[string][]bson.ObjectId{"x": {a}})
+	if tr.root.GetLink('a') != nil {
+		t.Fatal("RemoveFunc left the emptied branch")
+	}
+	expect(t, "KeyCount", tr.KeyCount(), 1)
+}
+
+// TestMixedCaseRemove checks that Add, Get and Remove normalize keys alike, whichever casing each is given
+func TestMixedCaseRemove(t *testing.T) {
+	a := objectID(1)
+	for _, c := range []struct{ add, get, remove string }{
+		{"McDonald", "mcdonald", "MCDONALD"},
+		{"mcdonald", "McDonald", "mCdONALD"},
+		{"ÉCOLE", "école", "École"},
+	} {
+		tr := NewTrie()
+		tr.Add(c.add, a)
+		expect(t, fmt.Sprintf("Get(%q) after Add(%q)", c.get, c.add), tr.Get(c.get), []bson.ObjectId{a})
+		expect(t, fmt.Sprintf("Remove(%q) after Add(%q)", c.remove, c.add), tr.Remove(c.remove, a), true)
+		expect(t, fmt.Sprintf("Get(%q) after Remove", c.add), tr.Get(c.add), []bson.ObjectId{})
+		if !tr.root.IsLeafNode() {
+			t.Fatalf("Remove(%q) left the branch of %q", c.remove, c.add)
+		}
+	}
+}
+
+// TestSwapConcurrent swaps between two generations of contents while readers check that every result comes entirely
+// from one of them; run it with -race
+func TestSwapConcurrent(t *testing.T) {
+	generation := func(g int) *Trie {
+		tr := NewTrie()
+		for i := 0; i < 20; i++ {
+			tr.Add(fmt.Sprintf("key%02d", i), objectID(g))
+		}
+		return tr
+	}
+	live := generation(1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				matches := live.GetManyWithKeys("key", 100)
+				if len(matches) != 20 {
+					t.Errorf("a reader saw %d keys during Swap, want 20", len(matches))
+					return
+				}
+				for _, m := range matches {
+					if len(m.IDs) != 1 || m.IDs[0] != matches[0].IDs[0] {
+						t.Errorf("a reader saw a mix of generations: %v", matches)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		live.Swap(generation(2 + i%2))
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestNextCharactersCompleteKey checks that the ids of a prefix that is itself a key are not counted under any next rune
+func TestNextCharactersCompleteKey(t *testing.T) {
+	tr := NewTrie()
+	a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+	tr.Add("car", a)
+	tr.Add("car", d)
+	tr.Add("card", a)
+	tr.Add("cart", b)
+	tr.Add("carton", c)
+	tr.Add("cartoon", c)
+	tr.Add("caré", b)
+	expect(t, "NextCharacters of a complete key", tr.NextCharacters("car"), []RuneCount{
+		{Rune: 'd', Count: 1, Cluster: "d"},
+		{Rune: 't', Count: 2, Cluster: "t"},
+		{Rune: 'é', Count: 1, Cluster: "é"},
+	})
+	expect(t, "NextCharacters above it", tr.NextCharacters("ca"), []RuneCount{{Rune: 'r', Count: 4, Cluster: "r"}})
+	expect(t, "NextCharacters normalizing the prefix", tr.NextCharacters("CART"), []RuneCount{{Rune: 'o', Count: 1, Cluster: "o"}})
+	expect(t, "NextCharacters of a leaf", tr.NextCharacters("card"), []RuneCount{})
+	expect(t, "NextCharacters of a missing prefix", tr.NextCharacters("cat"), []RuneCount{})
+	tr.Remove("card", a)
+	expect(t, "NextCharacters after the only key below a rune is removed", tr.NextCharacters("car"), []RuneCount{
+		{Rune: 't', Count: 2, Cluster: "t"},
+		{Rune: 'é', Count: 1, Cluster: "é"},
+	})
+}
+
+// TestGetManyFilterLimit checks that rejected ids do not count towards n, so n results come back when enough survivors
+// lie deeper in the subtree
+func TestGetManyFilterLimit(t *testing.T) {
+	tr := largeTrie(t, 2000)
+	even := func(id bson.ObjectId) bool { return id[len(id)-1]%2 == 0 }
+	for _, n := range []int{1, 10, 500, 1000} {
+		got := tr.GetManyFilter("a", n, even)
+		var want []bson.ObjectId
+		for _, id := range tr.GetMany("a", 2000) {
+			if even(id) && len(want) < n {
+				want = append(want, id)
+			}
+		}
+		expect(t, fmt.Sprintf("GetManyFilter(%d)", n), got, want)
+	}
+	// Only the last key survives, below every other
+	last := objectID(1999)
+	expect(t, "GetManyFilter with one survivor", tr.GetManyFilter("", 5, func(id bson.ObjectId) bool { return id == last }), []bson.ObjectId{last})
+	expect(t, "GetManyFilter with fewer survivors than n", len(tr.GetManyFilter("", 1500, even)), 1000)
+	expect(t, "GetManyFilter keeping nothing", tr.GetManyFilter("", 5, func(bson.ObjectId) bool { return false }), []bson.ObjectId{})
+}
+
+// TestGetManyPageConcatenation checks that successive pages, ids repeated across keys included, concatenate to one
+// large GetMany
+func TestGetManyPageConcatenation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr := NewTrie()
+	for i := 0; i < 3000; i++ {
+		tr.Add(randomKey(rng, []rune("abcé")), objectID(rng.Intn(1000)))
+	}
+	want := tr.GetMany("", 5000)
+	for _, limit := range []int{1, 7, 100, 999, 5000} {
+		got := []bson.ObjectId{}
+		for offset := 0; ; offset += limit {
+			page := tr.GetManyPage("", offset, limit)
+			got = append(got, page...)
+			if len(page) < limit {
+				break
+			}
+		}
+		expect(t, fmt.Sprintf("pages of %d", limit), got, want)
+	}
+	expect(t, "GetManyPage past the end", tr.GetManyPage("", len(want), 10), []bson.ObjectId{})
+	expect(t, "GetManyPage of a prefix", tr.GetManyPage("ab", 3, 4), tr.GetMany("ab", 7)[3:])
+	expect(t, "GetManyPage with no limit", tr.GetManyPage("", 0, 0), []bson.ObjectId{})
+}
+
+// TestGetManyBudgetTruncated builds a subtree whose ids lie at the end of long chains, so the budget runs out before n
+// ids are found
+func TestGetManyBudgetTruncated(t *testing.T) {
+	tr := NewTrie()
+	a, b, c := objectID(1), objectID(2), objectID(3)
+	tr.Add("x", a)
+	tr.Add("xabcdefghij", b)
+	tr.Add("xzzzzzzzzzz", c)
+	for _, q := range []struct {
+		n, maxNodes int
+		ids         []bson.ObjectId
+		truncated   bool
+	}{
+		{3, 5, []bson.ObjectId{a}, true},     // stopped partway down the first chain
+		{3, 11, []bson.ObjectId{a, b}, true}, // the second chain not reached
+		{3, 20, []bson.ObjectId{a, b}, true}, // the last node of the second chain not reached
+		{3, 21, []bson.ObjectId{a, b, c}, false},
+		{3, 100, []bson.ObjectId{a, b, c}, false},
+		{1, 1, []bson.ObjectId{a}, false}, // n found on the budget's last node
+		{3, 0, []bson.ObjectId{}, true},
+	} {
+		ids, truncated := tr.GetManyBudget("x", q.n, q.maxNodes)
+		expect(t, fmt.Sprintf("GetManyBudget(%d, %d)", q.n, q.maxNodes), []interface{}{ids, truncated}, []interface{}{q.ids, q.truncated})
+	}
+	ids, truncated := tr.GetManyBudget("y", 3, 0)
+	expect(t, "GetManyBudget of a missing prefix", []interface{}{ids, truncated}, []interface{}{[]bson.ObjectId{}, false})
+}
+
+// TestGetManyBFSOrder checks that ids of shorter keys come first, where GetMany would follow each branch to its end
+func TestGetManyBFSOrder(t *testing.T) {
+	tr := NewTrie()
+	byLength := []string{"al", "ali", "alice", "aliceinwonderland"}
+	for i := len(byLength) - 1; i >= 0; i-- {
+		tr.Add(byLength[i], objectID(i))
+	}
+	tr.Add("alb", objectID(4))
+	tr.Add("alz", objectID(5))
+	tr.Add("alan", objectID(6))
+	expect(t, "GetManyBFS by key length", tr.GetManyBFS("al", 10),
+		[]bson.ObjectId{objectID(0), objectID(4), objectID(1), objectID(5), objectID(6), objectID(2), objectID(3)})
+	expect(t, "GetMany by key", tr.GetMany("al", 10),
+		[]bson.ObjectId{objectID(0), objectID(6), objectID(4), objectID(1), objectID(2), objectID(3), objectID(5)})
+	expect(t, "GetManyBFS stopping at n", tr.GetManyBFS("ali", 2), []bson.ObjectId{objectID(1), objectID(2)})
+	tr.Add("alice", objectID(0))
+	expect(t, "GetManyBFS of an id at several depths", tr.GetManyBFS("ali", 10), []bson.ObjectId{objectID(1), objectID(0), objectID(2), objectID(3)})
+	expect(t, "GetManyBFS of a missing prefix", tr.GetManyBFS("bob", 10), []bson.ObjectId{})
+}
+
+// TestAutocompleteKeys checks that a prefix which is itself a complete key comes first, and that keys are rebuilt
+// rune by rune from multi-byte paths
+func TestAutocompleteKeys(t *testing.T) {
+	tr := NewTrie()
+	for i, key := range []string{"cafés", "Café au lait", "café", "cafe", "日本酒", "日本", "日本語", "👍🏽"} {
+		tr.Add(key, objectID(i))
+	}
+	for _, q := range []struct {
+		prefix string
+		n      int
+		want   []string
+	}{
+		{"café", 10, []string{"café", "Café au lait", "cafés"}},
+		{"CAFÉ", 1, []string{"café"}},
+		{"caf", 10, []string{"cafe", "café", "Café au lait", "cafés"}},
+		{"日", 10, []string{"日本", "日本語", "日本酒"}},
+		{"日本", 2, []string{"日本", "日本語"}},
+		{"👍", 10, []string{"👍🏽"}},
+		{"本", 10, []string{}},
+		{"café", 0, []string{}},
+	} {
+		expect(t, fmt.Sprintf("AutocompleteKeys(%q, %d)", q.prefix, q.n), tr.AutocompleteKeys(q.prefix, q.n), q.want)
+	}
+}
@@ -1,68 +1,220 @@
 package indexes
 
 import (
+	"sort"
+	"time"
+
 	"gopkg.in/mgo.v2/bson"
 )
 
-// TrieNode defines a new TrieNode structure
-type TrieNode struct {
-	link  map[rune]*TrieNode
-	IDSet *IDSet
+// GenericNode defines a node of a GenericTrie. Its methods do no locking of their own;
+// callers reaching nodes returned from a Trie must not use them concurrently with Trie mutations.
+type GenericNode[V comparable] struct {
+	link  map[rune]*GenericNode[V]
+	IDSet *Set[V]
+	meta  map[V]*entryMeta // per-id metadata, nil until an id at this node has any
+
+	display string // the key as last added, before normalizing, if that differs from its stored form
+	gen     uint64 // Trie generation of the latest change to a pair at or below the node
+}
+
+// entryMeta holds what is stored alongside one (key, id) pair beyond its presence
+type entryMeta struct {
+	weight float64
+	hits   float64   // hit count, decayed as of hitAt when WithHitHalfLife is used
+	hitAt  time.Time // when hits was last updated
+	fields []string  // fields the key was taken from, by AddTagged, in the order first tagged
+
+	payload interface{} // caller data stored by AddEntry, returned as is by GetEntries
+	addedAt time.Time   // when the pair was first stored, or last added again with WithRefreshAddedAt
+	expires time.Time   // when the pair stops being returned, zero if it never does
 }
 
+// TrieNode defines a new TrieNode structure, the node of a Trie
+type TrieNode = GenericNode[bson.ObjectId]
+
 /*
 NewTrieNode returns a new nul Trie Node object
 */
 func NewTrieNode() *TrieNode {
-	return &TrieNode{make(map[rune]*TrieNode), NewIDSet()}
+	return NewGenericNode[bson.ObjectId]()
+}
+
+// NewGenericNode returns an empty node of a GenericTrie
+func NewGenericNode[V comparable]() *GenericNode[V] {
+	return &GenericNode[V]{link: make(map[rune]*GenericNode[V]), IDSet: NewSet[V]()}
 }
 
 // GetLink will get the link at the specifed rune
-func (tn *TrieNode) GetLink(r rune) *TrieNode {
+func (tn *GenericNode[V]) GetLink(r rune) *GenericNode[V] {
 	return tn.link[r]
 }
 
 // PutLink will place is a link for the given rune and link
-func (tn *TrieNode) PutLink(r rune, link *TrieNode) {
+func (tn *GenericNode[V]) PutLink(r rune, link *GenericNode[V]) {
 	tn.link[r] = link
 }
 
-// GetAllRunes returns an array of all the keys in the map
-func (tn *TrieNode) GetAllRunes() []rune {
+// GetAllRunes returns an array of all the keys in the map, sorted in ascending rune order
+func (tn *GenericNode[V]) GetAllRunes() []rune {
 	var keys []rune
-	for k := range tn.link {
-		keys = append(keys, k)
+	for k, link := range tn.link {
+		if link != nil {
+			keys = append(keys, k)
+		}
 	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
 	return keys
 }
 
-// RemoveLink returns an array of all the keys in the map
-func (tn *TrieNode) RemoveLink(r rune) {
-	tn.link[r] = nil
+// RemoveLink deletes the link for the given rune from the map
+func (tn *GenericNode[V]) RemoveLink(r rune) {
+	delete(tn.link, r)
 }
 
 // SaveVal will save the passed in objectID into the TrieNode
-func (tn *TrieNode) SaveVal(id bson.ObjectId) {
+func (tn *GenericNode[V]) SaveVal(id V) {
 	tn.IDSet.SaveVal(id)
 }
 
-// GetVals will return the bson objectIDs for the node as an array
-func (tn *TrieNode) GetVals() []bson.ObjectId {
-	return tn.IDSet.GetVals()
+// GetVals will return the values for the node as a freshly allocated array sorted by ObjectId, or in the natural
+// order of other value types, so callers may sort, append to, or truncate it without corrupting the node
+func (tn *GenericNode[V]) GetVals() []V {
+	ids := tn.IDSet.GetVals()
+	sortValues(ids)
+	return ids
 }
 
 // RemoveVal accepts an array of bson.objectIDs and sets the current node's value to this new array. Good for updating the node.
-func (tn *TrieNode) RemoveVal(id bson.ObjectId) {
+func (tn *GenericNode[V]) RemoveVal(id V) {
 	tn.IDSet.Remove(id)
+	delete(tn.meta, id)
+	if tn.IDSet.Size() == 0 {
+		tn.display = ""
+	}
+}
+
+// ClearVals removes every value stored at the node
+func (tn *GenericNode[V]) ClearVals() {
+	tn.IDSet = NewSet[V]()
+	tn.meta = nil
+	tn.display = ""
+}
+
+// setDisplay records original as the form the key stored at the node was added in
+func (tn *GenericNode[V]) setDisplay(original, key string) {
+	if original == key {
+		original = ""
+	}
+	tn.display = original
+}
+
+// displayKey returns the key stored at the node, given in its stored form, as it was last added
+func (tn *GenericNode[V]) displayKey(key string) string {
+	if tn.display != "" {
+		return tn.display
+	}
+	return key
+}
+
+// clone returns a copy of m sharing nothing with it
+func (m *entryMeta) clone() entryMeta {
+	c := *m
+	c.fields = append([]string(nil), m.fields...)
+	return c
+}
+
+// getMeta returns the metadata stored for id at the node, or nil if it has none
+func (tn *GenericNode[V]) getMeta(id V) *entryMeta {
+	return tn.meta[id]
+}
+
+// putMeta returns the metadata stored for id at the node, creating it if needed
+func (tn *GenericNode[V]) putMeta(id V) *entryMeta {
+	m := tn.meta[id]
+	if m == nil {
+		if tn.meta == nil {
+			tn.meta = make(map[V]*entryMeta)
+		}
+		m = &entryMeta{}
+		tn.meta[id] = m
+	}
+	return m
+}
+
+// weight returns the weight stored for id at the node, 0 if none was set
+func (tn *GenericNode[V]) weight(id V) float64 {
+	if m := tn.meta[id]; m != nil {
+		return m.weight
+	}
+	return 0
+}
+
+// payload returns the data stored for id at the node by AddEntry, nil if none was
+func (tn *GenericNode[V]) payload(id V) interface{} {
+	if m := tn.meta[id]; m != nil {
+		return m.payload
+	}
+	return nil
+}
+
+// addedAt returns when id was stored at the node
+func (tn *GenericNode[V]) addedAt(id V) time.Time {
+	if m := tn.meta[id]; m != nil {
+		return m.addedAt
+	}
+	return time.Time{}
+}
+
+// expired reports whether the pair of id at the node has an expiry that is not after now
+func (tn *GenericNode[V]) expired(id V, now time.Time) bool {
+	m := tn.meta[id]
+	return m != nil && !m.expires.IsZero() && !now.Before(m.expires)
+}
+
+// liveVals is GetVals leaving out the ids whose pair expired at now. A zero now leaves out none.
+func (tn *GenericNode[V]) liveVals(now time.Time) []V {
+	ids := tn.GetVals()
+	if now.IsZero() {
+		return ids
+	}
+	live := ids[:0]
+	for _, id := range ids {
+		if !tn.expired(id, now) {
+			live = append(live, id)
+		}
+	}
+	return live
+}
+
+// hasLive reports whether the node stores an id whose pair has not expired at now. A zero now counts every id.
+func (tn *GenericNode[V]) hasLive(now time.Time) bool {
+	if now.IsZero() {
+		return tn.IDSet.Size() != 0
+	}
+	for _, id := range tn.IDSet.vals {
+		if !tn.expired(id, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// hits returns the hit count recorded for id at the node and when it was last updated
+func (tn *GenericNode[V]) hits(id V) (float64, time.Time) {
+	if m := tn.meta[id]; m != nil {
+		return m.hits, m.hitAt
+	}
+	return 0, time.Time{}
 }
 
 // ContainsVal returns true if the current node contains the given bson.objectID
-func (tn *TrieNode) ContainsVal(id bson.ObjectId) bool {
+func (tn *GenericNode[V]) ContainsVal(id V) bool {
 	return tn.IDSet.ContainsVal(id)
 }
 
 // IsLeafNode returns bool true if the current node does not have any children links
 // false is returned otherwise
-func (tn *TrieNode) IsLeafNode() bool {
+func (tn *GenericNode[V]) IsLeafNode() bool {
 	return len(tn.GetAllRunes()) == 0
 }
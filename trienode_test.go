@@ -0,0 +1,76 @@
+package indexes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TestRemoveLink checks that removing a long key deletes every link it created, leaving the root with no children
+func TestRemoveLink(t *testing.T) {
+	tr := NewTrie()
+	key := strings.Repeat("abcdefghij", 10)
+	tr.Add(key, objectID(1))
+	tr.Remove(key, objectID(1))
+	if !tr.root.IsLeafNode() || len(tr.root.link) != 0 {
+		t.Fatalf("root has %d links after removing the only key, want none", len(tr.root.link))
+	}
+
+	node := NewTrieNode()
+	node.PutLink('b', NewTrieNode())
+	node.PutLink('a', nil)
+	expect(t, "GetAllRunes skipping a nil link", node.GetAllRunes(), []rune{'b'})
+	node.RemoveLink('b')
+	node.RemoveLink('a')
+	expect(t, "links after RemoveLink", len(node.link), 0)
+	expect(t, "IsLeafNode after RemoveLink", node.IsLeafNode(), true)
+}
+
+// TestGetValsCopy checks that callers modifying returned slices leave the Trie's contents intact
+func TestGetValsCopy(t *testing.T) {
+	tr := NewTrie()
+	a, b := objectID(1), objectID(2)
+	tr.Add("key", a)
+	tr.Add("key", b)
+	tr.Add("keys", a)
+	for name, got := range map[string][]bson.ObjectId{
+		"GetVals": tr.root.GetLink('k').GetLink('e').GetLink('y').GetVals(),
+		"Get":     tr.Get("key"),
+		"GetMany": tr.GetMany("k", 10),
+	} {
+		got[0] = objectID(9)
+		_ = append(got[:1], objectID(8))
+		expect(t, "Get after modifying the result of "+name, tr.Get("key"), []bson.ObjectId{a, b})
+		expect(t, "GetMany after modifying the result of "+name, tr.GetMany("k", 10), []bson.ObjectId{a, b})
+	}
+}
+
+// BenchmarkGet measures Get of keys holding typical numbers of ids, each result a fresh copy
+func BenchmarkGet(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		tr := NewTrie()
+		for i := 0; i < n; i++ {
+			tr.Add("key", objectID(i))
+		}
+		b.Run(fmt.Sprintf("ids=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tr.Get("key")
+			}
+		})
+	}
+}
+
+// TestGetAllRunesSorted checks that children come back in ascending rune order, whatever their encoded length
+func TestGetAllRunesSorted(t *testing.T) {
+	node := NewTrieNode()
+	want := []rune("0AZaz~ßéπЖ中日本👍")
+	for i := len(want) - 1; i >= 0; i-- {
+		node.PutLink(want[i], NewTrieNode())
+	}
+	for i := 0; i < 20; i++ {
+		expect(t, "GetAllRunes", node.GetAllRunes(), want)
+	}
+}
@@ -0,0 +1,58 @@
+package indexes
+
+import (
+	"time"
+)
+
+/*
+AddWithTTL is Add for a pair that expires after ttl, such as a short-lived session handle. Every query, from Get and
+Keys to GetManyCursor and GetEntries, stops returning an expired pair at once, and a key holding only expired pairs is
+no longer listed; KeyCount, ValueCount, Stats and the binary, gob and BSON snapshots keep seeing the pair, with its
+expiry, until Purge removes it. Adding a pair that is already stored resets its expiry, so a non-positive ttl expires it at once; a plain
+Add leaves the expiry of a live pair alone and stores an expired one afresh, without expiry. Times come from the
+WithClock clock.
+*/
+func (t *GenericTrie[V]) AddWithTTL(key string, id V, ttl time.Duration) (bool, error) {
+	stored, err := t.storedKey(key)
+	if err != nil {
+		return false, err
+	}
+	t.mx.Lock()
+	defer t.unlock()
+	t.expiring = true
+	node, inserted := t.insert(stored, key, id)
+	node.putMeta(id).expires = t.now().Add(ttl)
+	return inserted, nil
+}
+
+// cutoff returns the time pairs are checked for expiry against, zero if no pair can expire so the checks can be skipped
+func (t *GenericTrie[V]) cutoff() time.Time {
+	if !t.expiring {
+		return time.Time{}
+	}
+	return t.now()
+}
+
+// Purge removes every expired pair under the write lock, pruning the branches left empty, and returns the number of
+// pairs removed. It walks the whole Trie and is meant to be called periodically.
+func (t *GenericTrie[V]) Purge() int {
+	t.mx.Lock()
+	defer t.unlock()
+	if !t.expiring {
+		return 0
+	}
+	now := t.now()
+	var expired []GenericKeyID[V]
+	walk(t.root, nil, func(key []rune, node *GenericNode[V]) bool {
+		for id := range node.meta {
+			if node.expired(id, now) {
+				expired = append(expired, GenericKeyID[V]{Key: string(key), ID: id})
+			}
+		}
+		return true
+	})
+	for _, p := range expired {
+		t.removePair(p.Key, p.ID)
+	}
+	return len(expired)
+}
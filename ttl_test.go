@@ -0,0 +1,156 @@
+package indexes
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ttlQueries runs every read path of tr over keys around "session" and "sessions", whose pairs TestTTLQueries expires
+func ttlQueries(tr *Trie) map[string]interface{} {
+	ctx := context.Background()
+	res := map[string]interface{}{}
+	res["Get"] = tr.Get("sessions")
+	ids, ok := tr.GetOK("sessions")
+	res["GetOK"] = []interface{}{ids, ok}
+	res["Has"] = tr.Has("sessions")
+	res["HasPrefix"] = tr.HasPrefix("sessio")
+	res["GetMany"] = tr.GetMany("", 10)
+	res["Keys"] = tr.Keys("", 10)
+	res["GetManyWithKeys"] = tr.GetManyWithKeys("", 10)
+	res["Count"] = tr.Count("")
+	res["NextCharacters"] = tr.NextCharacters("se")
+	res["GetManyFilter"] = tr.GetManyFilter("", 10, func(bson.ObjectId) bool { return true })
+	res["GetManyPage"] = tr.GetManyPage("", 0, 10)
+	ids, truncated := tr.GetManyBudget("", 10, 100)
+	res["GetManyBudget"] = []interface{}{ids, truncated}
+	res["GetManyBFS"] = tr.GetManyBFS("", 10)
+	res["GetManyUnion"] = tr.GetManyUnion([]string{"sess", "a"}, 10)
+	res["GetManyIntersect"] = tr.GetManyIntersect([]string{"sessi", "s"}, 10)
+	res["GetManyExcept"] = tr.GetManyExcept("", []string{"sessi"}, 10)
+	ids, next, err := tr.GetManyCursor("", 10, "")
+	res["GetManyCursor"] = []interface{}{ids, next, err}
+	var streamed []bson.ObjectId
+	for id := range tr.GetManyStream(ctx, "") {
+		streamed = append(streamed, id)
+	}
+	res["GetManyStream"] = streamed
+	res["GetEntries"] = tr.GetEntries("", 10)
+	res["GetAddedSince"] = tr.GetAddedSince("", time.Unix(0, 0), 10)
+	ids, err = tr.GetManyCtx(ctx, "", 10)
+	res["GetManyCtx"] = []interface{}{ids, err}
+	keys, err := tr.KeysCtx(ctx, "", 10)
+	res["KeysCtx"] = []interface{}{keys, err}
+	matches, err := tr.GetManyWithKeysCtx(ctx, "", 10)
+	res["GetManyWithKeysCtx"] = []interface{}{matches, err}
+	count, err := tr.CountCtx(ctx, "")
+	res["CountCtx"] = []interface{}{count, err}
+	res["GetFuzzy"] = tr.GetFuzzy("sesion", 1, 10)
+	res["Suggest"] = tr.Suggest("sessins", 1, 10)
+	key, ids, ok := tr.LongestPrefixMatch("sessions")
+	res["LongestPrefixMatch"] = []interface{}{key, ids, ok}
+	res["GetContaining"] = tr.GetContaining("ssi", 10)
+	res["GetBySuffix"] = tr.GetBySuffix("ion", 10)
+	res["Match"] = tr.Match("s*n", 10)
+	regexpMatches, truncated := tr.MatchRegexp(regexp.MustCompile(`^s.*n$`), 10)
+	res["MatchRegexp"] = []interface{}{regexpMatches, truncated}
+	res["GetRange"] = tr.GetRange("a", "t", 10)
+	res["GetManyRanked"] = tr.GetManyRanked("", 10)
+	res["GetManyScored"] = tr.GetManyScored("sess", 10)
+	res["GetManyByTime"] = tr.GetManyByTime("", 10, true)
+	res["GetManyCounted"] = tr.GetManyCounted("", 10)
+	res["GetManyOrdered"] = tr.GetManyOrdered("", 10, func(a, b Match) bool { return a.Key < b.Key })
+	res["GetManyFielded"] = tr.GetManyFielded("", 10)
+	res["ToMap"] = tr.ToMap()
+	res["Export"] = tr.Export()
+	data, err := json.Marshal(tr)
+	res["MarshalJSON"] = []interface{}{string(data), err}
+	return res
+}
+
+// TestTTLQueries checks that a pair expiring between two queries disappears from every read path at once, leaving
+// them answering as if it had never been added
+func TestTTLQueries(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		now := time.Unix(1500000000, 0)
+		opts := []Option{WithClock(func() time.Time { return now }), WithInfixIndex(), WithSuffixIndex()}
+		if reverse {
+			opts = append(opts, WithReverseIndex())
+		}
+		a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+		fill := func(tr *Trie) {
+			tr.Add("alpha", a)
+			tr.AddWeighted("sess", b, 2)
+			tr.AddTagged("salmon", c, "fish")
+		}
+		tr, kept, never := NewTrie(opts...), NewTrie(opts...), NewTrie(opts...)
+		fill(tr)
+		fill(kept)
+		fill(never)
+		// d is only stored at an expiring pair, while a is also stored at a lasting one
+		tr.AddWithTTL("session", d, time.Minute)
+		tr.AddWithTTL("sessions", a, time.Minute)
+		kept.Add("session", d)
+		kept.Add("sessions", a)
+
+		before, after := ttlQueries(kept), ttlQueries(never)
+		for name, got := range ttlQueries(tr) {
+			expect(t, name+" before the pairs expire", got, before[name])
+		}
+		now = now.Add(time.Minute)
+		for name, got := range ttlQueries(tr) {
+			expect(t, name+" once the pairs expire", got, after[name])
+		}
+	}
+}
+
+// TestTTLPurge checks that Purge removes expired pairs and reclaims the nodes only they needed
+func TestTTLPurge(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tr := NewTrie(WithClock(func() time.Time { return now }))
+	a, b := objectID(1), objectID(2)
+	tr.Add("sess", b)
+	tr.AddWithTTL("session", a, time.Minute)
+	tr.AddWithTTL("sess", a, time.Hour)
+	nodes := tr.Stats().NodeCount
+	expect(t, "Purge before anything expires", tr.Purge(), 0)
+
+	now = now.Add(time.Minute)
+	expect(t, "ValueCount before Purge", tr.ValueCount(), 3)
+	expect(t, "Purge", tr.Purge(), 1)
+	expect(t, "ValueCount after Purge", tr.ValueCount(), 2)
+	expect(t, "KeyCount after Purge", tr.KeyCount(), 1)
+	expect(t, "nodes reclaimed", nodes-tr.Stats().NodeCount, len("ion"))
+
+	now = now.Add(time.Hour)
+	expect(t, "Purge of the longer-lived pair", tr.Purge(), 1)
+	expect(t, "contents", tr.ToMap(), map[string][]bson.ObjectId{"sess": {b}})
+	expect(t, "Add of a purged pair", mustAdd(t, tr, "session", a), true)
+}
+
+// TestTTLReadd checks that re-adding an expired pair before Purge stores it afresh, without expiry
+func TestTTLReadd(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tr := NewTrie(WithClock(func() time.Time { return now }))
+	a := objectID(1)
+	tr.AddWithTTL("session", a, time.Minute)
+	now = now.Add(time.Minute)
+	expect(t, "Add of an expired pair", mustAdd(t, tr, "session", a), true)
+	now = now.Add(time.Hour)
+	expect(t, "Has", tr.Has("session"), true)
+	expect(t, "Purge", tr.Purge(), 0)
+}
+
+// mustAdd adds the pair, failing the test on error, and returns whether it was newly stored
+func mustAdd(t *testing.T, tr *Trie, key string, id bson.ObjectId) bool {
+	t.Helper()
+	added, err := tr.Add(key, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return added
+}
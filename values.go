@@ -0,0 +1,88 @@
+package indexes
+
+import "errors"
+
+// ErrNilValue is returned by ValueTrie.Add for a nil Value, which has no Key to identify it by
+var ErrNilValue = errors.New("indexes: value must not be nil")
+
+// Value is a value a ValueTrie can store. Key returns the value's identity: two values with the same Key are the same
+// value, whatever their other fields, such as two copies of an entity loaded at different times.
+type Value interface {
+	Key() string
+}
+
+/*
+ValueTrie stores Value implementations, such as entities identified by UUID strings, telling them apart by Key rather
+than by Go equality, so values that are not comparable or that are loaded as fresh copies still deduplicate. It is a
+StringTrie of the values' Keys, with each value stored alongside its Key as the pair's payload, and takes the same
+options. A ValueTrie is safe for concurrent use by multiple goroutines.
+*/
+type ValueTrie struct {
+	keys *StringTrie
+}
+
+// NewValueTrie creates an empty ValueTrie configured by the given options
+func NewValueTrie(opts ...Option) *ValueTrie {
+	return &ValueTrie{keys: NewStringTrie(opts...)}
+}
+
+// Add stores v under the key, reporting whether a value with v's Key was not already stored there. Either way v
+// replaces the copy of its value stored at the key. A nil v fails with ErrNilValue.
+func (t *ValueTrie) Add(key string, v Value) (bool, error) {
+	if v == nil {
+		return false, ErrNilValue
+	}
+	return t.keys.AddEntry(key, v.Key(), v)
+}
+
+// Remove deletes the value with v's Key from the key, returning false if it was not stored there or v is nil
+func (t *ValueTrie) Remove(key string, v Value) bool {
+	if v == nil {
+		return false
+	}
+	return t.keys.Remove(key, v.Key())
+}
+
+// Get returns the values stored at the exact key, ordered by Key
+func (t *ValueTrie) Get(key string) []Value {
+	key = t.keys.normalize(key)
+	t.keys.mx.RLock()
+	defer t.keys.mx.RUnlock()
+	vals := []Value{}
+	if curr := findTip(key, t.keys.root); curr != nil {
+		for _, id := range curr.liveVals(t.keys.cutoff()) {
+			vals = append(vals, curr.payload(id).(Value))
+		}
+	}
+	return vals
+}
+
+// GetMany returns up to n distinct values stored under keys starting with prefix, in lexicographic key order. A value
+// stored under several matching keys comes back once, as the copy stored at the first of them.
+func (t *ValueTrie) GetMany(prefix string, n int) []Value {
+	vals := []Value{}
+	for _, e := range t.keys.GetEntries(prefix, n) {
+		vals = append(vals, e.Payload.(Value))
+	}
+	return vals
+}
+
+// Has returns true if the exact key holds at least one value
+func (t *ValueTrie) Has(key string) bool {
+	return t.keys.Has(key)
+}
+
+// Keys returns up to n of the stored keys starting with prefix, in lexicographic order
+func (t *ValueTrie) Keys(prefix string, n int) []string {
+	return t.keys.Keys(prefix, n)
+}
+
+// Count returns the number of distinct values stored under keys starting with prefix
+func (t *ValueTrie) Count(prefix string) int {
+	return t.keys.Count(prefix)
+}
+
+// Len returns the number of distinct values stored under any key
+func (t *ValueTrie) Len() int {
+	return t.keys.Count("")
+}
@@ -0,0 +1,86 @@
+package indexes
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// user is an entity identified by a UUID string. Its tags make it incomparable, so only its Key can identify it.
+type user struct {
+	uuid string
+	name string
+	tags []string
+}
+
+func (u *user) Key() string { return u.uuid }
+
+// document is an entity identified by its ObjectId
+type document struct {
+	id    bson.ObjectId
+	title string
+}
+
+func (d document) Key() string { return string(d.id) }
+
+func TestValueTrieUUID(t *testing.T) {
+	tr := NewValueTrie()
+	ada := &user{uuid: "0b5e6f4c-7a0d-4b8e-9a53-2f1c5d8e7a61", name: "Ada", tags: []string{"admin"}}
+	bob := &user{uuid: "3d2c1b0a-9f8e-4d7c-8b6a-5f4e3d2c1b0a", name: "Bob"}
+	expectAdd(t, tr, "Ada Lovelace", ada, true)
+	expectAdd(t, tr, "Bob", bob, true)
+	// A fresh copy of Ada is the same value and replaces the stored copy
+	renamed := &user{uuid: ada.uuid, name: "Ada L.", tags: []string{"admin", "math"}}
+	expectAdd(t, tr, "ada lovelace", renamed, false)
+	got := tr.Get("ADA LOVELACE")
+	if len(got) != 1 || got[0] != Value(renamed) {
+		t.Fatalf("Get = %v, want the latest copy of Ada", got)
+	}
+	expectAdd(t, tr, "Ada", ada, true)
+	expect(t, "Count", tr.Count("ada"), 1)
+	expect(t, "Len", tr.Len(), 2)
+	// Ada comes back once, as the copy stored at "Ada", the first matching key
+	expect(t, "GetMany", tr.GetMany("", 10), []Value{ada, bob})
+	expect(t, "Keys", tr.Keys("a", 10), []string{"Ada", "ada lovelace"})
+
+	expect(t, "Remove by a copy", tr.Remove("Ada", &user{uuid: ada.uuid}), true)
+	expect(t, "Remove again", tr.Remove("Ada", ada), false)
+	expect(t, "Len after Remove", tr.Len(), 2)
+	tr.Remove("ada lovelace", ada)
+	expect(t, "Len after removing every copy", tr.Len(), 1)
+	expect(t, "Has", tr.Has("ada lovelace"), false)
+}
+
+func TestValueTrieObjectID(t *testing.T) {
+	tr := NewValueTrie()
+	a, b := document{objectID(2), "Report"}, document{objectID(1), "Reply"}
+	expectAdd(t, tr, "report", a, true)
+	expectAdd(t, tr, "report", b, true)
+	expectAdd(t, tr, "report", document{objectID(2), "Report, revised"}, false)
+	expect(t, "Get", tr.Get("report"), []Value{b, document{objectID(2), "Report, revised"}})
+	expect(t, "GetMany", tr.GetMany("rep", 1), []Value{b})
+	expect(t, "Remove", tr.Remove("report", document{id: objectID(1)}), true)
+	expect(t, "Count", tr.Count("r"), 1)
+}
+
+func TestValueTrieNil(t *testing.T) {
+	tr := NewValueTrie()
+	if _, err := tr.Add("key", nil); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("Add of a nil Value = %v, want ErrNilValue", err)
+	}
+	expect(t, "Remove of a nil Value", tr.Remove("key", nil), false)
+	expect(t, "Len", tr.Len(), 0)
+}
+
+// expectAdd adds v under key and fails the test if Add errs or does not report added
+func expectAdd(t *testing.T, tr *ValueTrie, key string, v Value, added bool) {
+	t.Helper()
+	got, err := tr.Add(key, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != added {
+		t.Fatalf("Add(%q, %v) = %v, want %v", key, v, got, added)
+	}
+}
@@ -0,0 +1,335 @@
+package indexes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// ErrCorruptWAL is returned by Replay when a log record fails its checksum or does not decode
+var ErrCorruptWAL = errors.New("indexes: write-ahead log record is corrupt")
+
+// Operations in a log record
+const (
+	walPut    = 1 // key, display form and pair: the key holds the pair with exactly this metadata
+	walRemove = 2 // key and id: the pair is no longer stored
+	walClear  = 3 // the Trie was emptied
+)
+
+/*
+walLog appends a record to a WithWAL writer for every write-locked operation that changed the Trie. Mutators touch the
+pairs they change, and when the write lock is released each touched pair is logged once, as a walPut of the pair as
+the operation left it or a walRemove if it is gone, so an Add to a key holding many ids logs only the one pair. Clear
+logs a single walClear, and an operation replacing the contents logs a walClear followed by a walPut of every new
+pair, encoded before the write lock is taken. Each record is written in one Write call as
+
+	4 bytes        n, the length of the body, little-endian
+	4 bytes        the CRC-32 (IEEE) of the length
+	n bytes        the body
+	4 bytes        the CRC-32 of the body
+
+The body is a sequence of operations, each an operation byte followed by its arguments written as in the binary
+snapshot format: strings as a uvarint length and their bytes, pairs with their metadata. Payloads stored by AddEntry
+are not logged. Records are sealed under the write lock, each taking the next ticket, but written after it is
+released: a writer waits for the records of earlier tickets to be written, so the log keeps the order the operations
+took effect in without holding up readers or other writers while w is busy.
+*/
+type walLog[V comparable] struct {
+	w io.Writer
+
+	// Guarded by the Trie's write lock
+	base    []byte       // operations logged ahead of the touched pairs, by Clear or a replacement
+	baseErr error        // the error encoding base, if any
+	touched []walPair[V] // pairs changed since the last record, in the order first touched
+	seen    map[walPair[V]]bool
+	tickets uint64 // the ticket of the last record sealed
+
+	mu      sync.Mutex
+	turn    *sync.Cond
+	written uint64 // the ticket of the last record written, guarded by mu
+	err     error  // the first write error, after which nothing more is written, guarded by mu
+}
+
+// walPair is a pair touched since the last record, under its already normalized key
+type walPair[V comparable] struct {
+	key string
+	id  V
+}
+
+// touch records that the pair at the already normalized key may have changed. It does nothing on a nil log.
+// The caller must hold the Trie's write lock.
+func (l *walLog[V]) touch(key string, id V) {
+	if l == nil {
+		return
+	}
+	p := walPair[V]{key, id}
+	if l.seen[p] {
+		return
+	}
+	if l.seen == nil {
+		l.seen = make(map[walPair[V]]bool)
+	}
+	l.seen[p] = true
+	l.touched = append(l.touched, p)
+}
+
+// clear records that the Trie was emptied, which makes every earlier change since the last record moot. The caller
+// must hold the write lock.
+func (l *walLog[V]) clear() {
+	l.replaced([]byte{walClear}, nil)
+}
+
+// replaced records that the contents were replaced by the operations in ops, as encoded by contents. The caller must
+// hold the write lock.
+func (l *walLog[V]) replaced(ops []byte, err error) {
+	if l == nil {
+		return
+	}
+	l.base, l.baseErr = ops, err
+	l.touched, l.seen = l.touched[:0], nil
+}
+
+// contents returns the operations rebuilding fresh from an empty Trie: a walClear followed by a walPut of every pair.
+// fresh must not be reachable by anyone else, since it is read without its lock. It does nothing on a nil log.
+func (l *walLog[V]) contents(fresh *GenericTrie[V]) ([]byte, error) {
+	if l == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	e := &binaryEncoder[V]{w: &buf, codec: codecOf[V]()}
+	e.write([]byte{walClear})
+	err := fresh.snapshot(func(k snapshotKey[V]) error {
+		for _, p := range k.Pairs {
+			if err := e.put(k.Key, k.Display, p); err != nil {
+				return fmt.Errorf("indexes: key %q: %w", k.Key, err)
+			}
+		}
+		return nil
+	})
+	return buf.Bytes(), err
+}
+
+// put writes a walPut of the pair under the stored key
+func (e *binaryEncoder[V]) put(key, display string, p snapshotPair[V]) error {
+	e.write([]byte{walPut})
+	e.str(key)
+	e.str(display)
+	return e.pair(p)
+}
+
+// seal encodes the changes made under the write lock into a record and hands it the next ticket. It returns a nil
+// record if nothing changed. The caller must hold the write lock.
+func (t *GenericTrie[V]) seal() (rec []byte, ticket uint64, err error) {
+	l := t.wal
+	if l.base == nil && len(l.touched) == 0 {
+		return nil, 0, nil
+	}
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	e := &binaryEncoder[V]{w: &buf, codec: codecOf[V]()}
+	e.write(l.base)
+	err = l.baseErr
+	for _, p := range l.touched {
+		if err != nil {
+			break
+		}
+		if node := findTip(p.key, t.root); node != nil && node.ContainsVal(p.id) {
+			if err = e.put(p.key, node.display, snapshotPairOf(node, p.id)); err != nil {
+				err = fmt.Errorf("indexes: key %q: %w", p.key, err)
+			}
+			continue
+		}
+		e.write([]byte{walRemove})
+		e.str(p.key)
+		if err = e.value(p.id); err != nil {
+			err = fmt.Errorf("indexes: key %q: %w", p.key, err)
+		}
+	}
+	l.base, l.baseErr = nil, nil
+	l.touched, l.seen = l.touched[:0], nil
+	e.checksum()
+	rec = buf.Bytes()
+	binary.LittleEndian.PutUint32(rec, uint32(len(rec)-12))
+	binary.LittleEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(rec[:4]))
+	l.tickets++
+	return rec, l.tickets, err
+}
+
+// write writes the record sealed with ticket once every earlier record has been written, or records err instead.
+// Nothing is written after the first error.
+func (l *walLog[V]) write(rec []byte, ticket uint64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.written != ticket-1 {
+		l.turn.Wait()
+	}
+	if l.err == nil {
+		if err == nil {
+			_, err = l.w.Write(rec)
+		}
+		l.err = err
+	}
+	l.written = ticket
+	l.turn.Broadcast()
+}
+
+// unlock releases the write lock, then logs the changes made under it
+func (t *GenericTrie[V]) unlock() {
+	if t.wal == nil {
+		t.mx.Unlock()
+		return
+	}
+	rec, ticket, err := t.seal()
+	t.mx.Unlock()
+	if rec != nil {
+		t.wal.write(rec, ticket, err)
+	}
+}
+
+// replace installs fresh, which no one else may hold, in place of the contents of t under a brief write lock. The log
+// records the new contents in full, encoded before the lock is taken and written after it is released.
+func (t *GenericTrie[V]) replace(fresh *GenericTrie[V]) {
+	ops, err := t.wal.contents(fresh)
+	t.mx.Lock()
+	t.install(fresh)
+	t.wal.replaced(ops, err)
+	t.unlock()
+}
+
+// startWAL attaches the WithWAL log, if any, once the Trie has been filled with its initial contents
+func (t *GenericTrie[V]) startWAL() {
+	if t.cfg.wal != nil {
+		l := &walLog[V]{w: t.cfg.wal}
+		l.turn = sync.NewCond(&l.mu)
+		t.wal = l
+	}
+}
+
+// WALError returns the error that stopped the WithWAL log, or nil if every record has been written
+func (t *GenericTrie[V]) WALError() error {
+	if t.wal == nil {
+		return nil
+	}
+	t.wal.mu.Lock()
+	defer t.wal.mu.Unlock()
+	return t.wal.err
+}
+
+/*
+Replay applies the records of a log written by WithWAL to t, typically a Trie just loaded from the snapshot the log
+was started after, and returns the number of records applied. A final record cut short, as left by a crash partway
+through a write, is skipped and ends the replay without error; any other record failing its checksums or not decoding
+fails with ErrCorruptWAL after applying the records before it. Each record leaves the pairs it holds exactly as they
+were logged, so replaying a log from slightly before the snapshot is harmless. Payloads t already stores are kept.
+t should not itself log to the file being replayed.
+*/
+func Replay[V comparable](t *GenericTrie[V], r io.Reader) (applied int, err error) {
+	br := bufio.NewReader(r)
+	for {
+		body, err := readWALRecord(br)
+		if err == io.EOF {
+			return applied, nil
+		}
+		if err == nil {
+			err = t.replayRecord(body)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("%w after %d records: %v", ErrCorruptWAL, applied, err)
+		}
+		applied++
+	}
+}
+
+// readWALRecord reads the body of the next record, returning io.EOF at the end of r or of a record cut short there
+func readWALRecord(r io.Reader) ([]byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(header[4:]) != crc32.ChecksumIEEE(header[:4]) {
+		return nil, errors.New("length checksum mismatch")
+	}
+	// The record is copied as it arrives, so memory is only committed to bytes actually present
+	n := int64(binary.LittleEndian.Uint32(header[:4]))
+	var rec bytes.Buffer
+	if _, err := io.CopyN(&rec, r, n+4); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	body := rec.Bytes()[:n]
+	if binary.LittleEndian.Uint32(rec.Bytes()[n:]) != crc32.ChecksumIEEE(body) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return body, nil
+}
+
+// walOp is one decoded operation of a log record
+type walOp[V comparable] struct {
+	op      byte
+	key     string
+	display string
+	pair    snapshotPair[V]
+}
+
+// replayRecord applies one record body under the write lock
+func (t *GenericTrie[V]) replayRecord(body []byte) error {
+	d := &binaryDecoder[V]{r: &sumReader{r: bytes.NewReader(body)}, codec: codecOf[V]()}
+	var ops []walOp[V]
+	for d.err == nil && d.r.off < int64(len(body)) {
+		o := walOp[V]{op: d.u8()}
+		switch o.op {
+		case walPut:
+			o.key, o.display = d.str(), d.str()
+			o.pair = d.pair()
+		case walRemove:
+			o.key = d.str()
+			o.pair.ID = d.value()
+		case walClear:
+		default:
+			if d.err == nil {
+				return fmt.Errorf("unknown operation %d", o.op)
+			}
+		}
+		ops = append(ops, o)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	t.mx.Lock()
+	defer t.unlock()
+	for _, o := range ops {
+		switch o.op {
+		case walPut:
+			if err := t.replayPut(o.key, o.display, o.pair); err != nil {
+				return err
+			}
+		case walRemove:
+			t.removePair(o.key, o.pair.ID)
+		case walClear:
+			t.install(newTrie[V](t.cfg))
+			t.wal.clear()
+		}
+	}
+	return nil
+}
+
+// replayPut leaves the pair at the already normalized key with exactly the logged metadata, keeping the payload it
+// already stores, if any. The caller must hold the write lock.
+func (t *GenericTrie[V]) replayPut(key, display string, p snapshotPair[V]) error {
+	if node := findTip(key, t.root); node != nil && node.ContainsVal(p.ID) {
+		if m := node.getMeta(p.ID); m != nil {
+			p.Payload = m.payload
+		}
+	}
+	return t.restore(snapshotKey[V]{Key: key, Display: display, Pairs: []snapshotPair[V]{p}})
+}
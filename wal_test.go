@@ -0,0 +1,377 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// walStep is a mutation applied to the logging Trie
+type walStep struct {
+	name string
+	do   func(tr *Trie)
+}
+
+// TestWALReplay mutates a logging Trie through every mutator after taking a snapshot, then checks that replaying the
+// log onto the snapshot, cut after any record or partway through the next one as a crash would leave it, reproduces
+// the Trie as it was after that record
+func TestWALReplay(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	opts := []Option{WithClock(func() time.Time { return now }), WithReverseIndex(), WithHitHalfLife(time.Hour)}
+	var log bytes.Buffer
+	live := NewTrie(append(opts, WithWAL(&log))...)
+	a, b, c, d := objectID(1), objectID(2), objectID(3), objectID(4)
+	live.Add("Ada", a)
+	live.Add("Bob", b)
+	var snap bytes.Buffer
+	if err := live.Save(&snap); err != nil {
+		t.Fatal(err)
+	}
+	log.Reset()
+
+	steps := []walStep{
+		{"Add", func(tr *Trie) { tr.Add("Carol", c) }},
+		{"Add of a new display form", func(tr *Trie) { tr.Add("CAROL", c) }},
+		{"Remove", func(tr *Trie) { tr.Remove("bob", b) }},
+		{"AddWeighted", func(tr *Trie) { tr.AddWeighted("dave", d, 2.5) }},
+		{"SetWeight", func(tr *Trie) { tr.SetWeight("dave", d, 4) }},
+		{"RecordHit", func(tr *Trie) { tr.RecordHit("dave", d) }},
+		{"DecayNow", func(tr *Trie) { now = now.Add(time.Hour); tr.DecayNow() }},
+		{"ResetHits", func(tr *Trie) { tr.ResetHits() }},
+		{"AddTagged", func(tr *Trie) { tr.AddTagged("ada", a, "first") }},
+		{"AddEntry", func(tr *Trie) { tr.AddEntry("eve", b, "payload") }},
+		{"AddFields", func(tr *Trie) { tr.AddFields("mary jane watson", c) }},
+		{"RemoveFields", func(tr *Trie) { tr.RemoveFields("jane watson", c) }},
+		{"AddMany", func(tr *Trie) {
+			tr.AddMany([]KeyID{{Key: "fay", ID: a}, {Key: "fig", ID: b}, {Key: "fin", ID: c}})
+		}},
+		{"RemoveMany", func(tr *Trie) { tr.RemoveMany([]KeyID{{Key: "fig", ID: b}, {Key: "fay", ID: b}}) }},
+		{"Apply", func(tr *Trie) {
+			var batch Batch
+			batch.Add("gus", d)
+			batch.Remove("fin", c)
+			batch.Add("Gus", a)
+			tr.Apply(batch)
+		}},
+		{"ReplaceVal", func(tr *Trie) { tr.ReplaceVal("gus", d, b) }},
+		{"Rename", func(tr *Trie) { tr.Rename("gus", "Hal") }},
+		{"Rename to a new display form", func(tr *Trie) { tr.Rename("hal", "HAL") }},
+		{"RemoveID", func(tr *Trie) { tr.RemoveID(a) }},
+		{"RemoveAll", func(tr *Trie) { tr.RemoveAll("carol") }},
+		{"RemoveFunc", func(tr *Trie) { tr.RemoveFunc("", func(id bson.ObjectId) bool { return id == d }) }},
+		{"AddWithTTL", func(tr *Trie) { tr.AddWithTTL("ivy", a, time.Minute) }},
+		{"AddWithTTL of a longer-lived pair", func(tr *Trie) { tr.AddWithTTL("ivan", b, time.Hour) }},
+		{"Purge", func(tr *Trie) { now = now.Add(2 * time.Minute); tr.Purge() }},
+		{"Add under the subtree to delete", func(tr *Trie) { tr.Add("mars", a) }},
+		{"DeleteSubtree", func(tr *Trie) { tr.DeleteSubtree("ma") }},
+		{"Import", func(tr *Trie) { tr.Import(map[string][]bson.ObjectId{"jay": {a, b}, "eve": {c}}, false) }},
+		{"Import replacing the contents", func(tr *Trie) {
+			tr.Import(map[string][]bson.ObjectId{"kim": {a}, "Kit": {b}}, true)
+		}},
+		{"Add after Import", func(tr *Trie) { tr.Add("kit", c) }},
+		{"Swap", func(tr *Trie) {
+			other := NewTrie(opts...)
+			other.AddWeighted("Lee", d, 1)
+			tr.Swap(other)
+		}},
+		{"Rebuild", func(tr *Trie) {
+			tr.Rebuild(context.Background(), func(yield func(KeyID) bool) {
+				yield(KeyID{Key: "Max", ID: a})
+				yield(KeyID{Key: "mia", ID: b})
+			}, nil)
+		}},
+		{"UnmarshalJSON", func(tr *Trie) {
+			data, _ := json.Marshal(map[string][]bson.ObjectId{"ned": {c}, "nia": {a, d}})
+			if err := json.Unmarshal(data, tr); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"Clear", func(tr *Trie) { tr.Clear() }},
+		{"Add after Clear", func(tr *Trie) { tr.Add("Oz", a) }},
+	}
+	ends := []int{0}
+	states := [][]byte{marshalBinary(t, live)}
+	for _, step := range steps {
+		before := log.Len()
+		step.do(live)
+		if n := walRecords(t, log.Bytes()[before:]); n != 1 {
+			t.Fatalf("%s logged %d records, want 1", step.name, n)
+		}
+		ends = append(ends, log.Len())
+		states = append(states, marshalBinary(t, live))
+	}
+	if err := live.WALError(); err != nil {
+		t.Fatal(err)
+	}
+	before := log.Len()
+	live.Remove("oz", b)
+	live.SetWeight("oz", b, 1)
+	expect(t, "bytes logged by operations changing nothing", log.Len(), before)
+
+	for i := range ends {
+		cuts := []int{ends[i]}
+		if i+1 < len(ends) {
+			// A crash in the header, in the body and in the final checksum of the next record
+			cuts = append(cuts, ends[i]+5, (ends[i]+ends[i+1])/2, ends[i+1]-1)
+		}
+		for _, cut := range cuts {
+			replayed, err := Load(bytes.NewReader(snap.Bytes()), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied, err := Replay(replayed, bytes.NewReader(log.Bytes()[:cut]))
+			if err != nil {
+				t.Fatalf("replaying %d bytes: %v", cut, err)
+			}
+			expect(t, "records applied", applied, i)
+			if got := marshalBinary(t, replayed); !bytes.Equal(got, states[i]) {
+				name := "the snapshot"
+				if i > 0 {
+					name = steps[i-1].name
+				}
+				t.Fatalf("replaying %d bytes, the Trie after %s differs: %v, want %v", cut, name,
+					replayed.GetManyWithKeys("", 100), decodeState(t, states[i]).GetManyWithKeys("", 100))
+			}
+		}
+	}
+}
+
+// TestWALCorrupt checks that only a record cut short at the end of the log is skipped
+func TestWALCorrupt(t *testing.T) {
+	var log bytes.Buffer
+	tr := NewTrie(WithWAL(&log))
+	tr.Add("alpha", objectID(1))
+	first := log.Len()
+	tr.Add("beta", objectID(2))
+	full := log.Bytes()
+
+	for _, c := range []struct {
+		name string
+		off  int
+	}{
+		{"length", 1},
+		{"length checksum", 5},
+		{"body", 10},
+		{"body checksum of the last record", len(full) - 1},
+		{"body of the last record", first + 10},
+	} {
+		bad := append([]byte(nil), full...)
+		bad[c.off] ^= 0xff
+		if _, err := Replay(NewTrie(), bytes.NewReader(bad)); !errors.Is(err, ErrCorruptWAL) {
+			t.Errorf("corrupt %s: Replay = %v, want ErrCorruptWAL", c.name, err)
+		}
+	}
+
+	// A record claiming more bytes than follow, with an intact header, is a torn write
+	torn := append([]byte(nil), full[:first]...)
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[:], 1<<30)
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(header[:4]))
+	torn = append(torn, header[:]...)
+	torn = append(torn, 1, 2, 3)
+	replayed := NewTrie()
+	applied, err := Replay(replayed, bytes.NewReader(torn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "records applied before a torn record", applied, 1)
+	expect(t, "contents", replayed.ToMap(), map[string][]bson.ObjectId{"alpha": {objectID(1)}})
+}
+
+// TestWALStart checks that the contents a Trie is created with are not logged
+func TestWALStart(t *testing.T) {
+	src := NewTrie()
+	src.Add("alpha", objectID(1))
+	data, _ := src.MarshalBinary()
+	var log bytes.Buffer
+	tr, err := Load(bytes.NewReader(data), WithWAL(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewTrieFromMap(src.ToMap(), WithWAL(&log))
+	expect(t, "bytes logged by the constructors", log.Len(), 0)
+	tr.Clone().Add("beta", objectID(2))
+	expect(t, "bytes logged by a Clone", log.Len(), 0)
+	tr.Add("gamma", objectID(3))
+	replayed := NewTrie()
+	if _, err := Replay(replayed, &log); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "contents", replayed.ToMap(), map[string][]bson.ObjectId{"gamma": {objectID(3)}})
+}
+
+// TestWALRecordSize checks that a record holds only the pairs an operation changed, however many ids their keys hold,
+// and that Clear is a single operation however large the Trie
+func TestWALRecordSize(t *testing.T) {
+	var log bytes.Buffer
+	tr := NewTrie(WithWAL(&log))
+	for i := 0; i < 1000; i++ {
+		tr.Add("hot", objectID(i))
+		tr.Add(fmt.Sprintf("key %d", i), objectID(i))
+	}
+	sizes := map[string]int{}
+	for _, step := range []walStep{
+		{"Add of a pair to a key with 1000 ids", func(tr *Trie) { tr.Add("hot", objectID(5000)) }},
+		{"Add of a pair to a new key", func(tr *Trie) { tr.Add("cold", objectID(5000)) }},
+		{"Remove", func(tr *Trie) { tr.Remove("hot", objectID(1)) }},
+		{"SetWeight", func(tr *Trie) { tr.SetWeight("hot", objectID(2), 3) }},
+		{"Clear", func(tr *Trie) { tr.Clear() }},
+	} {
+		before := log.Len()
+		step.do(tr)
+		sizes[step.name] = log.Len() - before
+	}
+	if sizes["Add of a pair to a key with 1000 ids"] > sizes["Add of a pair to a new key"] {
+		t.Fatalf("an Add to a key with 1000 ids logs %d bytes, to a new key %d", sizes["Add of a pair to a key with 1000 ids"], sizes["Add of a pair to a new key"])
+	}
+	for name, size := range sizes {
+		if size > 64 {
+			t.Fatalf("%s logged %d bytes", name, size)
+		}
+	}
+}
+
+// blockingWriter signals started as each Write begins and returns once release is closed
+type blockingWriter struct {
+	bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.started <- struct{}{}
+	<-w.release
+	return w.Buffer.Write(p)
+}
+
+// TestWALOutsideLock checks that readers are answered while a record replacing the contents is being written, and
+// that replaying the log keeps the order the operations took effect in
+func TestWALOutsideLock(t *testing.T) {
+	w := &blockingWriter{started: make(chan struct{}, 10), release: make(chan struct{})}
+	tr := NewTrie(WithWAL(w))
+	other := NewTrie()
+	for i := 0; i < 1000; i++ {
+		other.Add(fmt.Sprintf("key %d", i), objectID(i))
+	}
+	done := make(chan struct{})
+	go func() {
+		tr.Swap(other)
+		tr.Add("after", objectID(1))
+		close(done)
+	}()
+	<-w.started
+	got := make(chan int)
+	go func() { got <- len(tr.GetMany("key", 2000)) }()
+	select {
+	case n := <-got:
+		expect(t, "GetMany while the Swap is logged", n, 1000)
+	case <-time.After(10 * time.Second):
+		t.Fatal("a reader waited for the log")
+	}
+	close(w.release)
+	<-done
+
+	replayed := NewTrie()
+	if _, err := Replay(replayed, &w.Buffer); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "contents replayed", replayed.ToMap(), tr.ToMap())
+}
+
+// TestWALConcurrent checks that concurrent writers log their changes in the order they took effect
+func TestWALConcurrent(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	opts := []Option{WithClock(func() time.Time { return now })}
+	var log bytes.Buffer
+	tr := NewTrie(append(opts, WithWAL(&log))...)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 500; i++ {
+				key, id := fmt.Sprintf("key %d", rng.Intn(20)), objectID(rng.Intn(20))
+				switch rng.Intn(10) {
+				case 0:
+					tr.RemoveAll(key)
+				case 1, 2, 3:
+					tr.Remove(key, id)
+				case 4:
+					tr.AddWeighted(key, id, float64(g))
+				default:
+					tr.Add(key, id)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	replayed := NewTrie(opts...)
+	if _, err := Replay(replayed, &log); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshalBinary(t, replayed), marshalBinary(t, tr)) {
+		t.Fatal("replaying the log of concurrent writers differs from the Trie")
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, io.ErrShortWrite }
+
+func TestWALError(t *testing.T) {
+	tr := NewTrie(WithWAL(failingWriter{}))
+	tr.Add("alpha", objectID(1))
+	tr.Add("beta", objectID(2))
+	if err := tr.WALError(); err != io.ErrShortWrite {
+		t.Fatalf("WALError = %v, want io.ErrShortWrite", err)
+	}
+	expect(t, "contents", tr.KeyCount(), 2)
+}
+
+// walRecords returns the number of records in a log
+func walRecords(t *testing.T, log []byte) int {
+	t.Helper()
+	r := bytes.NewReader(log)
+	n := 0
+	for {
+		if _, err := readWALRecord(r); err == io.EOF {
+			return n
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+}
+
+// marshalBinary returns the binary snapshot of tr, failing the test on error
+func marshalBinary(t *testing.T, tr *Trie) []byte {
+	t.Helper()
+	data, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decodeState returns the Trie held by a binary snapshot, failing the test on error
+func decodeState(t *testing.T, data []byte) *Trie {
+	t.Helper()
+	tr := NewTrie()
+	if err := tr.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}